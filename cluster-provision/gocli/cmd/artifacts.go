@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/docker/client"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+)
+
+// collectArtifacts writes the diagnostics of the cluster and the last provisioning output to the folder,
+// it runs before the containers of a failed run are removed
+func collectArtifacts(cli *client.Client, logger *utils.ProvisionLogger, prefix string, dir string, progress io.Writer) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	if err := logger.WriteTails(filepath.Join(dir, "provision")); err != nil {
+		return err
+	}
+
+	tasks, err := gatherTasks(cli, prefix, progress)
+	if err != nil {
+		return err
+	}
+	write := func(path string, data []byte) error {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(path, data, 0644)
+	}
+	if err := runGatherTasks(cli, prefix, tasks, 8, write, progress); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(progress, "The failure artifacts were written to %s\n", dir)
+	return nil
+}
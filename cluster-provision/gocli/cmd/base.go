@@ -0,0 +1,274 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// baseImage is the image with vm.sh and dnsmasq.sh into which the cloud images are built, as tagged by
+// base/build.sh. The published digests of kubevirtci/base predate genisoimage, so no digest is pinned.
+const baseImage = "kubevirtci/base"
+
+// NewBaseCommand returns command to manage the base images of the providers
+func NewBaseCommand() *cobra.Command {
+
+	base := &cobra.Command{
+		Use:   "base",
+		Short: "base manages the base images from which the provider images are provisioned",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprint(cmd.OutOrStderr(), cmd.UsageString())
+		},
+	}
+
+	base.AddCommand(
+		NewBaseBuildCommand(),
+	)
+
+	return base
+}
+
+// NewBaseBuildCommand returns command to build a base image from a cloud image
+func NewBaseBuildCommand() *cobra.Command {
+
+	build := &cobra.Command{
+		Use:   "build --image cloud.qcow2 target",
+		Short: "build builds a base image from a local cloud image with cloud-init",
+		Long: `build builds a base image from a local cloud image with cloud-init
+
+The cloud image boots once with a generated NoCloud seed ISO, which creates the
+vagrant user with a generated SSH key and configures DHCP on the node. The user
+data of --user-data is merged into the generated one. After cloud-init finished,
+the node is shut down and its disk is committed as /box.qcow2 together with the
+private key as /vagrant.key, so that vm.sh and dnsmasq.sh of the base image run
+the nodes like the ones of the Vagrant boxes.
+`,
+		RunE: buildBase,
+		Args: cobra.ExactArgs(1),
+	}
+	build.Flags().String("image", "", "local cloud image in qcow2 or raw format")
+	build.Flags().String("user-data", "", "cloud-init user data which is merged into the generated one, like a #cloud-config or a script")
+	build.Flags().String("network-config", "", "cloud-init network config which replaces the generated DHCP config")
+	build.Flags().String("disk-size", "", "grows the disk of the cloud image to the size, like 20G")
+	build.Flags().String("base", baseImage, "image with vm.sh, dnsmasq.sh and genisoimage into which the cloud image is built, like the one of cluster-provision/base/build.sh")
+	build.Flags().StringP("memory", "m", "2048M", "amount of ram of the node")
+	build.Flags().UintP("cpu", "c", 2, "number of cpu cores of the node")
+	build.Flags().String("pull", string(docker.PullMissing), "when to pull the base image: always, missing or never")
+	build.Flags().String("provision-log-dir", "", "writes the build output to one log file per phase in the folder")
+
+	return build
+}
+
+func buildBase(cmd *cobra.Command, args []string) (err error) {
+	target := args[0]
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	image, err := cmd.Flags().GetString("image")
+	if err != nil {
+		return err
+	}
+	if image == "" {
+		return fmt.Errorf("the cloud image has to be set with --image")
+	}
+	image, err = filepath.Abs(image)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(image); err != nil {
+		return err
+	}
+
+	seedFiles := map[string][]byte{}
+	for _, flag := range []string{"user-data", "network-config"} {
+		path, err := cmd.Flags().GetString(flag)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			continue
+		}
+		seedFiles[flag], err = ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	diskSize, err := cmd.Flags().GetString("disk-size")
+	if err != nil {
+		return err
+	}
+
+	base, err := cmd.Flags().GetString("base")
+	if err != nil {
+		return err
+	}
+
+	memory, err := cmd.Flags().GetString("memory")
+	if err != nil {
+		return err
+	}
+
+	cpu, err := cmd.Flags().GetUint("cpu")
+	if err != nil {
+		return err
+	}
+
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
+
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	privateKey, publicKey, err := utils.GenerateSSHKey()
+	if err != nil {
+		return err
+	}
+	seed, err := utils.GetCloudInitSeed(fmt.Sprintf("%s-%d", prefix, time.Now().Unix()), publicKey, seedFiles["user-data"], seedFiles["network-config"])
+	if err != nil {
+		return err
+	}
+
+	// The seed and the key are copied into the node container from a temporary directory
+	seedDir, err := ioutil.TempDir("", "gocli-seed")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(seedDir)
+	for name, data := range map[string][]byte{
+		"seed/user-data":      seed.UserData,
+		"seed/meta-data":      seed.MetaData,
+		"seed/network-config": seed.NetworkConfig,
+		"vagrant.key":         privateKey,
+	} {
+		path := filepath.Join(seedDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+
+	seedScript, err := utils.GetSeedScript(memory, cpu, diskSize, utils.PortQEMUMonitor+1)
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	containers, volumes, done := docker.NewCleanupHandler(cli, cmd.OutOrStderr())
+
+	defer func() {
+		done <- fmt.Errorf("please clean up")
+	}()
+
+	go func() {
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+		done <- fmt.Errorf("Interrupt received, clean up")
+	}()
+
+	err = docker.EnsureImage(cli, ctx, base, pullPolicy)
+	if err != nil {
+		return err
+	}
+
+	dnsmasq, err := startDNSMasq(ctx, cli, prefix, base, false, nat.PortMap{}, containers)
+	if err != nil {
+		return err
+	}
+
+	// The seed ISO is written in the node container, the base image has to contain genisoimage
+	hasGenisoimage, err := docker.Exec(cli, dnsmasq, []string{"/bin/bash", "-c", "command -v genisoimage"}, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	if !hasGenisoimage {
+		return fmt.Errorf("the base image %s has no genisoimage, build it from cluster-provision/base with build.sh and pass it with --base", base)
+	}
+
+	nodeName := nodeNameFromIndex(1)
+	// The container has to contain the cloud image, the seed and the key before its command runs
+	fmt.Printf("Copy the cloud image %s into the container %s\n", image, nodeContainer(prefix, nodeName))
+	node, err := startNode(ctx, cli, logger, prefix, dnsmasq, &nodeOptions{
+		image:   base,
+		command: seedScript,
+		copy: map[string]string{
+			image:                                 "/image",
+			filepath.Join(seedDir, "seed"):        "/seed",
+			filepath.Join(seedDir, "vagrant.key"): "/vagrant.key",
+		},
+	}, containers, volumes)
+	if err != nil {
+		return err
+	}
+
+	cloudInit, err := utils.GetCloudInitScript()
+	if err != nil {
+		return err
+	}
+	success, err := provisionScript(cli, logger, prefix, nodeName, "cloud-init", "cloud-init", cloudInit)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("cloud-init failed on node %s", nodeName)
+	}
+
+	flatten, err := utils.GetFlattenScript(utils.PortQEMUMonitor + 1)
+	if err != nil {
+		return err
+	}
+	if err := shutdownNode(cli, logger, prefix, nodeName, "flatten", flatten); err != nil {
+		return err
+	}
+
+	fmt.Printf("Commit the container %s as %s\n", nodeContainer(prefix, nodeName), target)
+	_, err = cli.ContainerCommit(ctx, node, types.ContainerCommitOptions{
+		Reference: target,
+		Comment:   fmt.Sprintf("built from %s with cloud-init", filepath.Base(image)),
+		Changes: append(utils.LabelChanges(map[string]string{
+			utils.LabelBaseImage:  base,
+			utils.LabelCloudImage: filepath.Base(image),
+		}), `CMD ["/bin/bash"]`),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to commit the container %s: %v", nodeContainer(prefix, nodeName), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewBuildCommand returns command to build a provider image from a recipe
+func NewBuildCommand() *cobra.Command {
+
+	build := &cobra.Command{
+		Use:   "build recipe.yaml",
+		Short: "build builds a provider image as declared by the recipe",
+		Long: `build builds a provider image as declared by the recipe
+
+The recipe declares the base image, the Kubernetes version, the packages to
+install, the files and manifests to copy, the scripts directory with the
+provision scripts and the scripts which the image runs on the nodes, and the
+tag of the image. The paths of the recipe are relative to its directory.
+
+The base image is resolved to its digest and the image is labeled with it,
+with the sha256 of the recipe and with the Kubernetes version, so that every
+image can be traced back to what it was built from.
+`,
+		RunE: build,
+		Args: cobra.ExactArgs(1),
+	}
+	build.Flags().String("tag", "", "overrides the tag of the recipe")
+	build.Flags().String("qemu-args", "", "additional qemu args to pass through to the node")
+	build.Flags().String("pull", string(docker.PullAlways), "when to pull the base image: always, missing or never")
+	build.Flags().String("provision-log-dir", "", "writes the provisioning output to one log file per phase in the folder")
+
+	return build
+}
+
+func build(cmd *cobra.Command, args []string) error {
+
+	recipe, err := utils.LoadRecipe(args[0])
+	if err != nil {
+		return err
+	}
+
+	tag, err := cmd.Flags().GetString("tag")
+	if err != nil {
+		return err
+	}
+	if tag != "" {
+		recipe.Tag = tag
+	}
+
+	qemuArgs, err := cmd.Flags().GetString("qemu-args")
+	if err != nil {
+		return err
+	}
+
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
+
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	files := recipe.Files
+	manifests, err := resolveManifests(recipe.Manifests)
+	if err != nil {
+		return err
+	}
+	for i, manifest := range manifests {
+		destination := fmt.Sprintf("%s/%02d-%s", utils.RecipeManifestsDir, i, filepath.Base(manifest))
+		if err := utils.ValidateGuestPath(destination); err != nil {
+			return fmt.Errorf("invalid manifest %s: %v", manifest, err)
+		}
+		files = append(files, utils.RecipeFile{Source: manifest, Destination: destination})
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	// Provision the base image by its digest, so that the image records exactly what it was built from
+	err = docker.EnsureImage(cli, ctx, recipe.Base, pullPolicy)
+	if err != nil {
+		return err
+	}
+	base, err := baseDigest(cli, ctx, recipe.Base)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Build %s from %s\n", recipe.Tag, base)
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	return provisionImage(cmd, &provisionOptions{
+		base:       base,
+		target:     recipe.Tag,
+		scripts:    recipe.Scripts,
+		provision:  recipe.Provision,
+		args:       recipe.Args,
+		env:        recipe.Env(),
+		files:      files,
+		packages:   recipe.Packages,
+		changes:    utils.LabelChanges(recipe.BuildLabels(base)),
+		memory:     recipe.Memory,
+		cpu:        recipe.CPU,
+		qemuArgs:   qemuArgs,
+		portMap:    nat.PortMap{},
+		pullPolicy: docker.PullNever,
+		logger:     logger,
+	})
+}
+
+// baseDigest returns the reference of the local image by its repository digest,
+// images which were never pushed or pulled have none and keep their reference
+func baseDigest(cli *client.Client, ctx context.Context, ref string) (string, error) {
+	image, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	if len(image.RepoDigests) == 0 {
+		fmt.Printf("The base image %s has no digest, the build is not reproducible\n", ref)
+		return ref, nil
+	}
+	return image.RepoDigests[0], nil
+}
@@ -0,0 +1,25 @@
+package ceph
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// NewCephCommand returns command to interact with the Ceph cluster which backs the csi-rbd StorageClass
+func NewCephCommand() *cobra.Command {
+
+	ceph := &cobra.Command{
+		Use:   "ceph",
+		Short: "ceph interacts with the Ceph cluster started by run --enable-ceph",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprint(cmd.OutOrStderr(), cmd.UsageString())
+		},
+	}
+
+	ceph.AddCommand(
+		NewStatusCommand(),
+	)
+
+	return ceph
+}
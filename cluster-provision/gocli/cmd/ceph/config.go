@@ -0,0 +1,373 @@
+package ceph
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/pflag"
+)
+
+// MonitorIP is the address under which the Ceph monitor is reachable from the nodes
+const MonitorIP = "192.168.66.2"
+
+// StorageClass is the name of the generated RBD StorageClass
+const StorageClass = "csi-rbd"
+
+// CephFSStorageClass is the name of the generated CephFS StorageClass
+const CephFSStorageClass = "csi-cephfs"
+
+//go:generate ../utils/generate-manifests.sh ceph cephfsManifestFiles cephfs_manifests.go ceph/csi-cephfsplugin-rbac.yaml ceph/csi-cephfsplugin-attacher.yaml ceph/csi-cephfsplugin-provisioner.yaml ceph/csi-cephfsplugin.yaml
+
+// cephfsManifestsDir contains the manifests of the CephFS CSI driver on node01
+const cephfsManifestsDir = "/tmp/gocli-cephfs"
+
+// cephfsManifests contains the manifests of cephfsManifestFiles in the order in which they are applied
+var cephfsManifests = []string{
+	"ceph/csi-cephfsplugin-rbac.yaml",
+	"ceph/csi-cephfsplugin-attacher.yaml",
+	"ceph/csi-cephfsplugin-provisioner.yaml",
+	"ceph/csi-cephfsplugin.yaml",
+}
+
+var poolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][-a-zA-Z0-9_.]*$`)
+
+// poolsSettings runs inside the Ceph container, every step is idempotent
+const poolsSettings = `
+set -e
+
+ensure_pool() {
+    if ! ceph osd pool ls | grep -qx "$1"; then
+        ceph osd pool create "$1" {{.PGs}}
+    fi
+{{- if gt .Replicas 1}}
+    ceph osd pool set "$1" size {{.Replicas}}
+    ceph osd pool set "$1" min_size 1
+{{- end}}
+}
+
+ensure_pool {{.RBDPool}}
+ceph osd pool application enable {{.RBDPool}} rbd
+rbd pool init {{.RBDPool}}
+{{- if .CephFS}}
+
+ensure_pool {{.CephFS}}_metadata
+ensure_pool {{.CephFS}}_data
+if ! ceph fs ls | grep -q "name: {{.CephFS}},"; then
+    ceph fs new {{.CephFS}} {{.CephFS}}_metadata {{.CephFS}}_data
+fi
+{{- end}}
+`
+
+// csiSettings runs on node01 and replaces the Secret, the StorageClass and the VolumeSnapshotClass
+// in /tmp/ceph of the cluster image before ceph-csi.sh creates them
+const csiSettings = `
+set -e
+
+cat <<'EOT' >/tmp/ceph/ceph-secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: csi-rbd-secret
+  namespace: default
+data:
+  admin: {{.Key}}
+EOT
+
+cat <<'EOT' >/tmp/ceph/ceph-storageclass.yaml
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: {{.StorageClass}}
+{{- if .Default}}
+  annotations:
+    storageclass.kubernetes.io/is-default-class: "true"
+{{- end}}
+provisioner: csi-rbdplugin
+parameters:
+  monitors: {{.Monitor}}
+  pool: {{.RBDPool}}
+  imageFormat: "2"
+  imageFeatures: layering
+  csi.storage.k8s.io/provisioner-secret-name: csi-rbd-secret
+  csi.storage.k8s.io/provisioner-secret-namespace: default
+  csi.storage.k8s.io/node-publish-secret-name: csi-rbd-secret
+  csi.storage.k8s.io/node-publish-secret-namespace: default
+  adminid: admin
+  multiNodeWritable: enabled
+reclaimPolicy: Delete
+EOT
+
+cat <<'EOT' >/tmp/ceph/ceph-snapshotclass.yaml
+apiVersion: snapshot.storage.k8s.io/v1alpha1
+kind: VolumeSnapshotClass
+metadata:
+  name: csi-rbdplugin-snapclass
+snapshotter: csi-rbdplugin
+parameters:
+  pool: {{.RBDPool}}
+  monitors: {{.Monitor}}
+  csi.storage.k8s.io/snapshotter-secret-name: csi-rbd-secret
+  csi.storage.k8s.io/snapshotter-secret-namespace: default
+EOT
+{{- if .Default}}
+
+# Only one StorageClass may be the default one
+export KUBECONFIG=/etc/kubernetes/admin.conf
+for class in $(kubectl get storageclasses -o name); do
+    kubectl annotate ${class} storageclass.kubernetes.io/is-default-class=false --overwrite
+done
+{{- end}}
+EOF
+`
+
+// cephfsSettings runs on node01 after ceph-csi.sh and deploys the CephFS CSI driver which gocli carries,
+// with a Secret and a StorageClass which provisions subvolumes of the CephFS filesystem
+const cephfsSettings = `
+set -e
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+mkdir -p ` + cephfsManifestsDir + `
+{{- range .Manifests}}
+
+cat <<'EOT' >{{.Path}}
+{{.Content}}
+EOT
+kubectl apply -f {{.Path}}
+{{- end}}
+
+cat <<'EOT' >` + cephfsManifestsDir + `/cephfs-secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: csi-cephfs-secret
+  namespace: default
+data:
+  adminID: YWRtaW4=
+  adminKey: {{.Key}}
+EOT
+kubectl apply -f ` + cephfsManifestsDir + `/cephfs-secret.yaml
+
+cat <<'EOT' >` + cephfsManifestsDir + `/cephfs-storageclass.yaml
+apiVersion: storage.k8s.io/v1
+kind: StorageClass
+metadata:
+  name: {{.StorageClass}}
+provisioner: csi-cephfsplugin
+parameters:
+  monitors: {{.Monitor}}
+  provisionVolume: "true"
+  pool: {{.CephFS}}_data
+  csi.storage.k8s.io/provisioner-secret-name: csi-cephfs-secret
+  csi.storage.k8s.io/provisioner-secret-namespace: default
+  csi.storage.k8s.io/node-stage-secret-name: csi-cephfs-secret
+  csi.storage.k8s.io/node-stage-secret-namespace: default
+reclaimPolicy: Delete
+EOT
+kubectl apply -f ` + cephfsManifestsDir + `/cephfs-storageclass.yaml
+
+timeout 600 kubectl rollout status daemonset/csi-cephfsplugin
+EOF
+`
+
+// cephfsManifest is a manifest of the CephFS CSI driver which is written to node01 and applied there
+type cephfsManifest struct {
+	Path    string
+	Content string
+}
+
+// Config contains the settings of the Ceph cluster which backs the RBD StorageClass
+type Config struct {
+	// Enabled starts the Ceph container and deploys the RBD CSI driver
+	Enabled bool
+	// OSDs is the number of OSDs the Ceph container starts
+	OSDs uint
+	// OSDSize is the size of the block file of every OSD in bytes, zero keeps the default of the image
+	OSDSize int64
+	// RBDPool is the pool in which the RBD images of the volumes are created
+	RBDPool string
+	// CephFS is the name of the filesystem which backs the CephFS StorageClass, empty disables CephFS and the MDS
+	CephFS string
+	// DefaultStorageClass makes the RBD StorageClass the default one of the cluster
+	DefaultStorageClass bool
+	// Timeout is how long to wait for the Ceph cluster to become healthy
+	Timeout time.Duration
+}
+
+// AddFlags adds the flags to configure the Ceph cluster
+func AddFlags(flagSet *pflag.FlagSet) {
+	flagSet.Bool("enable-ceph", false, "enables dynamic storage provisioning using Ceph")
+	flagSet.Uint("ceph-osds", 1, "number of Ceph OSDs, the pools are replicated up to three times across them")
+	flagSet.String("ceph-osd-size", "", "size of the block file of every Ceph OSD, like 10G, by default the size of the Ceph image is kept")
+	flagSet.String("ceph-rbd-pool", "rbd", "Ceph pool in which the volumes of the csi-rbd StorageClass are created")
+	flagSet.String("ceph-cephfs", "", "name of the CephFS filesystem which backs the csi-cephfs StorageClass, like cephfs, by default CephFS is not deployed")
+	flagSet.Bool("ceph-default-storage-class", false, "makes csi-rbd the default StorageClass of the cluster")
+	flagSet.Duration("ceph-timeout", 10*time.Minute, "how long to wait for the Ceph cluster to become healthy")
+}
+
+// ResolveConfig reads the Ceph settings from the flags
+func ResolveConfig(flagSet *pflag.FlagSet) (*Config, error) {
+	config := &Config{}
+	var err error
+
+	config.Enabled, err = flagSet.GetBool("enable-ceph")
+	if err != nil {
+		return nil, err
+	}
+
+	config.OSDs, err = flagSet.GetUint("ceph-osds")
+	if err != nil {
+		return nil, err
+	}
+	if config.OSDs == 0 {
+		return nil, fmt.Errorf("at least one Ceph OSD is needed")
+	}
+
+	size, err := flagSet.GetString("ceph-osd-size")
+	if err != nil {
+		return nil, err
+	}
+	if size != "" {
+		config.OSDSize, err = units.RAMInBytes(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Ceph OSD size %q: %v", size, err)
+		}
+		if config.OSDSize < units.GiB {
+			return nil, fmt.Errorf("invalid Ceph OSD size %q, an OSD needs at least 1G", size)
+		}
+	}
+
+	config.RBDPool, err = flagSet.GetString("ceph-rbd-pool")
+	if err != nil {
+		return nil, err
+	}
+	if !poolNamePattern.MatchString(config.RBDPool) {
+		return nil, fmt.Errorf("invalid Ceph pool name %q", config.RBDPool)
+	}
+
+	config.CephFS, err = flagSet.GetString("ceph-cephfs")
+	if err != nil {
+		return nil, err
+	}
+	if config.CephFS != "" && !poolNamePattern.MatchString(config.CephFS) {
+		return nil, fmt.Errorf("invalid CephFS name %q", config.CephFS)
+	}
+
+	config.DefaultStorageClass, err = flagSet.GetBool("ceph-default-storage-class")
+	if err != nil {
+		return nil, err
+	}
+
+	config.Timeout, err = flagSet.GetDuration("ceph-timeout")
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Replicas returns the replication size of the pools
+func (c *Config) Replicas() uint {
+	if c.OSDs > 3 {
+		return 3
+	}
+	return c.OSDs
+}
+
+// ContainerEnv returns the environment of the ceph/daemon demo container
+func (c *Config) ContainerEnv() []string {
+	daemons := "osd"
+	if c.CephFS != "" {
+		daemons = "osd,mds"
+	}
+	env := []string{
+		"MON_IP=" + MonitorIP,
+		"CEPH_PUBLIC_NETWORK=0.0.0.0/0",
+		"DEMO_DAEMONS=" + daemons,
+		"CEPH_DEMO_UID=demo",
+		"OSD_COUNT=" + strconv.FormatUint(uint64(c.OSDs), 10),
+	}
+	if c.OSDSize > 0 {
+		env = append(env, "BLUESTORE_BLOCK_SIZE="+strconv.FormatInt(c.OSDSize, 10))
+	}
+	return env
+}
+
+// GetPoolsScript returns a script which creates the RBD pool and the CephFS filesystem inside the Ceph container
+func (c *Config) GetPoolsScript() (string, error) {
+	return render("ceph-pools", poolsSettings, struct {
+		RBDPool  string
+		CephFS   string
+		PGs      int
+		Replicas uint
+	}{
+		RBDPool:  c.RBDPool,
+		CephFS:   c.CephFS,
+		PGs:      8 * int(c.Replicas()),
+		Replicas: c.Replicas(),
+	})
+}
+
+// GetCSIScript returns a script which writes the Secret with the base64 encoded admin key,
+// the StorageClass and the VolumeSnapshotClass on node01, ceph-csi.sh creates them afterwards
+func (c *Config) GetCSIScript(key string) (string, error) {
+	return render("ceph-csi", csiSettings, struct {
+		Key          string
+		StorageClass string
+		Monitor      string
+		RBDPool      string
+		Default      bool
+	}{
+		Key:          key,
+		StorageClass: StorageClass,
+		Monitor:      MonitorIP,
+		RBDPool:      c.RBDPool,
+		Default:      c.DefaultStorageClass,
+	})
+}
+
+// GetCephFSScript returns a script which deploys the CephFS CSI driver, the Secret with the base64 encoded
+// admin key and the CephFS StorageClass on node01, or an empty script if CephFS is disabled
+func (c *Config) GetCephFSScript(key string) (string, error) {
+	if c.CephFS == "" {
+		return "", nil
+	}
+	manifests := []cephfsManifest{}
+	for _, file := range cephfsManifests {
+		manifests = append(manifests, cephfsManifest{
+			Path:    cephfsManifestsDir + "/" + path.Base(file),
+			Content: strings.TrimRight(cephfsManifestFiles[file], "\n"),
+		})
+	}
+	return render("ceph-cephfs", cephfsSettings, struct {
+		Manifests    []cephfsManifest
+		Key          string
+		StorageClass string
+		Monitor      string
+		CephFS       string
+	}{
+		Manifests:    manifests,
+		Key:          key,
+		StorageClass: CephFSStorageClass,
+		Monitor:      MonitorIP,
+		CephFS:       c.CephFS,
+	})
+}
+
+func render(name string, settings string, data interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New(name).Parse(settings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,246 @@
+package ceph
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func TestResolveConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		args   []string
+		config *Config
+		fails  bool
+	}{
+		{
+			name:   "defaults",
+			args:   nil,
+			config: &Config{OSDs: 1, RBDPool: "rbd", Timeout: 10 * time.Minute},
+		},
+		{
+			name: "all settings",
+			args: []string{"--enable-ceph", "--ceph-osds=3", "--ceph-osd-size=10G", "--ceph-rbd-pool=volumes", "--ceph-cephfs=shared", "--ceph-default-storage-class", "--ceph-timeout=5m"},
+			config: &Config{
+				Enabled:             true,
+				OSDs:                3,
+				OSDSize:             10 * 1024 * 1024 * 1024,
+				RBDPool:             "volumes",
+				CephFS:              "shared",
+				DefaultStorageClass: true,
+				Timeout:             5 * time.Minute,
+			},
+		},
+		{name: "no OSDs", args: []string{"--ceph-osds=0"}, fails: true},
+		{name: "invalid OSD size", args: []string{"--ceph-osd-size=ten"}, fails: true},
+		{name: "too small OSD size", args: []string{"--ceph-osd-size=512M"}, fails: true},
+		{name: "invalid pool", args: []string{"--ceph-rbd-pool=my pool"}, fails: true},
+		{name: "invalid filesystem", args: []string{"--ceph-cephfs=-fs"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flagSet := pflag.NewFlagSet("run", pflag.ContinueOnError)
+			AddFlags(flagSet)
+			if err := flagSet.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			config, err := ResolveConfig(flagSet)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(config, tt.config) {
+				t.Errorf("expected %+v, got %+v", tt.config, config)
+			}
+		})
+	}
+}
+
+func TestContainerEnv(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{
+			name:     "one OSD with CephFS",
+			config:   Config{OSDs: 1, CephFS: "cephfs"},
+			expected: []string{"DEMO_DAEMONS=osd,mds", "OSD_COUNT=1"},
+		},
+		{
+			name:     "sized OSDs without CephFS",
+			config:   Config{OSDs: 3, OSDSize: 2147483648},
+			expected: []string{"DEMO_DAEMONS=osd", "OSD_COUNT=3", "BLUESTORE_BLOCK_SIZE=2147483648"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := strings.Join(tt.config.ContainerEnv(), "\n") + "\n"
+			for _, expected := range tt.expected {
+				if !strings.Contains(env, expected+"\n") {
+					t.Errorf("expected the environment to contain %s, got\n%s", expected, env)
+				}
+			}
+			if tt.config.OSDSize == 0 && strings.Contains(env, "BLUESTORE_BLOCK_SIZE") {
+				t.Errorf("expected the default OSD size of the image, got\n%s", env)
+			}
+		})
+	}
+}
+
+func TestGetCSIScript(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    Config
+		expected  []string
+		annotates bool
+	}{
+		{
+			name:     "RBD StorageClass",
+			config:   Config{RBDPool: "rbd"},
+			expected: []string{"  admin: a2V5\n", "  name: csi-rbd\n", "  monitors: 192.168.66.2\n", "  pool: rbd\n"},
+		},
+		{
+			name:      "default StorageClass",
+			config:    Config{RBDPool: "volumes", DefaultStorageClass: true},
+			expected:  []string{"    storageclass.kubernetes.io/is-default-class: \"true\"\n", "  pool: volumes\n"},
+			annotates: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := tt.config.GetCSIScript("a2V5")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(script, expected) {
+					t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+				}
+			}
+			if annotates := strings.Contains(script, "kubectl annotate"); annotates != tt.annotates {
+				t.Errorf("expected the other StorageClasses to be annotated: %t, got\n%s", tt.annotates, script)
+			}
+		})
+	}
+}
+
+// TestCephFSManifestFiles fails if cephfs_manifests.go was not generated again after a change of the manifests
+func TestCephFSManifestFiles(t *testing.T) {
+	dir := filepath.Join("..", "..", "..", "manifests")
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("the manifests of cluster-provision are not available: %v", err)
+	}
+
+	if len(cephfsManifests) != len(cephfsManifestFiles) {
+		t.Errorf("expected all %d generated manifests to be applied, got %d", len(cephfsManifestFiles), len(cephfsManifests))
+	}
+	for _, file := range cephfsManifests {
+		content, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimRight(string(content), "\n") != strings.TrimRight(cephfsManifestFiles[file], "\n") {
+			t.Errorf("the manifest %s differs from cluster-provision/manifests, run go generate ./cmd/ceph/", file)
+		}
+	}
+}
+
+func TestGetCephFSScript(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []string
+		empty    bool
+	}{
+		{name: "CephFS disabled", config: Config{}, empty: true},
+		{
+			name:   "CephFS StorageClass",
+			config: Config{CephFS: "shared"},
+			expected: []string{
+				"kubectl apply -f /tmp/gocli-cephfs/cephfs-secret.yaml\n",
+				"kubectl apply -f /tmp/gocli-cephfs/cephfs-storageclass.yaml\n",
+				"  adminKey: a2V5\n",
+				"  name: csi-cephfs\n",
+				"provisioner: csi-cephfsplugin\n",
+				"  pool: shared_data\n",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := tt.config.GetCephFSScript("a2V5")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.empty {
+				if script != "" {
+					t.Errorf("expected no script, got\n%s", script)
+				}
+				return
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(script, expected) {
+					t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+				}
+			}
+			last := -1
+			for _, file := range cephfsManifests {
+				path := cephfsManifestsDir + "/" + filepath.Base(file)
+				written := strings.Index(script, "cat <<'EOT' >"+path+"\n"+strings.TrimRight(cephfsManifestFiles[file], "\n")+"\nEOT\n")
+				if written == -1 {
+					t.Errorf("expected the script to write %s", path)
+				}
+				applied := strings.Index(script, "kubectl apply -f "+path+"\n")
+				if applied < written || applied < last {
+					t.Errorf("expected %s to be applied after it was written and in order", path)
+				}
+				last = applied
+			}
+		})
+	}
+}
+
+func TestCheckOSDSizes(t *testing.T) {
+	df := `{"nodes":[{"id":0,"kb":10475520},{"id":1,"kb":10475520}],"summary":{}}`
+
+	tests := []struct {
+		name   string
+		df     string
+		config Config
+		fails  bool
+	}{
+		{name: "default size", df: df, config: Config{OSDs: 2}},
+		{name: "requested size", df: df, config: Config{OSDs: 2, OSDSize: 10 * 1024 * 1024 * 1024}},
+		{name: "missing OSD", df: df, config: Config{OSDs: 3}, fails: true},
+		{name: "ignored size", df: df, config: Config{OSDs: 2, OSDSize: 20 * 1024 * 1024 * 1024}, fails: true},
+		{name: "invalid output", df: "HEALTH_OK", config: Config{OSDs: 1}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOSDSizes([]byte(tt.df), &tt.config)
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package ceph
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// osdMap contains the OSD counters of ceph status, Luminous nests them in a second osdmap object
+type osdMap struct {
+	NumOSDs   int     `json:"num_osds"`
+	NumUpOSDs int     `json:"num_up_osds"`
+	NumInOSDs int     `json:"num_in_osds"`
+	OSDMap    *osdMap `json:"osdmap"`
+}
+
+// Status contains the fields of ceph status -f json which decide whether the cluster is usable
+type Status struct {
+	Health struct {
+		Status        string `json:"status"`
+		OverallStatus string `json:"overall_status"`
+	} `json:"health"`
+	OSDMap osdMap `json:"osdmap"`
+	PGMap  struct {
+		NumPGs     int `json:"num_pgs"`
+		PGsByState []struct {
+			StateName string `json:"state_name"`
+			Count     int    `json:"count"`
+		} `json:"pgs_by_state"`
+	} `json:"pgmap"`
+	FSMap struct {
+		Up int `json:"up"`
+	} `json:"fsmap"`
+}
+
+// HealthStatus returns HEALTH_OK, HEALTH_WARN or HEALTH_ERR
+func (s *Status) HealthStatus() string {
+	if s.Health.Status != "" {
+		return s.Health.Status
+	}
+	return s.Health.OverallStatus
+}
+
+// OSDs returns the number of OSDs which are up and in
+func (s *Status) OSDs() int {
+	osds := &s.OSDMap
+	if osds.OSDMap != nil {
+		osds = osds.OSDMap
+	}
+	if osds.NumUpOSDs < osds.NumInOSDs {
+		return osds.NumUpOSDs
+	}
+	return osds.NumInOSDs
+}
+
+// ActivePGs returns the number of placement groups which can serve IO
+func (s *Status) ActivePGs() int {
+	active := 0
+	for _, state := range s.PGMap.PGsByState {
+		if strings.Contains(state.StateName, "active") {
+			active += state.Count
+		}
+	}
+	return active
+}
+
+// Ready returns nil if the cluster has all OSDs of the config up, all placement groups active
+// and an MDS if CephFS is enabled, otherwise an error describing what is missing
+func (s *Status) Ready(config *Config) error {
+	if s.HealthStatus() == "HEALTH_ERR" {
+		return fmt.Errorf("the health is %s", s.HealthStatus())
+	}
+	if s.OSDs() < int(config.OSDs) {
+		return fmt.Errorf("%d of %d OSDs are up", s.OSDs(), config.OSDs)
+	}
+	if s.ActivePGs() < s.PGMap.NumPGs {
+		return fmt.Errorf("%d of %d placement groups are active", s.ActivePGs(), s.PGMap.NumPGs)
+	}
+	if config.CephFS != "" && s.FSMap.Up == 0 {
+		return fmt.Errorf("no MDS is up")
+	}
+	return nil
+}
+
+// GetStatus returns the status of the Ceph cluster running in the container
+func GetStatus(cli *client.Client, container string) (*Status, error) {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, container, []string{"ceph", "status", "-f", "json"}, stdout, stderr)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("ceph status failed: %s", strings.TrimSpace(stderr.String()))
+	}
+
+	status := &Status{}
+	if err := json.Unmarshal(stdout.Bytes(), status); err != nil {
+		return nil, fmt.Errorf("failed to parse the Ceph status: %v", err)
+	}
+	return status, nil
+}
+
+// WaitForHealth polls the status of the Ceph cluster until it is ready or the timeout of the config expires
+func WaitForHealth(cli *client.Client, container string, config *Config, out io.Writer) error {
+	deadline := time.Now().Add(config.Timeout)
+	last := ""
+	for {
+		var reason error
+		status, err := GetStatus(cli, container)
+		if err != nil {
+			reason = err
+		} else {
+			reason = status.Ready(config)
+		}
+		if reason == nil {
+			fmt.Fprintf(out, "Ceph is ready, the health is %s\n", status.HealthStatus())
+			return nil
+		}
+
+		if reason.Error() != last {
+			fmt.Fprintf(out, "Waiting for Ceph: %v\n", reason)
+			last = reason.Error()
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Ceph did not become ready within %s: %v", config.Timeout, reason)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// VerifyImage returns an error if the scripts of the Ceph image do not read the environment variables
+// which ContainerEnv sets for more than one OSD or for the OSD size, older ceph/daemon images ignore them
+func VerifyImage(cli *client.Client, container string, config *Config) error {
+	settings := map[string]string{}
+	if config.OSDs > 1 {
+		settings["OSD_COUNT"] = "--ceph-osds"
+	}
+	if config.OSDSize > 0 {
+		settings["BLUESTORE_BLOCK_SIZE"] = "--ceph-osd-size"
+	}
+	for variable, flag := range settings {
+		exitCode, err := docker.ExecStreams(cli, container, []string{
+			"/bin/bash",
+			"-c",
+			fmt.Sprintf("grep -rqsw %s /opt/ceph-container/bin /entrypoint.sh /*.sh", variable),
+		}, ioutil.Discard, ioutil.Discard)
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("the Ceph image does not support %s which %s needs, choose a newer ceph/daemon image with --ceph-image", variable, flag)
+		}
+	}
+	return nil
+}
+
+// osdDF contains the fields of ceph osd df -f json which VerifyOSDs checks
+type osdDF struct {
+	Nodes []struct {
+		ID int   `json:"id"`
+		KB int64 `json:"kb"`
+	} `json:"nodes"`
+}
+
+// checkOSDSizes returns an error if an OSD of ceph osd df -f json is more than ten percent smaller than the OSD size
+// of the config, the block file is a bit larger than the space which Ceph reports
+func checkOSDSizes(df []byte, config *Config) error {
+	osds := &osdDF{}
+	if err := json.Unmarshal(df, osds); err != nil {
+		return fmt.Errorf("failed to parse the Ceph OSD usage: %v", err)
+	}
+	if len(osds.Nodes) < int(config.OSDs) {
+		return fmt.Errorf("expected %d Ceph OSDs, got %d", config.OSDs, len(osds.Nodes))
+	}
+	if config.OSDSize == 0 {
+		return nil
+	}
+	for _, osd := range osds.Nodes {
+		if osd.KB*1024 < config.OSDSize/10*9 {
+			return fmt.Errorf("the Ceph OSD %d has %d bytes instead of %d, the Ceph image ignores BLUESTORE_BLOCK_SIZE", osd.ID, osd.KB*1024, config.OSDSize)
+		}
+	}
+	return nil
+}
+
+// VerifyOSDs returns an error if the Ceph cluster in the container does not have the number and the size of OSDs of the config
+func VerifyOSDs(cli *client.Client, container string, config *Config) error {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, container, []string{"ceph", "osd", "df", "-f", "json"}, stdout, stderr)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("ceph osd df failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return checkOSDSizes(stdout.Bytes(), config)
+}
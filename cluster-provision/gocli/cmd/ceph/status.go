@@ -0,0 +1,57 @@
+package ceph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewStatusCommand returns command to show the status of the Ceph cluster
+func NewStatusCommand() *cobra.Command {
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "status shows the health, the OSDs, the pools and the filesystems of the Ceph cluster",
+		RunE:  status,
+		Args:  cobra.NoArgs,
+	}
+	return status
+}
+
+func status(cmd *cobra.Command, _ []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	container := prefix + "-ceph"
+	containers, err := docker.GetPrefixedContainers(cli, container)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("failed to find the Ceph container %s, was the cluster started with --enable-ceph?", container)
+	}
+
+	for _, args := range [][]string{
+		{"ceph", "status"},
+		{"ceph", "osd", "pool", "ls", "detail"},
+		{"ceph", "fs", "ls"},
+	} {
+		success, err := docker.Exec(cli, container, args, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("%s failed", strings.Join(args, " "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"github.com/docker/go-connections/nat"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewDoctorCommand returns command to check the host prerequisites of a cluster
+func NewDoctorCommand() *cobra.Command {
+
+	doctor := &cobra.Command{
+		Use:   "doctor",
+		Short: "doctor checks that the host can run a cluster and explains how to fix it",
+		Long: `doctor checks that the host can run a cluster and explains how to fix it
+
+The checks cover the docker daemon and its API version, /dev/kvm and nested
+virtualization, the memory of the host for the nodes, the SELinux label of the
+registry volume and the explicit localhost ports. run and run okd do the same
+checks before they create any container. doctor exits non-zero if a check
+failed, a warning like disabled nested virtualization does not stop a cluster.
+`,
+		RunE: doctor,
+		Args: cobra.NoArgs,
+	}
+
+	doctor.Flags().UintP("nodes", "n", 1, "number of cluster nodes which should fit into the memory of the host")
+	doctor.Flags().StringP("memory", "m", "3096M", "amount of ram per node")
+	doctor.Flags().String("registry-volume", "", "volume which caches the docker registry content")
+	doctor.Flags().Uint("vnc-port", 0, "port on localhost for vnc")
+	doctor.Flags().Uint("registry-port", 0, "port on localhost for the docker registry")
+	doctor.Flags().Uint("ocp-port", 0, "port on localhost for the ocp cluster")
+	doctor.Flags().Uint("k8s-port", 0, "port on localhost for the k8s cluster")
+	doctor.Flags().Uint("ssh-port", 0, "port on localhost for ssh server")
+
+	return doctor
+}
+
+func doctor(cmd *cobra.Command, _ []string) error {
+
+	nodes, err := cmd.Flags().GetUint("nodes")
+	if err != nil {
+		return err
+	}
+
+	memory, err := cmd.Flags().GetString("memory")
+	if err != nil {
+		return err
+	}
+
+	registryVol, err := cmd.Flags().GetString("registry-volume")
+	if err != nil {
+		return err
+	}
+
+	portMap := nat.PortMap{}
+
+	utils.AppendIfExplicit(portMap, utils.PortSSH, cmd.Flags(), "ssh-port")
+	utils.AppendIfExplicit(portMap, utils.PortVNC, cmd.Flags(), "vnc-port")
+	utils.AppendIfExplicit(portMap, utils.PortAPI, cmd.Flags(), "k8s-port")
+	utils.AppendIfExplicit(portMap, utils.PortOCP, cmd.Flags(), "ocp-port")
+	utils.AppendIfExplicit(portMap, utils.PortRegistry, cmd.Flags(), "registry-port")
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	checks := utils.Preflight(context.Background(), cli, utils.PreflightOptions{
+		Nodes:          nodes,
+		Memory:         memory,
+		RegistryVolume: registryVol,
+		Ports:          portMap,
+	})
+	utils.PrintChecks(cmd.OutOrStdout(), checks, true)
+	return utils.CheckError(checks)
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/providers"
+)
+
+// NewDownCommand returns command to stop a cluster started by up
+func NewDownCommand() *cobra.Command {
+
+	down := &cobra.Command{
+		Use:   "down [provider]",
+		Short: "down deletes the cluster and the configs which up wrote for the provider",
+		Long: `down deletes the cluster and the configs which up wrote for the provider
+
+The cluster is removed like by rm. If the provider is given, its directory
+in the config path with the kubeconfig and config-provider-<provider>.sh
+is removed too.
+`,
+		RunE: down,
+		Args: cobra.MaximumNArgs(1),
+	}
+
+	down.Flags().String("config-path", "", fmt.Sprintf("directory in which up wrote the configs of the provider, defaults to %s or _ci-configs", providers.ConfigPathEnv))
+	down.Flags().Bool("purge", false, "also remove the shared volumes of the cluster which are not used by other clusters")
+
+	return down
+}
+
+func down(cmd *cobra.Command, args []string) error {
+
+	configPath, err := cmd.Flags().GetString("config-path")
+	if err != nil {
+		return err
+	}
+
+	if err := rm(cmd, nil); err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+	return os.RemoveAll(providers.ConfigDir(configPath, args[0]))
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/providers"
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewEnvCommand returns command to print the connection details of a cluster
+func NewEnvCommand() *cobra.Command {
+
+	env := &cobra.Command{
+		Use:   "env",
+		Short: "env prints the connection details of the cluster, like config-provider-<provider>.sh",
+		Long: `env prints the connection details of the cluster, like config-provider-<provider>.sh
+
+The values are computed from the labels and the published ports of the running
+cluster, so they are never stale. The provider is found in the catalog by the
+cluster image, --provider overrides it. The paths of the kubeconfig and the
+client are the ones which up writes for the provider, env fails if they are
+missing, like for a cluster started with run.
+
+gocli is the executable, unless gocli runs in a container like via
+cluster-up/cli.sh, then --gocli must name the command on the host and
+--config-path a directory which is mounted at the same path from the host.
+
+  eval $(gocli env --prefix k8s-1.13.3)
+  gocli env --format json
+  gocli env --format dotenv >.env
+`,
+		RunE: env,
+		Args: cobra.NoArgs,
+	}
+
+	env.Flags().String("format", providers.FormatSh, "output format: sh, json or dotenv")
+	env.Flags().String("provider", "", "name of the provider, by default it is found in the catalog by the cluster image")
+	env.Flags().String("catalog", "", fmt.Sprintf("provider catalog file which replaces the embedded one, can also be set via %s", providers.CatalogEnv))
+	env.Flags().String("config-path", "", fmt.Sprintf("directory in which up wrote the configs of the provider, defaults to %s or _ci-configs", providers.ConfigPathEnv))
+	env.Flags().String("gocli", "", "command which runs gocli on the host, like cluster-up/cli.sh, by default the executable")
+
+	return env
+}
+
+func env(cmd *cobra.Command, _ []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	if err := providers.ValidateFormat(format); err != nil {
+		return err
+	}
+
+	provider, err := cmd.Flags().GetString("provider")
+	if err != nil {
+		return err
+	}
+
+	catalogPath, err := cmd.Flags().GetString("catalog")
+	if err != nil {
+		return err
+	}
+
+	configPath, err := cmd.Flags().GetString("config-path")
+	if err != nil {
+		return err
+	}
+
+	gocli, err := cmd.Flags().GetString("gocli")
+	if err != nil {
+		return err
+	}
+
+	gocli, err = hostGocli(gocli)
+	if err != nil {
+		return err
+	}
+
+	if err := checkHostConfigPath(configPath); err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	config, err := providerConfig(cli, prefix, configPath, catalogPath, provider, gocli)
+	if err != nil {
+		return err
+	}
+	return config.Write(cmd.OutOrStdout(), format)
+}
+
+// containerEnvFile exists if gocli runs in a docker container
+var containerEnvFile = "/.dockerenv"
+
+// hostGocli returns the command which runs gocli on the host, by default the executable,
+// which is a path in the container if gocli runs in a container, like via cluster-up/cli.sh
+func hostGocli(gocli string) (string, error) {
+	if gocli != "" {
+		return gocli, nil
+	}
+	if _, err := os.Stat(containerEnvFile); err == nil {
+		return "", fmt.Errorf("gocli runs in a container, pass the command which runs it on the host via --gocli, like cluster-up/cli.sh")
+	}
+	return os.Executable()
+}
+
+// checkHostConfigPath returns an error if gocli runs in a container and the config path is neither given
+// via the flag nor via ConfigPathEnv, the default _ci-configs would be a directory of the container.
+// The paths in the configs are the ones of the container, so the directory has to be mounted at the same path.
+func checkHostConfigPath(configPath string) error {
+	if configPath != "" || os.Getenv(providers.ConfigPathEnv) != "" {
+		return nil
+	}
+	if _, err := os.Stat(containerEnvFile); err == nil {
+		return fmt.Errorf("gocli runs in a container, pass a directory which is mounted at the same path from the host via --config-path or %s", providers.ConfigPathEnv)
+	}
+	return nil
+}
+
+// providerConfig computes the connection details of the running cluster with the prefix from the labels
+// and the published ports of its container. An empty provider is found in the catalog by the cluster image,
+// clusters of images which are not in the catalog use the prefix as provider name.
+// It only reads, the kubeconfig and the client have to be in the config directory already.
+func providerConfig(cli *client.Client, prefix string, configPath string, catalogPath string, name string, gocli string) (*providers.Config, error) {
+	cluster, err := docker.GetClusterContainer(cli, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := providers.LoadCatalog(catalogPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "" {
+		image := cluster.Labels[docker.ClusterImageLabel]
+		if image == "" {
+			image = cluster.Image
+		}
+		name = prefix
+		if p, err := catalog.LookupImage(image); err == nil {
+			name = p.Name
+		}
+	}
+
+	registryPort, err := utils.GetPublicPort(utils.PortRegistry, cluster.Ports)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := providers.NewConfig(configPath, name, gocli, registryPort)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range []string{config.Kubeconfig, config.Kubectl} {
+		if err := checkConfigFile(path, prefix, name); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// checkConfigFile returns an error with a remedy if the file which up writes for the provider is missing
+func checkConfigFile(path string, prefix string, provider string) error {
+	_, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s of the cluster %s is missing, start the cluster with gocli up %s or pass the --config-path to which up wrote the configs", path, prefix, provider)
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/providers"
+)
+
+func TestHostGocli(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	envFile := containerEnvFile
+	defer func() {
+		containerEnvFile = envFile
+	}()
+
+	tests := []struct {
+		name      string
+		gocli     string
+		container bool
+		expected  string
+		fails     bool
+	}{
+		{name: "executable", expected: executable},
+		{name: "command of the flag", gocli: "cluster-up/cli.sh", expected: "cluster-up/cli.sh"},
+		{name: "command of the flag in a container", gocli: "cluster-up/cli.sh", container: true, expected: "cluster-up/cli.sh"},
+		{name: "executable in a container", container: true, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containerEnvFile = filepath.Join(dir, "missing")
+			if tt.container {
+				containerEnvFile = filepath.Join(dir, ".dockerenv")
+				if err := ioutil.WriteFile(containerEnvFile, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			gocli, err := hostGocli(tt.gocli)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", gocli)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if gocli != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, gocli)
+			}
+		})
+	}
+}
+
+func TestCheckHostConfigPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	envFile := containerEnvFile
+	defer func() {
+		containerEnvFile = envFile
+	}()
+	configPathEnv, configPathSet := os.LookupEnv(providers.ConfigPathEnv)
+	defer func() {
+		if configPathSet {
+			os.Setenv(providers.ConfigPathEnv, configPathEnv)
+		} else {
+			os.Unsetenv(providers.ConfigPathEnv)
+		}
+	}()
+
+	tests := []struct {
+		name       string
+		configPath string
+		env        string
+		container  bool
+		fails      bool
+	}{
+		{name: "default on the host"},
+		{name: "default in a container", container: true, fails: true},
+		{name: "flag in a container", configPath: "/home/user/kubevirtci/_ci-configs", container: true},
+		{name: "environment in a container", env: "/home/user/kubevirtci/_ci-configs", container: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			containerEnvFile = filepath.Join(dir, "missing")
+			if tt.container {
+				containerEnvFile = filepath.Join(dir, ".dockerenv")
+				if err := ioutil.WriteFile(containerEnvFile, nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			os.Setenv(providers.ConfigPathEnv, tt.env)
+
+			err := checkHostConfigPath(tt.configPath)
+			if tt.fails && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kubeconfig := filepath.Join(dir, ".kubeconfig")
+	if err := ioutil.WriteFile(kubeconfig, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkConfigFile(kubeconfig, "k8s-1.13.3", "k8s-1.13.3"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	kubectl := filepath.Join(dir, ".kubectl")
+	err = checkConfigFile(kubectl, "k8s-1.13.3", "k8s-1.13.3")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, expected := range []string{kubectl, "gocli up k8s-1.13.3", "--config-path"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected the error to contain %s, got %v", expected, err)
+		}
+	}
+	if _, err := os.Stat(kubectl); !os.IsNotExist(err) {
+		t.Errorf("expected %s not to be written, got %v", kubectl, err)
+	}
+}
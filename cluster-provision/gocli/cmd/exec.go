@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewExecCommand returns command to run a command on several nodes at once
+func NewExecCommand() *cobra.Command {
+
+	exec := &cobra.Command{
+		Use:   "exec [--nodes node01,node02|--all] -- command",
+		Short: "exec runs a command via SSH on the selected nodes at the same time",
+		Long: `exec runs a command via SSH on the selected nodes at the same time
+
+The output of every node is prefixed with its name. After all nodes finished,
+the exit code of every node is printed, exec fails if the command failed on any node.
+`,
+		RunE: execNodes,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	exec.Flags().StringSlice("nodes", nil, "nodes to run the command on, like node01,node03")
+	exec.Flags().Bool("all", false, "run the command on all nodes of the cluster")
+
+	return exec
+}
+
+func execNodes(cmd *cobra.Command, args []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	nodes, err := cmd.Flags().GetStringSlice("nodes")
+	if err != nil {
+		return err
+	}
+
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+
+	if all == (len(nodes) > 0) {
+		return fmt.Errorf("either --nodes or --all has to be set")
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.GetPrefixedContainers(cli, prefix+"-node")
+	if err != nil {
+		return err
+	}
+	running := map[string]bool{}
+	for _, c := range containers {
+		if !strings.HasPrefix(c.Names[0], "/"+prefix+"-node") {
+			continue
+		}
+		if c.State == "running" {
+			running[strings.TrimPrefix(c.Names[0], "/"+prefix+"-")] = true
+		}
+	}
+
+	if all {
+		for name := range running {
+			nodes = append(nodes, name)
+		}
+		if len(nodes) == 0 {
+			return fmt.Errorf("failed to find running nodes with the prefix %s", prefix)
+		}
+	}
+	for _, node := range nodes {
+		if !running[node] {
+			return fmt.Errorf("the node %s of the cluster %s is not running", node, prefix)
+		}
+	}
+	sort.Strings(nodes)
+
+	logger, err := utils.NewProvisionLogger("", cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	exitCodes := make([]int, len(nodes))
+	errs := make([]error, len(nodes))
+	wg := sync.WaitGroup{}
+	for i, node := range nodes {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			streams, err := logger.Streams(node, "exec")
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer streams.Close()
+			exitCodes[i], errs[i] = docker.ExecStreams(cli, nodeContainer(prefix, node), append([]string{"ssh.sh"}, args...), streams.Stdout, streams.Stderr)
+		}(i, node)
+	}
+	wg.Wait()
+
+	failed := 0
+	fmt.Fprintln(cmd.OutOrStdout())
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tEXIT CODE")
+	for i, node := range nodes {
+		switch {
+		case errs[i] != nil:
+			failed++
+			fmt.Fprintf(w, "%s\t%v\n", node, errs[i])
+		case exitCodes[i] != 0:
+			failed++
+			fmt.Fprintf(w, "%s\t%d\n", node, exitCodes[i])
+		default:
+			fmt.Fprintf(w, "%s\t0\n", node)
+		}
+	}
+	w.Flush()
+
+	if failed > 0 {
+		return fmt.Errorf("the command failed on %d of %d nodes", failed, len(nodes))
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewLockCommand returns command to record the image digests of a cluster in a lockfile
+func NewLockCommand() *cobra.Command {
+
+	lock := &cobra.Command{
+		Use:   "lock",
+		Short: "lock records the exact image digests used by a cluster in a lockfile",
+		Long: `lock records the exact image digests used by a cluster in a lockfile
+
+The lockfile contains the cluster image and all sidecar images of the running cluster.
+It can be passed to 'run --images-config' to start a cluster with exactly the same images.
+`,
+		RunE: lock,
+		Args: cobra.NoArgs,
+	}
+
+	lock.Flags().StringP("output", "o", "gocli.lock", "path of the lockfile, use - to print it")
+
+	return lock
+}
+
+func lock(cmd *cobra.Command, _ []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	config := &utils.ImagesConfig{}
+
+	// The k8s clusters run the cluster image in the dnsmasq container, OKD clusters in the cluster container
+	for _, name := range []string{"dnsmasq", "cluster"} {
+		image, err := lockedImage(ctx, cli, prefix+"-"+name)
+		if err != nil {
+			return err
+		}
+		if image != "" {
+			config.Cluster = image
+			break
+		}
+	}
+	if config.Cluster == "" {
+		return fmt.Errorf("failed to find a cluster with the prefix %s", prefix)
+	}
+
+	for _, sidecar := range []struct {
+		image     *string
+		container string
+	}{
+		{&config.Sidecars.DockerRegistry, "registry"},
+		{&config.Sidecars.NFSGanesha, "nfs-ganesha"},
+		{&config.Sidecars.Ceph, "ceph"},
+		{&config.Sidecars.Fluentd, "fluentd"},
+	} {
+		*sidecar.image, err = lockedImage(ctx, cli, prefix+"-"+sidecar.container)
+		if err != nil {
+			return err
+		}
+	}
+
+	if output == "-" {
+		return utils.PrintImagesConfig(cmd.OutOrStdout(), config)
+	}
+	return utils.WriteImagesConfig(output, config)
+}
+
+// lockedImage returns the digest reference of the image of the container, or an empty string if the container does not exist
+func lockedImage(ctx context.Context, cli *client.Client, containerName string) (string, error) {
+	containers, err := docker.GetPrefixedContainers(cli, containerName)
+	if err != nil {
+		return "", err
+	}
+
+	var container string
+	for _, c := range containers {
+		for _, name := range c.Names {
+			if strings.TrimPrefix(name, "/") == containerName {
+				container = c.ID
+			}
+		}
+	}
+	if container == "" {
+		return "", nil
+	}
+
+	containerJSON, err := cli.ContainerInspect(ctx, container)
+	if err != nil {
+		return "", err
+	}
+
+	image, _, err := cli.ImageInspectWithRaw(ctx, containerJSON.Image)
+	if err != nil {
+		return "", err
+	}
+
+	if len(image.RepoDigests) == 0 {
+		return "", fmt.Errorf("the image %s of the container %s has no registry digest, push it to a registry before locking it", containerJSON.Config.Image, containerName)
+	}
+
+	// Prefer the digest of the repository the container was started from
+	repository := repositoryOf(containerJSON.Config.Image)
+	for _, digest := range image.RepoDigests {
+		if strings.HasSuffix(repositoryOf(digest), repository) {
+			return digest, nil
+		}
+	}
+	return image.RepoDigests[0], nil
+}
+
+// repositoryOf strips the tag and the digest from the image reference
+func repositoryOf(ref string) string {
+	ref = strings.SplitN(ref, "@", 2)[0]
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		ref = ref[:i]
+	}
+	return ref
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// manifestsDir contains the manifests passed via --manifest on node01
+const manifestsDir = "/tmp/gocli-manifests"
+
+// appliedObject is an object which was created or updated by kubectl apply
+type appliedObject struct {
+	kind      string
+	namespace string
+	name      string
+}
+
+func (o appliedObject) String() string {
+	if o.namespace == "" {
+		return fmt.Sprintf("%s/%s", strings.ToLower(o.kind), o.name)
+	}
+	return fmt.Sprintf("%s/%s in namespace %s", strings.ToLower(o.kind), o.name, o.namespace)
+}
+
+// appliedObjectColumns prints the kind, namespace and name of the objects of a manifest with kubectl get
+const appliedObjectColumns = "KIND:.kind,NAMESPACE:.metadata.namespace,NAME:.metadata.name"
+
+// parseAppliedObjects parses the output of kubectl get with appliedObjectColumns,
+// kubectl prints <none> for the namespace of cluster scoped objects
+func parseAppliedObjects(output string) []appliedObject {
+	objects := []appliedObject{}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		object := appliedObject{kind: fields[0], namespace: fields[1], name: fields[2]}
+		if object.namespace == "<none>" {
+			object.namespace = ""
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
+
+// resolveManifests returns the manifest files of the paths in the given order,
+// directories are expanded to the yaml and json files they contain in lexical order
+func resolveManifests(paths []string) ([]string, error) {
+	manifests := []string{}
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			manifests = append(manifests, path)
+			continue
+		}
+
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		names := []string{}
+		for _, f := range files {
+			switch filepath.Ext(f.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !f.IsDir() {
+					names = append(names, f.Name())
+				}
+			}
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("the manifest directory %s contains no yaml or json files", path)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			manifests = append(manifests, filepath.Join(path, name))
+		}
+	}
+	return manifests, nil
+}
+
+// applyManifests copies the manifests to the node, applies them in order and waits until
+// the Deployments, DaemonSets, StatefulSets and CRDs they contain are ready
+func applyManifests(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, manifests []string, timeout time.Duration) error {
+	streams, err := logger.Streams(nodeName, "manifests")
+	if err != nil {
+		return err
+	}
+	defer streams.Close()
+
+	container := nodeContainer(prefix, nodeName)
+	run := func(stdout io.Writer, script string) (bool, error) {
+		exitCode, err := docker.ExecStreams(cli, container, []string{"/bin/bash", "-c", script}, stdout, streams.Stderr)
+		return exitCode == 0, err
+	}
+
+	success, err := run(streams.Stdout, fmt.Sprintf("ssh.sh sudo mkdir -p %s && mkdir -p /scripts/manifests", manifestsDir))
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("preparing the manifest directory on node %s failed", nodeName)
+	}
+
+	objects := []appliedObject{}
+	for i, manifest := range manifests {
+		name := fmt.Sprintf("%02d-%s", i, filepath.Base(manifest))
+		fmt.Fprintf(streams.Stdout, "Apply the manifest %s\n", manifest)
+
+		if err := docker.CopyToContainer(context.Background(), cli, container, manifest, "/scripts/manifests/"+name); err != nil {
+			return fmt.Errorf("copying the manifest %s to node %s failed: %v", manifest, nodeName, err)
+		}
+		success, err := run(streams.Stdout, fmt.Sprintf("ssh.sh sudo tee %s/%s >/dev/null < /scripts/manifests/%s", manifestsDir, name, name))
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("copying the manifest %s to node %s failed", manifest, nodeName)
+		}
+
+		success, err = run(streams.Stdout, fmt.Sprintf(`ssh.sh sudo /bin/bash <<'EOF'
+kubectl --kubeconfig=/etc/kubernetes/admin.conf apply -f %s/%s
+EOF`, manifestsDir, name))
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("applying the manifest %s failed, see the errors of kubectl above", manifest)
+		}
+
+		// kubectl apply of the older images does not print the objects with -o, kubectl get -f does
+		applied := new(bytes.Buffer)
+		success, err = run(applied, fmt.Sprintf(`ssh.sh sudo /bin/bash <<'EOF'
+kubectl --kubeconfig=/etc/kubernetes/admin.conf get -f %s/%s --no-headers -o custom-columns=%s
+EOF`, manifestsDir, name, appliedObjectColumns))
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("listing the objects of the manifest %s failed, see the errors of kubectl above", manifest)
+		}
+		objects = append(objects, parseAppliedObjects(applied.String())...)
+	}
+
+	failed := []string{}
+	for _, object := range objects {
+		var wait string
+		switch object.kind {
+		case "Deployment", "DaemonSet", "StatefulSet":
+			wait = fmt.Sprintf("kubectl -n %s rollout status %s/%s", object.namespace, strings.ToLower(object.kind), object.name)
+		case "CustomResourceDefinition":
+			// kubectl wait came with kubectl 1.11, poll the condition for the older images
+			wait = fmt.Sprintf(`until kubectl get crd/%s -o jsonpath='{.status.conditions[?(@.type=="Established")].status}' | grep -q True; do sleep 2; done`, object.name)
+		default:
+			continue
+		}
+
+		fmt.Fprintf(streams.Stdout, "Wait for %s\n", object)
+		success, err := run(streams.Stdout, fmt.Sprintf(`ssh.sh sudo /bin/bash <<'EOF'
+export KUBECONFIG=/etc/kubernetes/admin.conf
+timeout %d /bin/bash -c %s
+EOF`, int(timeout.Seconds()), utils.ShellQuote(wait)))
+		if err != nil {
+			return err
+		}
+		if success {
+			continue
+		}
+
+		failed = append(failed, object.String())
+		fmt.Fprintf(streams.Stderr, "%s did not become ready within %s\n", object, timeout)
+		namespace := ""
+		if object.namespace != "" {
+			namespace = "-n " + object.namespace
+		}
+		run(streams.Stderr, fmt.Sprintf(`ssh.sh sudo /bin/bash <<'EOF'
+export KUBECONFIG=/etc/kubernetes/admin.conf
+kubectl %s describe %s/%s
+kubectl %s get events --field-selector involvedObject.name=%s
+kubectl %s get pods -o wide | grep %s
+EOF`, namespace, strings.ToLower(object.kind), object.name, namespace, object.name, namespace, object.name))
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("the manifests were applied, but these objects did not become ready: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseAppliedObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		objects []appliedObject
+	}{
+		{name: "no objects", output: "", objects: []appliedObject{}},
+		{
+			name:   "namespaced object",
+			output: "Deployment   kube-system   coredns\n",
+			objects: []appliedObject{
+				{kind: "Deployment", namespace: "kube-system", name: "coredns"},
+			},
+		},
+		{
+			name:   "cluster scoped object",
+			output: "CustomResourceDefinition   <none>   virtualmachines.kubevirt.io\n",
+			objects: []appliedObject{
+				{kind: "CustomResourceDefinition", name: "virtualmachines.kubevirt.io"},
+			},
+		},
+		{
+			name:   "objects of a list",
+			output: "Namespace   <none>   kubevirt\nServiceAccount   kubevirt   kubevirt-operator\nDaemonSet   kubevirt   virt-handler",
+			objects: []appliedObject{
+				{kind: "Namespace", name: "kubevirt"},
+				{kind: "ServiceAccount", namespace: "kubevirt", name: "kubevirt-operator"},
+				{kind: "DaemonSet", namespace: "kubevirt", name: "virt-handler"},
+			},
+		},
+		{
+			name:   "lines which are no objects",
+			output: "\nWarning: kubectl apply should be used on resources\nStatefulSet   default   web\n",
+			objects: []appliedObject{
+				{kind: "StatefulSet", namespace: "default", name: "web"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if objects := parseAppliedObjects(tt.output); !reflect.DeepEqual(objects, tt.objects) {
+				t.Errorf("expected %+v, got %+v", tt.objects, objects)
+			}
+		})
+	}
+}
+
+func TestAppliedObjectString(t *testing.T) {
+	tests := []struct {
+		object   appliedObject
+		expected string
+	}{
+		{object: appliedObject{kind: "Deployment", namespace: "kube-system", name: "coredns"}, expected: "deployment/coredns in namespace kube-system"},
+		{object: appliedObject{kind: "CustomResourceDefinition", name: "vms.kubevirt.io"}, expected: "customresourcedefinition/vms.kubevirt.io"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected, func(t *testing.T) {
+			if s := tt.object.String(); s != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, s)
+			}
+		})
+	}
+}
+
+func TestResolveManifests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"b.yaml", "a.json", "c.yml", "README.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		paths     []string
+		manifests []string
+		fails     bool
+	}{
+		{
+			name:      "directory in lexical order",
+			paths:     []string{dir},
+			manifests: []string{filepath.Join(dir, "a.json"), filepath.Join(dir, "b.yaml"), filepath.Join(dir, "c.yml")},
+		},
+		{
+			name:      "files in the given order",
+			paths:     []string{filepath.Join(dir, "c.yml"), filepath.Join(dir, "a.json")},
+			manifests: []string{filepath.Join(dir, "c.yml"), filepath.Join(dir, "a.json")},
+		},
+		{name: "directory without manifests", paths: []string{empty}, fails: true},
+		{name: "missing file", paths: []string{filepath.Join(dir, "missing.yaml")}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifests, err := resolveManifests(tt.paths)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", manifests)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(manifests, tt.manifests) {
+				t.Errorf("expected %v, got %v", tt.manifests, manifests)
+			}
+		})
+	}
+}
@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// nodeConsoleLog contains the serial console of the VM in the node container
+const nodeConsoleLog = "/var/log/vm-console.log"
+
+// okdKubeconfig contains the kubeconfig of the OKD cluster in the cluster container
+const okdKubeconfig = "/root/install/auth/kubeconfig"
+
+// gatherTask writes the output of a script, which runs in a container, or of a function to a file of the bundle
+type gatherTask struct {
+	path      string
+	container string
+	script    string
+	collect   func(stdout io.Writer, stderr io.Writer) error
+}
+
+// gatherResult contains the collected output of a task
+type gatherResult struct {
+	path   string
+	output []byte
+	failed string
+}
+
+// NewMustGatherCommand returns command to collect the diagnostics of a cluster into a bundle
+func NewMustGatherCommand() *cobra.Command {
+
+	mustGather := &cobra.Command{
+		Use:   "must-gather",
+		Short: "must-gather collects the logs and the state of the cluster into a tar.gz bundle",
+		Long: `must-gather collects the logs and the state of the cluster into a tar.gz bundle
+
+The bundle contains from every node the journal of kubelet, docker and CRI-O,
+dmesg and the console of the VM, the description of the nodes and the pods,
+the logs of the pods of every namespace and the logs of the containers of the
+cluster. Failed collections are listed in summary.txt of the bundle.
+`,
+		RunE: mustGather,
+		Args: cobra.NoArgs,
+	}
+
+	mustGather.Flags().String("dest", "must-gather.tar.gz", "path of the bundle to write")
+	mustGather.Flags().Uint("parallel", 8, "how many collections run at the same time")
+
+	return mustGather
+}
+
+func mustGather(cmd *cobra.Command, _ []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	dest, err := cmd.Flags().GetString("dest")
+	if err != nil {
+		return err
+	}
+
+	parallel, err := cmd.Flags().GetUint("parallel")
+	if err != nil {
+		return err
+	}
+	if parallel == 0 {
+		return fmt.Errorf("at least one collection has to run at a time")
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	err = gatherBundle(cli, prefix, out, parallel, cmd.OutOrStdout())
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// A truncated bundle must not be mistaken for a complete one
+		os.Remove(dest)
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "The bundle was written to %s\n", dest)
+	return nil
+}
+
+// gatherBundle collects the diagnostics of the cluster with the prefix as tar.gz into the writer
+func gatherBundle(cli *client.Client, prefix string, out io.Writer, parallel uint, progress io.Writer) error {
+	tasks, err := gatherTasks(cli, prefix, progress)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+	write := func(path string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    filepath.Join("must-gather", path),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: time.Now(),
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+
+	if err := runGatherTasks(cli, prefix, tasks, parallel, write, progress); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// gatherTasks returns the collections of the containers and, if node01 or the OKD cluster container runs, of the cluster
+func gatherTasks(cli *client.Client, prefix string, progress io.Writer) ([]gatherTask, error) {
+	containers, err := docker.GetPrefixedContainers(cli, prefix+"-")
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("failed to find a cluster with the prefix %s", prefix)
+	}
+
+	running := map[string]bool{}
+	tasks := []gatherTask{}
+	for _, c := range containers {
+		name := strings.TrimPrefix(c.Names[0], "/")
+		running[name] = c.State == "running"
+		tasks = append(tasks, gatherTask{
+			path: fmt.Sprintf("containers/%s.log", name),
+			collect: func(stdout io.Writer, stderr io.Writer) error {
+				return docker.ContainerLogs(cli, name, stdout, stdout)
+			},
+		})
+	}
+
+	var clusterTasks []gatherTask
+	if running[prefix+"-cluster"] {
+		clusterTasks, err = okdGatherTasks(cli, prefix+"-cluster")
+	} else if running[nodeContainer(prefix, nodeNameFromIndex(1))] {
+		clusterTasks, err = k8sGatherTasks(cli, prefix, running)
+	} else {
+		fmt.Fprintln(progress, "No running node found, only the container logs are collected")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return append(tasks, clusterTasks...), nil
+}
+
+// runGatherTasks runs the tasks in parallel and passes their output to write one after another,
+// at the end summary.txt lists the tasks which failed
+func runGatherTasks(cli *client.Client, prefix string, tasks []gatherTask, parallel uint, write func(path string, data []byte) error, progress io.Writer) error {
+	fmt.Fprintf(progress, "Collecting %d files\n", len(tasks))
+	results := make(chan gatherResult)
+	pending := make(chan gatherTask)
+	wg := sync.WaitGroup{}
+	for i := 0; i < int(parallel); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range pending {
+				results <- runGatherTask(cli, task)
+			}
+		}()
+	}
+	go func() {
+		for _, task := range tasks {
+			pending <- task
+		}
+		close(pending)
+		wg.Wait()
+		close(results)
+	}()
+
+	failed := []string{}
+	var writeErr error
+	for result := range results {
+		if result.failed != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", result.path, result.failed))
+		}
+		if writeErr == nil {
+			writeErr = write(result.path, result.output)
+		}
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	sort.Strings(failed)
+	summary := new(bytes.Buffer)
+	fmt.Fprintf(summary, "Collected %d files of the cluster %s at %s\n", len(tasks), prefix, time.Now().UTC().Format(time.RFC3339))
+	if len(failed) > 0 {
+		fmt.Fprintf(summary, "\n%d collections failed:\n%s\n", len(failed), strings.Join(failed, "\n"))
+		fmt.Fprintf(progress, "%d collections failed, see summary.txt\n", len(failed))
+	}
+	return write("summary.txt", summary.Bytes())
+}
+
+// runGatherTask runs the task, the stderr of failed scripts is kept in the file after the output
+func runGatherTask(cli *client.Client, task gatherTask) gatherResult {
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	result := gatherResult{path: task.path}
+
+	if task.collect != nil {
+		if err := task.collect(stdout, stderr); err != nil {
+			result.failed = err.Error()
+		}
+	} else {
+		exitCode, err := docker.ExecStreams(cli, task.container, []string{"/bin/bash", "-c", task.script}, stdout, stderr)
+		if err != nil {
+			result.failed = err.Error()
+		} else if exitCode != 0 {
+			result.failed = fmt.Sprintf("exit code %d", exitCode)
+		}
+	}
+
+	if result.failed != "" && stderr.Len() > 0 {
+		fmt.Fprintf(stdout, "\n--- stderr ---\n%s", stderr.Bytes())
+	}
+	result.output = stdout.Bytes()
+	return result
+}
+
+// k8sGatherTasks returns the collections of the nodes and of the cluster, kubectl runs on node01
+func k8sGatherTasks(cli *client.Client, prefix string, running map[string]bool) ([]gatherTask, error) {
+	node01 := nodeContainer(prefix, nodeNameFromIndex(1))
+	wrap := func(script string) string {
+		return fmt.Sprintf(`ssh.sh sudo /bin/bash <<'EOF'
+export KUBECONFIG=/etc/kubernetes/admin.conf
+%s
+EOF`, script)
+	}
+	kubectl := func(path string, script string) gatherTask {
+		return gatherTask{path: path, container: node01, script: wrap(script)}
+	}
+
+	tasks := []gatherTask{}
+	for x := 1; running[nodeContainer(prefix, nodeNameFromIndex(x))]; x++ {
+		nodeName := nodeNameFromIndex(x)
+		container := nodeContainer(prefix, nodeName)
+		for _, unit := range []string{"kubelet", "docker", "crio"} {
+			tasks = append(tasks, gatherTask{
+				path:      fmt.Sprintf("nodes/%s/journal-%s.log", nodeName, unit),
+				container: container,
+				script:    fmt.Sprintf("ssh.sh sudo journalctl --no-pager -u %s", unit),
+			})
+		}
+		tasks = append(tasks,
+			gatherTask{path: fmt.Sprintf("nodes/%s/journal.log", nodeName), container: container, script: "ssh.sh sudo journalctl --no-pager -b"},
+			gatherTask{path: fmt.Sprintf("nodes/%s/dmesg.log", nodeName), container: container, script: "ssh.sh sudo dmesg -T"},
+			gatherTask{path: fmt.Sprintf("nodes/%s/console.log", nodeName), container: container, script: "cat " + nodeConsoleLog},
+			gatherTask{path: fmt.Sprintf("nodes/%s/screen.ppm", nodeName), container: container, script: screendumpScript(x)},
+		)
+	}
+
+	tasks = append(tasks,
+		kubectl("cluster/nodes.txt", "kubectl get nodes -o wide && kubectl describe nodes"),
+		kubectl("cluster/pods.txt", "kubectl get pods --all-namespaces -o wide && kubectl describe pods --all-namespaces"),
+		kubectl("cluster/events.txt", "kubectl get events --all-namespaces --sort-by=.lastTimestamp"),
+	)
+
+	pods, err := listPods(cli, node01, wrap)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		tasks = append(tasks, kubectl(fmt.Sprintf("pods/%s/%s.log", pod[0], pod[1]), podLogsScript(pod[0], pod[1])))
+	}
+	return tasks, nil
+}
+
+// okdGatherTasks returns the collections of the nodes and of the cluster, oc runs in the cluster container
+func okdGatherTasks(cli *client.Client, container string) ([]gatherTask, error) {
+	wrap := func(script string) string {
+		return fmt.Sprintf(`export KUBECONFIG=%s
+kubectl() { oc "$@"; }
+%s`, okdKubeconfig, script)
+	}
+	oc := func(path string, script string) gatherTask {
+		return gatherTask{path: path, container: container, script: wrap(script)}
+	}
+
+	tasks := []gatherTask{
+		oc("cluster/nodes.txt", "oc get nodes -o wide && oc describe nodes"),
+		oc("cluster/pods.txt", "oc get pods --all-namespaces -o wide && oc describe pods --all-namespaces"),
+		oc("cluster/events.txt", "oc get events --all-namespaces --sort-by=.lastTimestamp"),
+		oc("cluster/clusteroperators.txt", "oc get clusteroperators && oc describe clusteroperators"),
+		{path: "nodes/libvirt-qemu.log", container: container, script: "tail -n +1 /var/log/libvirt/qemu/*.log"},
+	}
+
+	names := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, container, []string{"/bin/bash", "-c", wrap("oc get nodes -o jsonpath='{range .items[*]}{.metadata.name}{\"\\n\"}{end}'")}, names, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode == 0 {
+		scanner := bufio.NewScanner(names)
+		for scanner.Scan() {
+			nodeName := strings.TrimSpace(scanner.Text())
+			if nodeName == "" {
+				continue
+			}
+			for _, unit := range []string{"kubelet", "crio"} {
+				tasks = append(tasks, oc(fmt.Sprintf("nodes/%s/journal-%s.log", nodeName, unit), fmt.Sprintf("oc adm node-logs %s -u %s", nodeName, unit)))
+			}
+			tasks = append(tasks, oc(fmt.Sprintf("nodes/%s/dmesg.log", nodeName), fmt.Sprintf("oc debug node/%s -- chroot /host dmesg -T", nodeName)))
+		}
+	}
+
+	pods, err := listPods(cli, container, wrap)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		tasks = append(tasks, oc(fmt.Sprintf("pods/%s/%s.log", pod[0], pod[1]), podLogsScript(pod[0], pod[1])))
+	}
+	return tasks, nil
+}
+
+// listPods returns the namespace and the name of every pod, wrap prepares the script to run kubectl in the container,
+// an unreachable API server results in no pods, since the other collections are still useful
+func listPods(cli *client.Client, container string, wrap func(string) string) ([][2]string, error) {
+	script := wrap("kubectl get pods --all-namespaces -o jsonpath='{range .items[*]}{.metadata.namespace} {.metadata.name}{\"\\n\"}{end}'")
+
+	out := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, container, []string{"/bin/bash", "-c", script}, out, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, nil
+	}
+
+	pods := [][2]string{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 {
+			pods = append(pods, [2]string{fields[0], fields[1]})
+		}
+	}
+	return pods, nil
+}
+
+// screendumpScript prints a screenshot of the VM as PPM, it is taken via the QEMU monitor of the node
+func screendumpScript(node int) string {
+	return fmt.Sprintf(`set -e
+rm -f /tmp/screen.ppm
+exec 3<>/dev/tcp/127.0.0.1/%d
+echo "screendump /tmp/screen.ppm" >&3
+timeout 10 bash -c 'until [ -s /tmp/screen.ppm ]; do sleep 0.5; done'
+exec 3>&-
+cat /tmp/screen.ppm`, utils.PortQEMUMonitor+node)
+}
+
+// podLogsScript prints the current and the previous logs of every container of the pod
+func podLogsScript(namespace string, pod string) string {
+	return fmt.Sprintf(`for container in $(kubectl -n %[1]s get pod %[2]s -o jsonpath='{.spec.initContainers[*].name} {.spec.containers[*].name}'); do
+    echo "=== ${container}"
+    kubectl -n %[1]s logs %[2]s -c ${container} --timestamps
+    if kubectl -n %[1]s logs %[2]s -c ${container} --previous >/dev/null 2>&1; then
+        echo "=== ${container} (previous)"
+        kubectl -n %[1]s logs %[2]s -c ${container} --previous --timestamps
+    fi
+done`, namespace, pod)
+}
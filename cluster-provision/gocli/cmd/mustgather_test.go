@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestRunGatherTasks(t *testing.T) {
+	collect := func(output string, err error) func(stdout io.Writer, stderr io.Writer) error {
+		return func(stdout io.Writer, stderr io.Writer) error {
+			fmt.Fprint(stdout, output)
+			fmt.Fprint(stderr, "stderr of "+output)
+			return err
+		}
+	}
+
+	tests := []struct {
+		name     string
+		tasks    []gatherTask
+		files    map[string]string
+		summary  []string
+		writeErr error
+		fails    bool
+	}{
+		{
+			name: "all collections succeed",
+			tasks: []gatherTask{
+				{path: "containers/a.log", collect: collect("a", nil)},
+				{path: "containers/b.log", collect: collect("b", nil)},
+			},
+			files:   map[string]string{"containers/a.log": "a", "containers/b.log": "b"},
+			summary: []string{"Collected 2 files of the cluster kubevirt-test at "},
+		},
+		{
+			name: "failed collections are listed with their stderr",
+			tasks: []gatherTask{
+				{path: "containers/a.log", collect: collect("a", nil)},
+				{path: "nodes/node01/dmesg.log", collect: collect("b", fmt.Errorf("exit code 1"))},
+			},
+			files: map[string]string{
+				"containers/a.log":       "a",
+				"nodes/node01/dmesg.log": "b\n--- stderr ---\nstderr of b",
+			},
+			summary: []string{"1 collections failed:\nnodes/node01/dmesg.log: exit code 1\n"},
+		},
+		{
+			name:     "write errors fail the bundle",
+			tasks:    []gatherTask{{path: "containers/a.log", collect: collect("a", nil)}},
+			writeErr: fmt.Errorf("no space left on device"),
+			fails:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{}
+			write := func(path string, data []byte) error {
+				if tt.writeErr != nil {
+					return tt.writeErr
+				}
+				files[path] = string(data)
+				return nil
+			}
+
+			err := runGatherTasks(nil, "kubevirt-test", tt.tasks, 2, write, ioutil.Discard)
+			if tt.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			summary := files["summary.txt"]
+			delete(files, "summary.txt")
+			for path, expected := range tt.files {
+				if files[path] != expected {
+					t.Errorf("expected %s to contain %q, got %q", path, expected, files[path])
+				}
+			}
+			if len(files) != len(tt.files) {
+				t.Errorf("expected %d files, got %d", len(tt.files), len(files))
+			}
+			for _, expected := range tt.summary {
+				if !strings.Contains(summary, expected) {
+					t.Errorf("expected the summary to contain %q, got %q", expected, summary)
+				}
+			}
+		})
+	}
+}
@@ -8,21 +8,14 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/client"
-	"github.com/docker/docker/pkg/archive"
 	"github.com/spf13/cobra"
 
 	"golang.org/x/net/context"
 
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
 	"kubevirt.io/kubevirtci/gocli/docker"
 )
 
-type copyConfig struct {
-	srcPath   string
-	dstPath   string
-	container string
-}
-
 // NewProvisionCommand provision the OKD cluster with one master and one worker
 func NewProvisionCommand() *cobra.Command {
 	provision := &cobra.Command{
@@ -42,6 +35,8 @@ func NewProvisionCommand() *cobra.Command {
 	provision.Flags().String("installer-pull-token-file", "", "path to the file that contains installer pull token")
 	provision.Flags().String("installer-repo-tag", "", "installer repository tag that you want to compile from")
 	provision.Flags().String("installer-release-image", "", "the OKD release image that you want to use")
+	provision.Flags().String("pull", string(docker.PullAlways), "when to pull the base image: always, missing or never")
+	provision.Flags().String("provision-log-dir", "", "writes the output of the cluster container to one log file per phase in the folder")
 
 	return provision
 }
@@ -124,9 +119,29 @@ func provision(cmd *cobra.Command, args []string) error {
 		envs = append(envs, fmt.Sprintf("INSTALLER_RELEASE_IMAGE=%s", installerReleaseImage))
 	}
 
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
+
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
 	base := args[0]
 
-	cli, err := client.NewEnvClient()
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
@@ -149,13 +164,10 @@ func provision(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Pull the base image
-	baseImage := "docker.io/" + base
-	fmt.Printf("Download the image %s\n", baseImage)
-	reader, err := cli.ImagePull(ctx, baseImage, types.ImagePullOptions{})
+	err = docker.EnsureImage(cli, ctx, base, pullPolicy)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	docker.PrintProgress(reader, os.Stdout)
 
 	clusterContainerName := prefix + "-cluster"
 	// Start cluster container
@@ -185,12 +197,7 @@ func provision(cmd *cobra.Command, args []string) error {
 	// Copy hacks directory to the container
 	if dirHacks != "" {
 		fmt.Printf("Copy hacks directory to the container %s\n", clusterContainerName)
-		config := &copyConfig{
-			srcPath:   dirHacks,
-			dstPath:   "/",
-			container: cluster.ID,
-		}
-		err = copyToContainer(ctx, cli, config)
+		err = docker.CopyToContainer(ctx, cli, cluster.ID, dirHacks, "/")
 		if err != nil {
 			return err
 		}
@@ -199,12 +206,7 @@ func provision(cmd *cobra.Command, args []string) error {
 	// Copy manifests directory to the container
 	if dirManifests != "" {
 		fmt.Printf("Copy manifests directory to the container %s\n", clusterContainerName)
-		config := &copyConfig{
-			srcPath:   dirManifests,
-			dstPath:   "/",
-			container: cluster.ID,
-		}
-		err = copyToContainer(ctx, cli, config)
+		err = docker.CopyToContainer(ctx, cli, cluster.ID, dirManifests, "/")
 		if err != nil {
 			return err
 		}
@@ -212,19 +214,14 @@ func provision(cmd *cobra.Command, args []string) error {
 
 	// Copy scripts directory to the container
 	fmt.Printf("Copy scripts directory to the container %s\n", clusterContainerName)
-	config := &copyConfig{
-		srcPath:   dirScripts,
-		dstPath:   "/",
-		container: cluster.ID,
-	}
-	err = copyToContainer(ctx, cli, config)
+	err = docker.CopyToContainer(ctx, cli, cluster.ID, dirScripts, "/")
 	if err != nil {
 		return err
 	}
 
 	// Run provision script
 	fmt.Printf("Run provision script\n")
-	success, err := docker.Exec(cli, clusterContainerName, []string{"/bin/bash", "-c", "/scripts/provision.sh"}, os.Stdout)
+	success, err := logger.Exec(cli, clusterContainerName, "cluster", "provision", []string{"/bin/bash", "-c", "/scripts/provision.sh"})
 	if err != nil {
 		return err
 	}
@@ -243,30 +240,3 @@ func provision(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
-
-func copyToContainer(ctx context.Context, cli *client.Client, config *copyConfig) error {
-	dstInfo := archive.CopyInfo{
-		Exists: true,
-		IsDir:  true,
-		Path:   config.dstPath,
-	}
-
-	srcInfo, err := archive.CopyInfoSourcePath(config.srcPath, true)
-	if err != nil {
-		return err
-	}
-
-	srcArchive, err := archive.TarResource(srcInfo)
-	if err != nil {
-		return err
-	}
-	defer srcArchive.Close()
-
-	dstDir, preparedArchive, err := archive.PrepareArchiveCopy(srcArchive, srcInfo, dstInfo)
-	if err != nil {
-		return err
-	}
-	defer preparedArchive.Close()
-
-	return cli.CopyToContainer(ctx, config.container, dstDir, preparedArchive, types.CopyToContainerOptions{})
-}
@@ -2,14 +2,15 @@ package okd
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/mount"
-	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 	"github.com/spf13/cobra"
@@ -19,13 +20,19 @@ import (
 	"kubevirt.io/kubevirtci/gocli/docker"
 )
 
+// ArtifactsCollector writes the diagnostics of the cluster with the prefix and the last provisioning output
+// to the folder before the containers of a failed run are removed
+type ArtifactsCollector func(cli *client.Client, logger *utils.ProvisionLogger, prefix string, dir string, progress io.Writer) error
+
 // NewRunCommand returns command that runs OKD cluster
-func NewRunCommand() *cobra.Command {
+func NewRunCommand(collectArtifacts ArtifactsCollector) *cobra.Command {
 	run := &cobra.Command{
 		Use:   "okd",
 		Short: "run OKD cluster",
-		RunE:  run,
-		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, args, collectArtifacts)
+		},
+		Args: cobra.MaximumNArgs(1),
 	}
 	run.Flags().String("master-memory", "12288", "amount of RAM in MB on the master")
 	run.Flags().String("master-cpu", "4", "number of CPU cores on the master")
@@ -41,10 +48,17 @@ func NewRunCommand() *cobra.Command {
 	run.Flags().Uint("ssh-worker-port", 0, "port on localhost to ssh to worker node")
 	run.Flags().Bool("background", false, "go to background after nodes are up")
 	run.Flags().Bool("random-ports", true, "expose all ports on random localhost ports")
+	utils.AddImageFlags(run.Flags())
+	utils.AddNodeConfigFlags(run.Flags())
+	run.Flags().String("pull", string(docker.PullAlways), "when to pull the cluster and sidecar images: always, missing or never")
+	run.Flags().String("provision-log-dir", "", "writes the output of the cluster container to one log file per phase in the folder")
+	run.Flags().String("artifacts-dir", "", "on failure, writes the node logs of the cluster, the container logs and the last provisioning output to the folder before cleaning up")
+	run.Flags().Bool("keep-on-failure", false, "keeps the containers when the run fails, to debug them")
+	run.Flags().Bool("preflight", true, "checks the host prerequisites like gocli doctor before any container is created, disable it to skip the checks")
 	return run
 }
 
-func run(cmd *cobra.Command, args []string) (err error) {
+func run(cmd *cobra.Command, args []string, collectArtifacts ArtifactsCollector) (err error) {
 
 	prefix, err := cmd.Flags().GetString("prefix")
 	if err != nil {
@@ -105,47 +119,142 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	cluster := args[0]
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
+
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	nodeConfig, err := utils.ResolveNodeConfig(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	images, err := utils.ResolveImages(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	cluster := images.Cluster
+	if len(args) > 0 {
+		cluster = args[0]
+	}
+	if cluster == "" {
+		return fmt.Errorf("no cluster image specified, pass it as argument or via the images config")
+	}
 
 	background, err := cmd.Flags().GetBool("background")
 	if err != nil {
 		return err
 	}
 
-	cli, err := client.NewEnvClient()
+	artifactsDir, err := cmd.Flags().GetString("artifacts-dir")
 	if err != nil {
 		return err
 	}
 
+	keepOnFailure, err := cmd.Flags().GetBool("keep-on-failure")
+	if err != nil {
+		return err
+	}
+
+	preflight, err := cmd.Flags().GetBool("preflight")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if preflight {
+		workers, err := cmd.Flags().GetString("workers")
+		if err != nil {
+			return err
+		}
+		memory, err := clusterMemory(masterMemory, workers, workersMemory)
+		if err != nil {
+			return err
+		}
+		// The master and the workers run in the cluster container, check their memory as one node
+		checks := utils.Preflight(context.Background(), cli, utils.PreflightOptions{
+			Nodes:          1,
+			Memory:         memory,
+			RegistryVolume: registryVol,
+			Ports:          portMap,
+		})
+		utils.PrintChecks(cmd.OutOrStderr(), checks, false)
+		if err := utils.CheckError(checks); err != nil {
+			return fmt.Errorf("%v, fix them or skip the checks with --preflight=false", err)
+		}
+	}
+
 	b := context.Background()
 	ctx, cancel := context.WithCancel(b)
 
 	containers, _, done := docker.NewCleanupHandler(cli, cmd.OutOrStderr())
 
 	defer func() {
+		if err != nil && artifactsDir != "" {
+			if artifactsErr := collectArtifacts(cli, logger, prefix, artifactsDir, cmd.OutOrStderr()); artifactsErr != nil {
+				fmt.Fprintf(cmd.OutOrStderr(), "collecting the failure artifacts failed: %v\n", artifactsErr)
+			}
+		}
+		if err != nil && keepOnFailure {
+			fmt.Fprintf(cmd.OutOrStderr(), "Keep the containers of the failed run, remove them with: gocli --prefix %s rm\n", prefix)
+			done <- nil
+			return
+		}
 		done <- err
 	}()
 
+	// An interrupt only cancels the context, run returns utils.ErrInterrupted at the next step and the deferred
+	// function above cleans up, so that the failure artifacts and --keep-on-failure apply as well
 	go func() {
 		interrupt := make(chan os.Signal, 1)
 		signal.Notify(interrupt, os.Interrupt)
 		<-interrupt
+		fmt.Fprintln(cmd.OutOrStderr(), "Interrupt received, stopping after the current step")
 		cancel()
-		done <- fmt.Errorf("Interrupt received, clean up")
 	}()
 
 	// Pull the cluster image
-	fmt.Printf("Download the image %s\n", "docker.io/"+cluster)
-	err = docker.ImagePull(cli, ctx, "docker.io/"+cluster, types.ImagePullOptions{})
+	err = docker.EnsureImage(cli, ctx, cluster, pullPolicy)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	// Pull the sidecar images
+	sidecarImages := []string{images.Sidecars.DockerRegistry}
+	if nfsData != "" {
+		sidecarImages = append(sidecarImages, images.Sidecars.NFSGanesha)
+	}
+	err = docker.EnsureImages(cli, ctx, sidecarImages, pullPolicy)
+	if err != nil {
+		return err
 	}
 
 	clusterContainerName := prefix + "-cluster"
 	// Start cluster container
 	clusterContainer, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: cluster,
-		Env:   envs,
+		Image:  cluster,
+		Env:    envs,
+		Labels: docker.ClusterLabels(prefix, cluster),
 		ExposedPorts: nat.PortSet{
 			utils.TCPPortOrDie(utils.PortSSH):        {},
 			utils.TCPPortOrDie(utils.PortSSHWorker):  {},
@@ -167,41 +276,32 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	// Pull the registry image
-	fmt.Printf("Download the image %s\n", utils.DockerRegistryImage)
-	err = docker.ImagePull(cli, ctx, utils.DockerRegistryImage, types.ImagePullOptions{})
-	if err != nil {
-		panic(err)
+	// Start registry
+	registryConfig := &container.Config{
+		Image: images.Sidecars.DockerRegistry,
 	}
-
-	// Create registry volume
-	var registryMounts []mount.Mount
+	registryHostConfig := &container.HostConfig{
+		Privileged:  true, // fixme we just need proper selinux volume labeling
+		NetworkMode: container.NetworkMode("container:" + clusterContainer.ID),
+	}
+	var registry container.ContainerCreateCreatedBody
 	if registryVol != "" {
-		vol, err := cli.VolumeCreate(ctx, volume.VolumesCreateBody{
-			Name: fmt.Sprintf("%s-%s", prefix, "registry"),
-		})
+		// Several registries may write to the same volume, do not let them purge the uploads of each other
+		registryConfig.Env = []string{"REGISTRY_STORAGE_MAINTENANCE_UPLOADPURGING_ENABLED=false"}
+		// The volume caches the registry content across clusters, it is kept when the cluster is removed
+		var vol types.Volume
+		vol, registry, err = docker.CreateSharedVolumeContainer(ctx, cli, registryVol, "/var/lib/registry", registryConfig, registryHostConfig, prefix+"-registry")
 		if err != nil {
 			return err
 		}
-		registryMounts = []mount.Mount{
-			{
-				Type:   mount.TypeVolume,
-				Source: vol.Name,
-				Target: "/var/lib/registry",
-			},
+		if !docker.IsSharedVolume(&vol) {
+			fmt.Fprintf(cmd.OutOrStderr(), "The volume %s exists without the label %s, rm keeps it but rm --purge does not remove it\n", vol.Name, docker.SharedVolumeLabel)
+		}
+	} else {
+		registry, err = cli.ContainerCreate(ctx, registryConfig, registryHostConfig, nil, prefix+"-registry")
+		if err != nil {
+			return err
 		}
-	}
-
-	// Start registry
-	registry, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: utils.DockerRegistryImage,
-	}, &container.HostConfig{
-		Mounts:      registryMounts,
-		Privileged:  true, // fixme we just need proper selinux volume labeling
-		NetworkMode: container.NetworkMode("container:" + clusterContainer.ID),
-	}, nil, prefix+"-registry")
-	if err != nil {
-		return err
 	}
 	containers <- registry.ID
 	fmt.Printf("Start the container %s\n", prefix+"-registry")
@@ -214,16 +314,9 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		if err != nil {
 			return err
 		}
-		// Pull the ganesha image
-		fmt.Printf("Download the image %s\n", utils.NFSGaneshaImage)
-		err = docker.ImagePull(cli, ctx, utils.NFSGaneshaImage, types.ImagePullOptions{})
-		if err != nil {
-			panic(err)
-		}
-
 		// Start the ganesha image
 		nfsServer, err := cli.ContainerCreate(ctx, &container.Config{
-			Image: utils.NFSGaneshaImage,
+			Image: images.Sidecars.NFSGanesha,
 		}, &container.HostConfig{
 			Mounts: []mount.Mount{
 				{
@@ -245,9 +338,13 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+
 	// Run the cluster
 	fmt.Printf("Run the cluster\n")
-	success, err := docker.Exec(cli, clusterContainerName, []string{"/bin/bash", "-c", "/scripts/run.sh"}, os.Stdout)
+	success, err := logger.Exec(cli, clusterContainerName, "cluster", "run", []string{"/bin/bash", "-c", "/scripts/run.sh"})
 	if err != nil {
 		return err
 	}
@@ -256,6 +353,36 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		return fmt.Errorf("failed to run the OKD cluster under the container %s", clusterContainerName)
 	}
 
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+
+	// The RHCOS nodes are configured by the cluster operators, so apply the proxy and CAs via the cluster wide proxy config
+	if !nodeConfig.IsEmpty() {
+		fmt.Printf("Configure the cluster proxy and CAs\n")
+		okdConfigScript, err := nodeConfig.GetOKDConfigScript()
+		if err != nil {
+			return err
+		}
+		success, err = logger.Exec(cli, clusterContainerName, "cluster", "config", []string{"/bin/bash", "-c", fmt.Sprintf("cat <<'EOF' >/scripts/okd-config.sh %s", okdConfigScript)})
+		if err != nil {
+			return err
+		}
+		if success {
+			success, err = logger.Exec(cli, clusterContainerName, "cluster", "config", []string{"/bin/bash", "/scripts/okd-config.sh"})
+		}
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("failed to configure the proxy and CAs of the OKD cluster under the container %s", clusterContainerName)
+		}
+	}
+
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+
 	// If background flag was specified, we don't want to clean up if we reach that state
 	if !background {
 		done <- fmt.Errorf("Done. please clean up")
@@ -263,3 +390,20 @@ func run(cmd *cobra.Command, args []string) (err error) {
 
 	return nil
 }
+
+// clusterMemory returns the memory of the master and the workers, which are given in MB
+func clusterMemory(masterMemory string, workers string, workersMemory string) (string, error) {
+	master, err := strconv.ParseUint(masterMemory, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid master memory %s, expected MB: %v", masterMemory, err)
+	}
+	count, err := strconv.ParseUint(workers, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid number of workers %s: %v", workers, err)
+	}
+	worker, err := strconv.ParseUint(workersMemory, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid workers memory %s, expected MB: %v", workersMemory, err)
+	}
+	return fmt.Sprintf("%dM", master+count*worker), nil
+}
@@ -0,0 +1,39 @@
+package okd
+
+import "testing"
+
+func TestClusterMemory(t *testing.T) {
+	tests := []struct {
+		name          string
+		masterMemory  string
+		workers       string
+		workersMemory string
+		expected      string
+		fails         bool
+	}{
+		{name: "defaults", masterMemory: "12288", workers: "1", workersMemory: "6144", expected: "18432M"},
+		{name: "several workers", masterMemory: "12288", workers: "3", workersMemory: "4096", expected: "24576M"},
+		{name: "no workers", masterMemory: "12288", workers: "0", workersMemory: "6144", expected: "12288M"},
+		{name: "unit", masterMemory: "12G", workers: "1", workersMemory: "6144", fails: true},
+		{name: "invalid workers", masterMemory: "12288", workers: "two", workersMemory: "6144", fails: true},
+		{name: "negative memory", masterMemory: "12288", workers: "1", workersMemory: "-1", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			memory, err := clusterMemory(tt.masterMemory, tt.workers, tt.workersMemory)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", memory)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if memory != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, memory)
+			}
+		})
+	}
+}
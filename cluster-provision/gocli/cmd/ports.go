@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 
 	"kubevirt.io/kubevirtci/gocli/cmd/utils"
@@ -30,12 +29,8 @@ Known port names are 'ssh', 'registry', 'ocp' and 'k8s'.
 			}
 
 			if len(args) == 1 {
-				switch args[0] {
-				case utils.PortNameSSH, utils.PortNameSSHWorker, utils.PortNameAPI, utils.PortNameOCP, utils.PortNameOCPConsole, utils.PortNameRegistry, utils.PortNameVNC:
-					return nil
-				default:
-					return fmt.Errorf("unknown port name %s", args[0])
-				}
+				_, err := utils.PortByName(args[0])
+				return err
 			}
 			return nil
 		},
@@ -58,7 +53,7 @@ func ports(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	cli, err := client.NewEnvClient()
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
@@ -78,24 +73,12 @@ func ports(cmd *cobra.Command, args []string) error {
 	}
 
 	if portName != "" {
-		err = nil
-		switch portName {
-		case utils.PortNameSSH:
-			err = utils.PrintPublicPort(utils.PortSSH, containers[0].Ports)
-		case utils.PortNameSSHWorker:
-			err = utils.PrintPublicPort(utils.PortSSHWorker, containers[0].Ports)
-		case utils.PortNameAPI:
-			err = utils.PrintPublicPort(utils.PortAPI, containers[0].Ports)
-		case utils.PortNameRegistry:
-			err = utils.PrintPublicPort(utils.PortRegistry, containers[0].Ports)
-		case utils.PortNameOCP:
-			err = utils.PrintPublicPort(utils.PortOCP, containers[0].Ports)
-		case utils.PortNameOCPConsole:
-			err = utils.PrintPublicPort(utils.PortOCPConsole, containers[0].Ports)
-		case utils.PortNameVNC:
-			err = utils.PrintPublicPort(utils.PortVNC, containers[0].Ports)
+		port, err := utils.PortByName(portName)
+		if err != nil {
+			return err
 		}
 
+		err = utils.PrintPublicPort(port, containers[0].Ports)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,221 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// CatalogVersion is the version of the catalog format which gocli understands
+const CatalogVersion = 1
+
+// CatalogEnv contains the environment variable name of a catalog file which replaces the embedded catalog
+const CatalogEnv = "GOCLI_PROVIDER_CATALOG"
+
+// catalogData is the embedded catalog, the images are the ones of cluster-up/cluster/<provider>/provider.sh
+const catalogData = `
+version: 1
+providers:
+- name: k8s-1.11.0
+  image: kubevirtci/k8s-1.11.0@sha256:3412f158ecad53543c9b0aa8468db84dd043f01832a66f0db90327b7dc36a8e8
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  kubeconfig:
+    path: /etc/kubernetes/admin.conf
+    kubectl: /usr/bin/kubectl
+    cluster: kubernetes
+    port: k8s
+- name: k8s-1.13.3
+  image: kubevirtci/k8s-1.13.3@sha256:9c2b78e11c25b3fd0b24b0ed684a112052dff03eee4ca4bdcc4f3168f9a14396
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  kubeconfig:
+    path: /etc/kubernetes/admin.conf
+    kubectl: /usr/bin/kubectl
+    cluster: kubernetes
+    port: k8s
+- name: k8s-genie-1.11.1
+  image: kubevirtci/k8s-genie-1.11.1@sha256:bd3c56acfd0bdad24e204a49e41d2192eab4cad282a1bb9bed01790874ba8b58
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  kubeconfig:
+    path: /etc/kubernetes/admin.conf
+    kubectl: /usr/bin/kubectl
+    cluster: kubernetes
+    port: k8s
+- name: k8s-multus-1.13.3
+  image: kubevirtci/k8s-multus-1.13.3@sha256:8418163abbc4acddefa26a63706446af9fd67aab20388a5e8d453cff0c0169f1
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  kubeconfig:
+    path: /etc/kubernetes/admin.conf
+    kubectl: /usr/bin/kubectl
+    cluster: kubernetes
+    port: k8s
+- name: os-3.11.0
+  image: kubevirtci/os-3.11.0@sha256:ce98292a3e11f6b69a8c2db173c586fd1aea5a2f34031e5e5bc16802320cec82
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  args: [--reverse]
+  # The web console redirects to the port of the API server
+  ports:
+    ocp: 8443
+  kubeconfig:
+    path: /etc/origin/master/admin.kubeconfig
+    kubectl: /usr/bin/oc
+    cluster: node01:8443
+    port: ocp
+- name: os-3.11.0-crio
+  image: kubevirtci/os-3.11.0-crio@sha256:ec798b0399f7ffeb0477a077574205cd379b79710a14965eab52c798be2bdc52
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  args: [--reverse]
+  ports:
+    ocp: 8443
+  kubeconfig:
+    path: /etc/origin/master/admin.kubeconfig
+    kubectl: /usr/bin/oc
+    cluster: node01:8443
+    port: ocp
+- name: os-3.11.0-multus
+  image: kubevirtci/os-3.11.0-multus@sha256:f2d03ccbe60157e60a5be3b41536e1ba046fc1820c1ceec1f0018b0362c7808c
+  nodes: 1
+  memory: 5120M
+  cpu: 5
+  args: [--reverse]
+  ports:
+    ocp: 8443
+  kubeconfig:
+    path: /etc/origin/master/admin.kubeconfig
+    kubectl: /usr/bin/oc
+    cluster: node01:8443
+    port: ocp
+- name: okd-4.1.0
+  image: kubevirtci/okd-4.1.0@sha256:8a89ea659ffcfc6402d7d6ee43418bf2194b27ea74c239699e8268e29639aaa4
+  command: okd
+  container: cluster
+  args: [--master-cpu, "5", --workers-cpu, "5"]
+  kubeconfig:
+    path: /root/install/auth/kubeconfig
+    kubectl: /bin/oc
+    cluster: test-1
+    port: k8s
+`
+
+// Kubeconfig describes where the kubeconfig and the client of a provider are found in the cluster
+type Kubeconfig struct {
+	// Path is the kubeconfig of the cluster admin
+	Path string `yaml:"path"`
+	// Kubectl is the kubectl or oc binary which matches the cluster version
+	Kubectl string `yaml:"kubectl"`
+	// Cluster is the name of the cluster in the kubeconfig whose server is replaced with the published API port
+	Cluster string `yaml:"cluster"`
+	// Port is the name of the API server port, like k8s or ocp
+	Port string `yaml:"port"`
+}
+
+// Provider is an entry of the catalog, it describes how a cluster of the provider is started and accessed
+type Provider struct {
+	// Name is the name of the provider, like k8s-1.13.3
+	Name string `yaml:"name"`
+	// Image is the cluster image, referenced by its digest
+	Image string `yaml:"image"`
+	// Command is the subcommand of run which starts the cluster, like okd, by default the nodes are started by run
+	Command string `yaml:"command,omitempty"`
+	// Container is the container which runs the cluster and publishes the ports, like cluster,
+	// by default the ports are published by dnsmasq and the kubeconfig is read from node01 via SSH
+	Container string `yaml:"container,omitempty"`
+	// Nodes is the default number of nodes
+	Nodes uint `yaml:"nodes,omitempty"`
+	// Memory is the default amount of ram per node
+	Memory string `yaml:"memory,omitempty"`
+	// CPU is the default number of cpu cores per node
+	CPU uint `yaml:"cpu,omitempty"`
+	// Args are passed to run in addition
+	Args []string `yaml:"args,omitempty"`
+	// Ports are the fixed localhost ports by port name, all other ports are published on random ports
+	Ports map[string]uint `yaml:"ports,omitempty"`
+	// Kubeconfig describes where the kubeconfig and the client are found in the cluster
+	Kubeconfig Kubeconfig `yaml:"kubeconfig"`
+}
+
+// Catalog is a versioned list of providers
+type Catalog struct {
+	Version   int        `yaml:"version"`
+	Providers []Provider `yaml:"providers"`
+}
+
+// LoadCatalog returns the catalog of the file, of the file in CatalogEnv or the embedded catalog
+func LoadCatalog(path string) (*Catalog, error) {
+	if path == "" {
+		path = os.Getenv(CatalogEnv)
+	}
+	data := []byte(catalogData)
+	if path != "" {
+		var err error
+		data, err = ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		path = "embedded"
+	}
+
+	catalog := &Catalog{}
+	if err := yaml.UnmarshalStrict(data, catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse the provider catalog %s: %v", path, err)
+	}
+	if catalog.Version != CatalogVersion {
+		return nil, fmt.Errorf("the provider catalog %s has version %d, gocli supports version %d", path, catalog.Version, CatalogVersion)
+	}
+	for _, p := range catalog.Providers {
+		if p.Name == "" || p.Image == "" {
+			return nil, fmt.Errorf("the provider catalog %s has an entry without name or image", path)
+		}
+		if p.Kubeconfig.Path == "" || p.Kubeconfig.Kubectl == "" || p.Kubeconfig.Cluster == "" || p.Kubeconfig.Port == "" {
+			return nil, fmt.Errorf("the provider %s of the catalog %s has an incomplete kubeconfig", p.Name, path)
+		}
+	}
+	return catalog, nil
+}
+
+// Lookup returns the provider with the name
+func (c *Catalog) Lookup(name string) (*Provider, error) {
+	for i := range c.Providers {
+		if c.Providers[i].Name == name {
+			return &c.Providers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown provider %s, known providers are %s", name, strings.Join(c.Names(), ", "))
+}
+
+// LookupImage returns the provider of the cluster image, the registry docker.io is optional
+func (c *Catalog) LookupImage(image string) (*Provider, error) {
+	image = strings.TrimPrefix(image, "docker.io/")
+	for i := range c.Providers {
+		if strings.TrimPrefix(c.Providers[i].Image, "docker.io/") == image {
+			return &c.Providers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("the image %s belongs to no provider of the catalog", image)
+}
+
+// Names returns the names of the providers in lexical order
+func (c *Catalog) Names() []string {
+	names := []string{}
+	for _, p := range c.Providers {
+		names = append(names, p.Name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,130 @@
+package providers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadCatalog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-catalog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name      string
+		catalog   string
+		env       bool
+		providers []string
+		fails     bool
+	}{
+		{
+			name:      "embedded catalog",
+			providers: []string{"k8s-1.11.0", "k8s-1.13.3", "k8s-genie-1.11.1", "k8s-multus-1.13.3", "okd-4.1.0", "os-3.11.0", "os-3.11.0-crio", "os-3.11.0-multus"},
+		},
+		{
+			name: "catalog file",
+			catalog: `version: 1
+providers:
+- name: k8s-1.14.0
+  image: kubevirtci/k8s-1.14.0
+  kubeconfig: {path: /etc/kubernetes/admin.conf, kubectl: /usr/bin/kubectl, cluster: kubernetes, port: k8s}
+`,
+			providers: []string{"k8s-1.14.0"},
+		},
+		{
+			name: "catalog file of the environment",
+			catalog: `version: 1
+providers:
+- name: k8s-1.14.0
+  image: kubevirtci/k8s-1.14.0
+  kubeconfig: {path: /etc/kubernetes/admin.conf, kubectl: /usr/bin/kubectl, cluster: kubernetes, port: k8s}
+`,
+			env:       true,
+			providers: []string{"k8s-1.14.0"},
+		},
+		{name: "unsupported version", catalog: "version: 2\nproviders: []\n", fails: true},
+		{name: "unknown field", catalog: "version: 1\nproviders:\n- name: k8s\n  image: k8s\n  disk: 10G\n", fails: true},
+		{name: "missing image", catalog: "version: 1\nproviders:\n- name: k8s\n", fails: true},
+		{
+			name:    "incomplete kubeconfig",
+			catalog: "version: 1\nproviders:\n- name: k8s\n  image: k8s\n  kubeconfig: {path: /etc/kubernetes/admin.conf}\n",
+			fails:   true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.catalog != "" {
+				path = filepath.Join(dir, fmt.Sprintf("catalog-%d.yaml", i))
+				if err := ioutil.WriteFile(path, []byte(tt.catalog), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.env {
+				os.Setenv(CatalogEnv, path)
+				defer os.Unsetenv(CatalogEnv)
+				path = ""
+			}
+
+			catalog, err := LoadCatalog(path)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", catalog.Names())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(catalog.Names(), tt.providers) {
+				t.Errorf("expected %v, got %v", tt.providers, catalog.Names())
+			}
+		})
+	}
+}
+
+func TestLookupImage(t *testing.T) {
+	catalog, err := LoadCatalog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	k8s, err := catalog.Lookup("k8s-1.13.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		image    string
+		expected string
+		fails    bool
+	}{
+		{image: k8s.Image, expected: "k8s-1.13.3"},
+		{image: "docker.io/" + k8s.Image, expected: "k8s-1.13.3"},
+		{image: "kubevirtci/k8s-1.13.3", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			provider, err := catalog.LookupImage(tt.image)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", provider.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if provider.Name != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, provider.Name)
+			}
+		})
+	}
+}
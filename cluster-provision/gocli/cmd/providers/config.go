@@ -0,0 +1,187 @@
+package providers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigPathEnv contains the environment variable name of the directory with the generated configs of the providers
+const ConfigPathEnv = "KUBEVIRTCI_CONFIG_PATH"
+
+const (
+	// FormatSh writes the values as shell variables, like config-provider-<provider>.sh
+	FormatSh = "sh"
+	// FormatJSON writes the values as JSON object
+	FormatJSON = "json"
+	// FormatDotenv writes the values as upper case variables of a .env file
+	FormatDotenv = "dotenv"
+)
+
+// shellSafe matches the values which do not need to be quoted in the shell or a .env file
+var shellSafe = regexp.MustCompile(`^[-a-zA-Z0-9_./:@%+=,]*$`)
+
+// Config contains the connection details of a running cluster
+type Config struct {
+	MasterIP             string
+	Kubeconfig           string
+	Kubectl              string
+	Gocli                string
+	DockerPrefix         string
+	ManifestDockerPrefix string
+}
+
+// NewConfig returns the connection details of the cluster of the provider,
+// the kubeconfig and the client are expected in the config directory of the provider
+func NewConfig(configPath string, provider string, gocli string, registryPort uint16) (*Config, error) {
+	dir, err := filepath.Abs(ConfigDir(configPath, provider))
+	if err != nil {
+		return nil, err
+	}
+	return &Config{
+		MasterIP:             "127.0.0.1",
+		Kubeconfig:           filepath.Join(dir, ".kubeconfig"),
+		Kubectl:              filepath.Join(dir, ".kubectl"),
+		Gocli:                gocli,
+		DockerPrefix:         fmt.Sprintf("localhost:%d/kubevirt", registryPort),
+		ManifestDockerPrefix: "registry:5000/kubevirt",
+	}, nil
+}
+
+// ConfigDir returns the directory with the generated configs of the provider,
+// an empty config path defaults to ConfigPathEnv or _ci-configs
+func ConfigDir(configPath string, provider string) string {
+	if configPath == "" {
+		configPath = os.Getenv(ConfigPathEnv)
+	}
+	if configPath == "" {
+		configPath = "_ci-configs"
+	}
+	return filepath.Join(configPath, provider)
+}
+
+// ValidateFormat returns an error if the format of the connection details is not supported
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatSh, FormatJSON, FormatDotenv:
+		return nil
+	}
+	return fmt.Errorf("unsupported format %s, expected %s, %s or %s", format, FormatSh, FormatJSON, FormatDotenv)
+}
+
+// values returns the connection details in the order of config-provider-<provider>.sh
+func (c *Config) values() [][2]string {
+	return [][2]string{
+		{"master_ip", c.MasterIP},
+		{"kubeconfig", c.Kubeconfig},
+		{"kubectl", c.Kubectl},
+		{"gocli", c.Gocli},
+		{"docker_prefix", c.DockerPrefix},
+		{"manifest_docker_prefix", c.ManifestDockerPrefix},
+	}
+}
+
+// Write writes the connection details in the format
+func (c *Config) Write(out io.Writer, format string) error {
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		object := map[string]string{}
+		for _, v := range c.values() {
+			object[v[0]] = v[1]
+		}
+		data, err := json.MarshalIndent(object, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "%s\n", data)
+		return err
+	}
+
+	for _, v := range c.values() {
+		key, value := v[0], v[1]
+		switch {
+		case format == FormatDotenv:
+			key = strings.ToUpper(key)
+			if !shellSafe.MatchString(value) {
+				value = strconv.Quote(value)
+			}
+		case !shellSafe.MatchString(value):
+			value = "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+		}
+		if _, err := fmt.Fprintf(out, "%s=%s\n", key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteConfigScript writes config-provider-<provider>.sh into the config directory of the provider
+func WriteConfigScript(configPath string, provider string, config *Config) error {
+	buf := new(bytes.Buffer)
+	if err := config.Write(buf, FormatSh); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(ConfigDir(configPath, provider), fmt.Sprintf("config-provider-%s.sh", provider)), buf.Bytes(), 0644)
+}
+
+// SetKubeconfigServer points the cluster of the kubeconfig to the server and disables the TLS verification,
+// since the certificate of the API server is not issued for the published address
+func SetKubeconfigServer(kubeconfig []byte, cluster string, server string) ([]byte, error) {
+	config := yaml.MapSlice{}
+	if err := yaml.Unmarshal(kubeconfig, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse the kubeconfig: %v", err)
+	}
+
+	clusters, _ := lookup(config, "clusters").([]interface{})
+	found := false
+	for _, c := range clusters {
+		entry, ok := c.(yaml.MapSlice)
+		if !ok || lookup(entry, "name") != cluster {
+			continue
+		}
+		details, _ := lookup(entry, "cluster").(yaml.MapSlice)
+		updated := yaml.MapSlice{}
+		for _, item := range details {
+			switch item.Key {
+			case "server", "insecure-skip-tls-verify", "certificate-authority", "certificate-authority-data":
+				continue
+			}
+			updated = append(updated, item)
+		}
+		updated = append(updated,
+			yaml.MapItem{Key: "server", Value: server},
+			yaml.MapItem{Key: "insecure-skip-tls-verify", Value: true},
+		)
+		for i := range entry {
+			if entry[i].Key == "cluster" {
+				entry[i].Value = updated
+			}
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("the kubeconfig has no cluster %s", cluster)
+	}
+	return yaml.Marshal(config)
+}
+
+func lookup(m yaml.MapSlice, key string) interface{} {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package providers
+
+import (
+	"bytes"
+	"os/exec"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestSetKubeconfigServer(t *testing.T) {
+	kubeconfig := `apiVersion: v1
+kind: Config
+clusters:
+- name: kubernetes
+  cluster:
+    certificate-authority-data: LS0tLS1CRUdJTg==
+    server: https://192.168.66.101:6443
+- name: other
+  cluster:
+    server: https://10.0.0.1:6443
+current-context: kubernetes-admin@kubernetes
+`
+
+	tests := []struct {
+		name       string
+		kubeconfig string
+		cluster    string
+		fails      bool
+	}{
+		{name: "cluster is updated", kubeconfig: kubeconfig, cluster: "kubernetes"},
+		{name: "unknown cluster", kubeconfig: kubeconfig, cluster: "node01:8443", fails: true},
+		{name: "invalid kubeconfig", kubeconfig: "clusters: [", cluster: "kubernetes", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated, err := SetKubeconfigServer([]byte(tt.kubeconfig), tt.cluster, "https://127.0.0.1:33001")
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got\n%s", updated)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			config := struct {
+				Clusters []struct {
+					Name    string                 `yaml:"name"`
+					Cluster map[string]interface{} `yaml:"cluster"`
+				} `yaml:"clusters"`
+				CurrentContext string `yaml:"current-context"`
+			}{}
+			if err := yaml.Unmarshal(updated, &config); err != nil {
+				t.Fatalf("failed to parse the kubeconfig: %v", err)
+			}
+			if config.CurrentContext != "kubernetes-admin@kubernetes" {
+				t.Errorf("expected the other keys to be kept, got\n%s", updated)
+			}
+			for _, c := range config.Clusters {
+				expected := map[string]interface{}{"server": "https://10.0.0.1:6443"}
+				if c.Name == tt.cluster {
+					expected = map[string]interface{}{"server": "https://127.0.0.1:33001", "insecure-skip-tls-verify": true}
+				}
+				if len(c.Cluster) != len(expected) {
+					t.Errorf("expected the cluster %s to be %v, got %v", c.Name, expected, c.Cluster)
+				}
+				for key, value := range expected {
+					if c.Cluster[key] != value {
+						t.Errorf("expected %s of the cluster %s to be %v, got %v", key, c.Name, value, c.Cluster[key])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConfigWrite(t *testing.T) {
+	config := &Config{
+		MasterIP:             "127.0.0.1",
+		Kubeconfig:           "/home/user/ci configs/k8s-1.13.3/.kubeconfig",
+		Kubectl:              "/home/user/it's/k8s-1.13.3/.kubectl",
+		Gocli:                "cluster-up/cli.sh",
+		DockerPrefix:         "localhost:33002/kubevirt",
+		ManifestDockerPrefix: "registry:5000/kubevirt",
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+		fails    bool
+	}{
+		{
+			format: FormatSh,
+			expected: `master_ip=127.0.0.1
+kubeconfig='/home/user/ci configs/k8s-1.13.3/.kubeconfig'
+kubectl='/home/user/it'\''s/k8s-1.13.3/.kubectl'
+gocli=cluster-up/cli.sh
+docker_prefix=localhost:33002/kubevirt
+manifest_docker_prefix=registry:5000/kubevirt
+`,
+		},
+		{
+			format: FormatDotenv,
+			expected: `MASTER_IP=127.0.0.1
+KUBECONFIG="/home/user/ci configs/k8s-1.13.3/.kubeconfig"
+KUBECTL="/home/user/it's/k8s-1.13.3/.kubectl"
+GOCLI=cluster-up/cli.sh
+DOCKER_PREFIX=localhost:33002/kubevirt
+MANIFEST_DOCKER_PREFIX=registry:5000/kubevirt
+`,
+		},
+		{
+			format: FormatJSON,
+			expected: `{
+  "docker_prefix": "localhost:33002/kubevirt",
+  "gocli": "cluster-up/cli.sh",
+  "kubeconfig": "/home/user/ci configs/k8s-1.13.3/.kubeconfig",
+  "kubectl": "/home/user/it's/k8s-1.13.3/.kubectl",
+  "manifest_docker_prefix": "registry:5000/kubevirt",
+  "master_ip": "127.0.0.1"
+}
+`,
+		},
+		{format: "yaml", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			err := config.Write(out, tt.format)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got\n%s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, out)
+			}
+		})
+	}
+}
+
+// TestConfigWriteShell fails if the shell does not read the values which were written
+func TestConfigWriteShell(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skipf("bash is not available: %v", err)
+	}
+
+	config := &Config{Kubeconfig: "/tmp/a b/$HOME/`id`/it's/.kubeconfig", Kubectl: `C:\kubectl "quoted"`}
+	out := new(bytes.Buffer)
+	if err := config.Write(out, FormatSh); err != nil {
+		t.Fatal(err)
+	}
+	script := out.String() + `printf '%s\n%s' "$kubeconfig" "$kubectl"`
+	read, err := exec.Command(bash, "-c", script).Output()
+	if err != nil {
+		t.Fatalf("failed to run\n%s\n%v", script, err)
+	}
+	if expected := config.Kubeconfig + "\n" + config.Kubectl; string(read) != expected {
+		t.Errorf("expected %q, got %q", expected, read)
+	}
+}
@@ -2,9 +2,12 @@ package cmd
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
-	"strconv"
+	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -24,18 +27,29 @@ import (
 func NewProvisionCommand() *cobra.Command {
 
 	provision := &cobra.Command{
-		Use:   "provision",
-		Short: "provision starts a given cluster",
-		RunE:  provision,
-		Args:  cobra.ExactArgs(2),
+		Use:   "provision base target",
+		Short: "provision provisions a node of the base image with the scripts and commits it as the target image",
+		Long: `provision provisions a node of the base image with the scripts and commits it as the target image
+
+The scripts directory is copied to /scripts of the node container and its
+provision.sh runs on the node, with the --k8s-version as version in its
+environment. The free space of the node is zeroed and the node is shut down,
+qemu-img convert then writes its disk without the zeroed clusters into the
+container and the container is committed as the target image.
+`,
+		RunE: provision,
+		Args: cobra.ExactArgs(2),
 	}
 	provision.Flags().StringP("memory", "m", "3096M", "amount of ram per node")
 	provision.Flags().UintP("cpu", "c", 2, "number of cpu cores per node")
 	provision.Flags().String("qemu-args", "", "additional qemu args to pass through to the nodes")
-	provision.Flags().String("scripts", "", "location for the provision and run scripts")
+	provision.Flags().String("scripts", "", "directory with provision.sh and the scripts which the target image runs on the nodes")
 	provision.Flags().Bool("random-ports", false, "expose all ports on random localhost ports")
 	provision.Flags().Uint("vnc-port", 0, "port on localhost for vnc")
 	provision.Flags().Uint("ssh-port", 0, "port on localhost for ssh server")
+	provision.Flags().String("pull", string(docker.PullAlways), "when to pull the base image: always, missing or never")
+	provision.Flags().String("provision-log-dir", "", "writes the provisioning output to one log file per phase in the folder")
+	provision.Flags().String("k8s-version", "", "Kubernetes version which provision.sh installs, it is passed as version to the script")
 
 	provision.AddCommand(
 		okd.NewProvisionCommand(),
@@ -46,15 +60,20 @@ func NewProvisionCommand() *cobra.Command {
 
 func provision(cmd *cobra.Command, args []string) error {
 
-	prefix, err := cmd.Flags().GetString("prefix")
+	scripts, err := cmd.Flags().GetString("scripts")
 	if err != nil {
 		return err
 	}
-
-	scripts, err := cmd.Flags().GetString("scripts")
+	if scripts == "" {
+		return fmt.Errorf("the scripts directory has to be set with --scripts")
+	}
+	scripts, err = filepath.Abs(scripts)
 	if err != nil {
 		return err
 	}
+	if _, err := os.Stat(filepath.Join(scripts, "provision.sh")); err != nil {
+		return fmt.Errorf("the scripts directory needs a provision.sh: %v", err)
+	}
 
 	memory, err := cmd.Flags().GetString("memory")
 	if err != nil {
@@ -81,10 +100,101 @@ func provision(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	base := args[0]
-	//target := args[1]
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
 
-	cli, err := client.NewEnvClient()
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	k8sVersion, err := cmd.Flags().GetString("k8s-version")
+	if err != nil {
+		return err
+	}
+	if err := utils.ValidateKubernetesVersion(k8sVersion); err != nil {
+		return err
+	}
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	// The version is passed and recorded like the kubernetesVersion of a recipe
+	var env, changes []string
+	if k8sVersion != "" {
+		env = []string{"version=" + k8sVersion}
+		changes = utils.LabelChanges(map[string]string{utils.LabelKubernetesVersion: k8sVersion})
+	}
+
+	return provisionImage(cmd, &provisionOptions{
+		base:        args[0],
+		target:      args[1],
+		scripts:     scripts,
+		provision:   []string{"provision.sh"},
+		env:         env,
+		changes:     changes,
+		memory:      memory,
+		cpu:         cpu,
+		qemuArgs:    qemuArgs,
+		randomPorts: randomPorts,
+		portMap:     portMap,
+		pullPolicy:  pullPolicy,
+		logger:      logger,
+	})
+}
+
+// provisionOptions describe how the target image is provisioned from the base image
+type provisionOptions struct {
+	base   string
+	target string
+	// scripts is the host directory which is copied to /scripts of the node container
+	scripts string
+	// provision are the scripts of the scripts directory which run on the node in order
+	provision []string
+	// env is passed to the provision scripts
+	env []string
+	// args are passed as arguments to the provision scripts
+	args []string
+	// files are copied from the host to the node before the provision scripts run
+	files []utils.RecipeFile
+	// packages are installed on the node before the provision scripts run
+	packages []string
+	// changes are applied to the committed image, like LABEL instructions
+	changes []string
+
+	memory      string
+	cpu         uint
+	qemuArgs    string
+	randomPorts bool
+	portMap     nat.PortMap
+	pullPolicy  docker.PullPolicy
+	logger      *utils.ProvisionLogger
+}
+
+// provisionImage boots one node of the base image, provisions it, compacts its disk and commits it as the target image
+func provisionImage(cmd *cobra.Command, opts *provisionOptions) (err error) {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+	base := opts.base
+	memory := opts.memory
+	cpu := opts.cpu
+	qemuArgs := opts.qemuArgs
+	randomPorts := opts.randomPorts
+	portMap := opts.portMap
+	logger := opts.logger
+
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
@@ -104,15 +214,92 @@ func provision(cmd *cobra.Command, args []string) error {
 	}()
 
 	// Pull the base image
-	reader, err := cli.ImagePull(ctx, "docker.io/"+base, types.ImagePullOptions{})
+	err = docker.EnsureImage(cli, ctx, base, opts.pullPolicy)
+	if err != nil {
+		return err
+	}
+
+	dnsmasq, err := startDNSMasq(ctx, cli, prefix, base, randomPorts, portMap, containers)
+	if err != nil {
+		return err
+	}
+
+	nodeName := nodeNameFromIndex(1)
+	// The VM is only stopped on shutdown, so that its disk can be converted in the running container
+	qemuArgs = fmt.Sprintf("%s -no-shutdown -monitor telnet:127.0.0.1:%d,server,nowait", qemuArgs, utils.PortQEMUMonitor+1)
+	node, err := startNode(ctx, cli, logger, prefix, dnsmasq, &nodeOptions{
+		image:   base,
+		command: vmCommand(memory, cpu, qemuArgs),
+		copy:    map[string]string{opts.scripts: "/scripts"},
+	}, containers, volumes)
+	if err != nil {
+		return err
+	}
+
+	var success bool
+	for i, file := range opts.files {
+		if err := copyToNode(cli, logger, prefix, nodeName, i, file); err != nil {
+			return err
+		}
+	}
+
+	if len(opts.packages) > 0 {
+		success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "packages", []string{"/bin/bash", "-c", "ssh.sh sudo yum install -y " + strings.Join(opts.packages, " ")})
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("installing the packages %s on node %s failed", strings.Join(opts.packages, ", "), nodeName)
+		}
+	}
+
+	shell := "/bin/bash"
+	if len(opts.args) > 0 {
+		shell = "/bin/bash -s " + strings.Join(opts.args, " ")
+	}
+	for _, script := range opts.provision {
+		success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "provision", []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo %s %s < /scripts/%s", strings.Join(opts.env, " "), shell, script)})
+		if err != nil {
+			return err
+		}
+
+		if !success {
+			return fmt.Errorf("provisioning node %s with %s failed", nodeName, script)
+		}
+	}
+
+	compact, err := utils.GetCompactScript(utils.PortQEMUMonitor + 1)
+	if err != nil {
+		return err
+	}
+	if err := shutdownNode(cli, logger, prefix, nodeName, "compact", compact); err != nil {
+		return err
+	}
+
+	// The next run creates them again for its node number
+	for _, file := range []string{"/usr/local/bin/ssh.sh", "/ssh_ready"} {
+		if _, err := docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"rm", "-f", file}, ioutil.Discard); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Commit the container %s as %s\n", nodeContainer(prefix, nodeName), opts.target)
+	_, err = cli.ContainerCommit(ctx, node, types.ContainerCommitOptions{
+		Reference: opts.target,
+		Comment:   fmt.Sprintf("provisioned from %s with %s", base, filepath.Base(opts.scripts)),
+		Changes:   opts.changes,
+	})
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("failed to commit the provisioned container %s: %v", nodeContainer(prefix, nodeName), err)
 	}
-	docker.PrintProgress(reader, os.Stdout)
 
-	// Start dnsmasq
+	return nil
+}
+
+// startDNSMasq starts the dnsmasq container of the image for a single node, whose network the node container joins
+func startDNSMasq(ctx context.Context, cli *client.Client, prefix string, image string, randomPorts bool, portMap nat.PortMap, containers chan string) (string, error) {
 	dnsmasq, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: base,
+		Image: image,
 		Env: []string{
 			fmt.Sprintf("NUM_NODES=1"),
 		},
@@ -127,35 +314,51 @@ func provision(cmd *cobra.Command, args []string) error {
 		PortBindings:    portMap,
 	}, nil, prefix+"-dnsmasq")
 	if err != nil {
-		return err
+		return "", err
 	}
 	containers <- dnsmasq.ID
 	if err := cli.ContainerStart(ctx, dnsmasq.ID, types.ContainerStartOptions{}); err != nil {
-		return err
+		return "", err
 	}
+	return dnsmasq.ID, nil
+}
 
+// vmCommand returns the command of a node container which boots the VM with vm.sh,
+// the qemu args are quoted for bash, so that they reach vm.sh as one argument
+func vmCommand(memory string, cpu uint, qemuArgs string) string {
+	return fmt.Sprintf("/vm.sh -n /var/run/disk/disk.qcow2 --memory %s --cpu %d --qemu-args %s", utils.ShellQuote(memory), cpu, utils.ShellQuote(qemuArgs))
+}
+
+// nodeOptions describe the container of the single node which provision, build and base build provision
+type nodeOptions struct {
+	image string
+	// command is run by the node container, it has to boot the VM with vm.sh
+	command string
+	// copy maps host paths to the paths in the node container to which they are copied before the command starts
+	copy map[string]string
+}
+
+// startNode creates node01 with its disk volume in the network of dnsmasq and waits until the VM is reachable with ssh.sh,
+// it returns the ID of the node container
+func startNode(ctx context.Context, cli *client.Client, logger *utils.ProvisionLogger, prefix string, dnsmasq string, opts *nodeOptions, containers chan string, volumes chan string) (string, error) {
 	nodeName := nodeNameFromIndex(1)
-	nodeNum := fmt.Sprintf("%02d", 1)
 
 	vol, err := cli.VolumeCreate(ctx, volume.VolumesCreateBody{
 		Name: fmt.Sprintf("%s-%s", prefix, nodeName),
 	})
 	if err != nil {
-		return err
+		return "", err
 	}
 	volumes <- vol.Name
-	if len(qemuArgs) > 0 {
-		qemuArgs = "--qemu-args " + qemuArgs
-	}
 	node, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: base,
+		Image: opts.image,
 		Env: []string{
-			fmt.Sprintf("NODE_NUM=%s", nodeNum),
+			"NODE_NUM=01",
 		},
 		Volumes: map[string]struct{}{
 			"/var/run/disk/": {},
 		},
-		Cmd: []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh -n /var/run/disk/disk.qcow2 --memory %s --cpu %s %s", memory, strconv.Itoa(int(cpu)), qemuArgs)},
+		Cmd: []string{"/bin/bash", "-c", opts.command},
 	}, &container.HostConfig{
 		Mounts: []mount.Mount{
 			{
@@ -165,51 +368,80 @@ func provision(cmd *cobra.Command, args []string) error {
 			},
 		},
 		Privileged:  true,
-		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
-	}, nil, prefix+"-"+nodeName)
+		NetworkMode: container.NetworkMode("container:" + dnsmasq),
+	}, nil, nodeContainer(prefix, nodeName))
 	if err != nil {
-		return err
+		return "", err
 	}
 	containers <- node.ID
-	if err := cli.ContainerStart(ctx, node.ID, types.ContainerStartOptions{}); err != nil {
-		return err
+
+	for src, dst := range opts.copy {
+		if err := docker.CopyToContainer(ctx, cli, node.ID, src, dst); err != nil {
+			return "", fmt.Errorf("copying %s to node %s failed: %v", src, nodeName, err)
+		}
 	}
 
-	// Copy scripts
-	fmt.Println(scripts)
+	if err := cli.ContainerStart(ctx, node.ID, types.ContainerStartOptions{}); err != nil {
+		return "", err
+	}
 
 	// Wait for vm start
-	success, err := docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"}, os.Stdout)
+	success, err := logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "boot", []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"})
 	if err != nil {
-		return err
+		return "", err
 	}
-
 	if !success {
-		return fmt.Errorf("checking for ssh.sh script for node %s failed", nodeName)
+		return "", fmt.Errorf("checking for ssh.sh script for node %s failed", nodeName)
 	}
+	return node.ID, nil
+}
 
-	//check if we have a special provision script
-	success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "test -f /scripts/provision.sh"}, os.Stdout)
+// shutdownNode zeroes the free space of the node, powers it off and runs the script, which converts its disk,
+// in the node container
+func shutdownNode(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, phase string, diskScript string) error {
+	success, err := provisionScript(cli, logger, prefix, nodeName, "shutdown", "shutdown", utils.GetShutdownScript())
 	if err != nil {
-		return fmt.Errorf("checking for a provision script failed failed: %v", err)
+		return err
+	}
+	if !success {
+		return fmt.Errorf("shutting down node %s failed", nodeName)
 	}
 
-	success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "ssh.sh sudo /bin/bash < /scripts/provision.sh"}, os.Stdout)
-
+	success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, phase, []string{"/bin/bash", "-c", diskScript})
 	if err != nil {
 		return err
 	}
-
 	if !success {
-		return fmt.Errorf("provisioning node %s failed", nodeName)
+		return fmt.Errorf("converting the disk of node %s failed", nodeName)
 	}
+	return nil
+}
 
-	success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "rm /usr/local/bin/ssh.sh"}, os.Stdout)
-	success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "rm /ssh_ready"}, os.Stdout)
+// copyToNode copies the file or directory from the host to the destination path on the node,
+// it is staged in /files of the node container and streamed to the node as tar over SSH
+func copyToNode(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, index int, file utils.RecipeFile) error {
+	container := nodeContainer(prefix, nodeName)
+	staging := fmt.Sprintf("/files/%02d", index)
+	success, err := logger.Exec(cli, container, nodeName, "files", []string{"mkdir", "-p", staging})
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("preparing the copy of %s failed", file.Source)
+	}
 
-	go func(id string) {
-		cli.ContainerWait(context.Background(), id)
-	}(node.ID)
+	name := path.Base(file.Destination)
+	if err := docker.CopyToContainer(context.Background(), cli, container, file.Source, staging+"/"+name); err != nil {
+		return fmt.Errorf("copying %s to node %s failed: %v", file.Source, nodeName, err)
+	}
 
+	dir := path.Dir(file.Destination)
+	success, err = logger.Exec(cli, container, nodeName, "files", []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo mkdir -p %s && tar -C %s -cf - %s | ssh.sh sudo tar -C %s -xf -", dir, staging, name, dir)})
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("copying %s to %s on node %s failed", file.Source, file.Destination, nodeName)
+	}
 	return nil
 }
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVMCommand(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skipf("bash is not available: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		qemuArgs string
+	}{
+		{name: "no args", qemuArgs: ""},
+		{name: "serial and monitor", qemuArgs: " -serial file:/console.log -monitor telnet:127.0.0.1:4501,server,nowait"},
+		{name: "double quotes", qemuArgs: `-fw_cfg name=opt/config,string="a b"`},
+		{name: "single quotes and variables", qemuArgs: "-smbios 'type=1,serial=$HOME' -name `id`"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command := vmCommand("3096M", 2, tt.qemuArgs)
+			// Print the arguments which vm.sh would get
+			script := "vm() { printf '%s\\n' \"$@\"; }; " + strings.Replace(command, "/vm.sh", "vm", 1)
+			out, err := exec.Command(bash, "-c", script).Output()
+			if err != nil {
+				t.Fatalf("failed to run %s: %v", command, err)
+			}
+			expected := []string{"-n", "/var/run/disk/disk.qcow2", "--memory", "3096M", "--cpu", "2", "--qemu-args", tt.qemuArgs}
+			if args := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); !reflect.DeepEqual(args, expected) {
+				t.Errorf("expected %q, got %q", expected, args)
+			}
+		})
+	}
+}
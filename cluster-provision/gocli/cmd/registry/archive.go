@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// saveManifest is the manifest.json entry of the archive written by docker save,
+// Config and Layers are paths in the archive
+type saveManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// archiveBlob is a file of the archive which was spooled to disk in the form in which it is uploaded
+type archiveBlob struct {
+	file string
+	desc descriptor
+}
+
+// saveArchive is an archive of docker save whose blobs were spooled to disk. Docker before 25 writes
+// the legacy layout with <id>/layer.tar and <config digest>.json, newer versions the OCI layout with
+// blobs/sha256/<digest>. Both list the paths of the config and the layers in manifest.json.
+type saveArchive struct {
+	manifests []saveManifest
+	blobs     map[string]archiveBlob
+	links     map[string]string
+}
+
+// readSaveArchive reads the archive and spools the files which may be configs or layers into the directory.
+// JSON files and compressed layers are kept as they are, uncompressed layers are gzip compressed.
+func readSaveArchive(in io.Reader, dir string) (*saveArchive, error) {
+	archive := &saveArchive{
+		blobs: map[string]archiveBlob{},
+		links: map[string]string{},
+	}
+
+	reader := tar.NewReader(in)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		name := path.Clean(header.Name)
+
+		switch {
+		case name == "manifest.json":
+			if err := json.NewDecoder(reader).Decode(&archive.manifests); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest.json: %v", err)
+			}
+		case !isBlobPath(name):
+			continue
+		case header.Typeflag == tar.TypeSymlink || header.Typeflag == tar.TypeLink:
+			// Layers which are shared between images are linked to the first copy
+			target := header.Linkname
+			if header.Typeflag == tar.TypeSymlink {
+				target = path.Join(path.Dir(name), target)
+			}
+			archive.links[name] = path.Clean(target)
+		case header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA:
+			blob, err := spoolBlob(reader, filepath.Join(dir, fmt.Sprintf("%d", len(archive.blobs))))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %v", name, err)
+			}
+			archive.blobs[name] = *blob
+		}
+	}
+
+	if len(archive.manifests) != 1 {
+		return nil, fmt.Errorf("expected one image in the archive, found %d", len(archive.manifests))
+	}
+	return archive, nil
+}
+
+// isBlobPath returns true for the files which contain the config or a layer in one of the layouts
+func isBlobPath(name string) bool {
+	switch {
+	case strings.HasSuffix(name, "/layer.tar"):
+		return true
+	case strings.HasPrefix(name, "blobs/"):
+		return true
+	case !strings.Contains(name, "/") && strings.HasSuffix(name, ".json"):
+		return name != "index.json"
+	}
+	return false
+}
+
+// blob returns the spooled blob of the path in the archive
+func (a *saveArchive) blob(name string) (*archiveBlob, error) {
+	name = path.Clean(name)
+	for i := 0; i < 10; i++ {
+		if blob, exists := a.blobs[name]; exists {
+			return &blob, nil
+		}
+		target, linked := a.links[name]
+		if !linked {
+			break
+		}
+		name = target
+	}
+	return nil, fmt.Errorf("%s is missing in the archive", name)
+}
+
+// image returns the config and the layers of the image in the archive
+func (a *saveArchive) image() (*archiveBlob, []archiveBlob, error) {
+	m := a.manifests[0]
+	config, err := a.blob(m.Config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("the config: %v", err)
+	}
+	config.desc.MediaType = mediaTypeConfig
+
+	layers := []archiveBlob{}
+	for _, name := range m.Layers {
+		layer, err := a.blob(name)
+		if err != nil {
+			return nil, nil, fmt.Errorf("the layer: %v", err)
+		}
+		if layer.desc.MediaType != mediaTypeLayer {
+			return nil, nil, fmt.Errorf("the layer %s is neither a tar archive nor gzip compressed", name)
+		}
+		layers = append(layers, *layer)
+	}
+	return config, layers, nil
+}
+
+// spoolBlob writes the content to the file, uncompressed tar archives are compressed on the way
+func spoolBlob(content io.Reader, file string) (*archiveBlob, error) {
+	buffered := bufio.NewReaderSize(content, 1024)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	mediaType := ""
+	var in io.Reader = buffered
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		mediaType = mediaTypeLayer
+	case bytes.HasPrefix(bytes.TrimSpace(head), []byte("{")):
+		mediaType = mediaTypeConfig
+	case isTar(head):
+		mediaType = mediaTypeLayer
+		in = gzipStream(buffered)
+	}
+
+	out, err := os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveBlob{
+		file: file,
+		desc: descriptor{MediaType: mediaType, Size: size, Digest: fmt.Sprintf("sha256:%x", hash.Sum(nil))},
+	}, nil
+}
+
+// isTar returns true for the header of a tar archive, an empty archive consists of zero blocks only
+func isTar(head []byte) bool {
+	if len(head) < 512 {
+		return false
+	}
+	return bytes.Equal(head[257:262], []byte("ustar")) || bytes.Count(head, []byte{0}) == len(head)
+}
+
+// gzipStream compresses the reader on the fly
+func gzipStream(in io.Reader) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		compressor := gzip.NewWriter(writer)
+		_, err := io.Copy(compressor, in)
+		if err == nil {
+			err = compressor.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+	return reader
+}
@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/docker/docker/client"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+const (
+	mediaTypeManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeConfig   = "application/vnd.docker.container.image.v1+json"
+	mediaTypeLayer    = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+)
+
+type descriptor struct {
+	MediaType string `json:"mediaType"`
+	Size      int64  `json:"size"`
+	Digest    string `json:"digest"`
+}
+
+type manifest struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	MediaType     string       `json:"mediaType"`
+	Config        descriptor   `json:"config"`
+	Layers        []descriptor `json:"layers"`
+}
+
+// registryClient talks the docker registry v2 API with the registry of the cluster.
+// The connections are tunneled through netcat in the registry container,
+// so that the registry port does not need to be published on the host.
+type registryClient struct {
+	http *http.Client
+	base string
+}
+
+func newRegistryClient(cli *client.Client, container string) *registryClient {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return docker.DialExec(ctx, cli, container, []string{"nc", "127.0.0.1", strconv.Itoa(utils.PortRegistry)})
+		},
+	}
+	return &registryClient{
+		http: &http.Client{Transport: transport},
+		base: fmt.Sprintf("http://registry:%d", utils.PortRegistry),
+	}
+}
+
+func (r *registryClient) do(method string, path string, contentType string, body io.Reader, expected int) (*http.Response, error) {
+	target := path
+	if u, err := url.Parse(path); err == nil && !u.IsAbs() {
+		target = r.base + path
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expected {
+		defer resp.Body.Close()
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return nil, &statusError{code: resp.StatusCode, msg: fmt.Sprintf("%s %s returned %s: %s", method, path, resp.Status, bytes.TrimSpace(msg))}
+	}
+	return resp, nil
+}
+
+// blobExists returns true if the repository already contains the blob
+func (r *registryClient) blobExists(repository string, digest string) (bool, error) {
+	resp, err := r.do("HEAD", fmt.Sprintf("/v2/%s/blobs/%s", repository, digest), "", nil, http.StatusOK)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+	if statusErr, ok := err.(*statusError); ok && statusErr.code == http.StatusNotFound {
+		return false, nil
+	}
+	return false, err
+}
+
+// uploadBlob streams the content into a new blob of the repository, the registry verifies the digest
+func (r *registryClient) uploadBlob(repository string, digest string, content io.Reader) error {
+	resp, err := r.do("POST", fmt.Sprintf("/v2/%s/blobs/uploads/", repository), "", nil, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	resp, err = r.do("PATCH", resp.Header.Get("Location"), "application/octet-stream", content, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		return err
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	resp, err = r.do("PUT", location.String(), "", nil, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *registryClient) putManifest(repository string, tag string, m *manifest) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	resp, err := r.do("PUT", fmt.Sprintf("/v2/%s/manifests/%s", repository, tag), mediaTypeManifest, bytes.NewReader(data), http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (r *registryClient) repositories() ([]string, error) {
+	catalog := struct {
+		Repositories []string `json:"repositories"`
+	}{}
+	if err := r.getJSON("/v2/_catalog?n=10000", &catalog); err != nil {
+		return nil, err
+	}
+	return catalog.Repositories, nil
+}
+
+func (r *registryClient) tags(repository string) ([]string, error) {
+	tags := struct {
+		Tags []string `json:"tags"`
+	}{}
+	if err := r.getJSON(fmt.Sprintf("/v2/%s/tags/list", repository), &tags); err != nil {
+		return nil, err
+	}
+	return tags.Tags, nil
+}
+
+func (r *registryClient) getJSON(path string, v interface{}) error {
+	resp, err := r.do("GET", path, "", nil, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError is returned for responses with an unexpected status code
+type statusError struct {
+	code int
+	msg  string
+}
+
+func (e *statusError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,175 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewGarbageCollectCommand returns command to garbage-collect the blobs of the cluster registry
+func NewGarbageCollectCommand() *cobra.Command {
+	gc := &cobra.Command{
+		Use:   "gc",
+		Short: "gc removes the blobs which are not referenced by any manifest from the registry of the cluster",
+		Long: `gc removes the blobs which are not referenced by any manifest from the registry of the cluster
+
+Blobs are only released once no manifest references them anymore, so pushing
+a tag again leaves the layers of the previous image behind until gc is run.
+
+The garbage collection is refused when the registry volume is shared with the
+registries of other clusters, since it would remove blobs they are uploading.
+The registry is stopped during the garbage collection, which runs in a
+temporary container on the storage of the registry, so that no push can race
+with it. A dry run inspects the running registry.
+`,
+		RunE: gc,
+		Args: cobra.NoArgs,
+	}
+
+	gc.Flags().Bool("dry-run", false, "only print the blobs which would be removed")
+	gc.Flags().Bool("delete-untagged", false, "also remove the manifests which are not referenced by any tag")
+
+	return gc
+}
+
+func gc(cmd *cobra.Command, _ []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return err
+	}
+
+	deleteUntagged, err := cmd.Flags().GetBool("delete-untagged")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	registry := prefix + "-registry"
+	if err := ensureExclusiveStorage(cli, registry); err != nil {
+		return err
+	}
+
+	args := []string{"registry", "garbage-collect"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+	if deleteUntagged {
+		args = append(args, "--delete-untagged")
+	}
+	args = append(args, "/etc/docker/registry/config.yml")
+
+	if dryRun {
+		success, err := docker.Exec(cli, registry, args, cmd.OutOrStdout())
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("garbage collection of the registry failed")
+		}
+		return nil
+	}
+
+	return collectStopped(cli, registry, args, cmd.OutOrStdout(), cmd.OutOrStderr())
+}
+
+// collectStopped stops the registry, runs the garbage collection in a temporary container
+// with the environment and the mounts of the registry and starts the registry again
+func collectStopped(cli *client.Client, registry string, args []string, stdout io.Writer, stderr io.Writer) (err error) {
+	ctx := context.Background()
+	containerJSON, err := cli.ContainerInspect(ctx, registry)
+	if err != nil {
+		return err
+	}
+
+	mounts := []mount.Mount{}
+	for _, m := range containerJSON.Mounts {
+		source := m.Source
+		if m.Type == mount.TypeVolume {
+			source = m.Name
+		}
+		mounts = append(mounts, mount.Mount{Type: m.Type, Source: source, Target: m.Destination})
+	}
+
+	timeout := 30 * time.Second
+	fmt.Fprintf(stdout, "Stop the registry %s during the garbage collection\n", registry)
+	if err := cli.ContainerStop(ctx, containerJSON.ID, &timeout); err != nil {
+		return err
+	}
+	defer func() {
+		if startErr := cli.ContainerStart(ctx, containerJSON.ID, types.ContainerStartOptions{}); startErr != nil && err == nil {
+			err = fmt.Errorf("failed to start the registry %s again: %v", registry, startErr)
+		}
+	}()
+
+	gc, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: containerJSON.Image,
+		Env:   containerJSON.Config.Env,
+		Cmd:   args,
+	}, &container.HostConfig{
+		Mounts:      mounts,
+		Privileged:  true,
+		NetworkMode: "none",
+	}, nil, registry+"-gc")
+	if err != nil {
+		return err
+	}
+	defer cli.ContainerRemove(ctx, gc.ID, types.ContainerRemoveOptions{Force: true})
+
+	if err := cli.ContainerStart(ctx, gc.ID, types.ContainerStartOptions{}); err != nil {
+		return err
+	}
+	exitCode, err := cli.ContainerWait(ctx, gc.ID)
+	if err != nil {
+		return err
+	}
+	if err := docker.ContainerLogs(cli, gc.ID, stdout, stderr); err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("garbage collection of the registry failed with exit code %d", exitCode)
+	}
+	return nil
+}
+
+// ensureExclusiveStorage fails if the storage volume of the registry is mounted by other containers
+func ensureExclusiveStorage(cli *client.Client, registry string) error {
+	containerJSON, err := cli.ContainerInspect(context.Background(), registry)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range containerJSON.Mounts {
+		if m.Type != mount.TypeVolume {
+			continue
+		}
+		users, err := docker.GetVolumeContainers(cli, m.Name)
+		if err != nil {
+			return err
+		}
+		for _, c := range users {
+			if c.ID != containerJSON.ID {
+				return fmt.Errorf("the volume %s is shared with %s, stop it before the garbage collection", m.Name, strings.TrimPrefix(c.Names[0], "/"))
+			}
+		}
+	}
+	return nil
+}
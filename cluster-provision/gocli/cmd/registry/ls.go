@@ -0,0 +1,52 @@
+package registry
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewListCommand returns command to list the repositories and tags of the cluster registry
+func NewListCommand() *cobra.Command {
+	ls := &cobra.Command{
+		Use:   "ls",
+		Short: "ls lists the repositories and tags of the registry of the cluster",
+		RunE:  ls,
+		Args:  cobra.NoArgs,
+	}
+	return ls
+}
+
+func ls(cmd *cobra.Command, _ []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	registry := newRegistryClient(cli, prefix+"-registry")
+	repositories, err := registry.repositories()
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(repositories)
+	for _, repository := range repositories {
+		tags, err := registry.tags(repository)
+		if err != nil {
+			return err
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s:%s\n", repository, tag)
+		}
+	}
+	return nil
+}
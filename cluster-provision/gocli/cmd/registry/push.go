@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewPushCommand returns command to push images from the host into the cluster registry
+func NewPushCommand() *cobra.Command {
+	push := &cobra.Command{
+		Use:   "push IMAGE[:TAG]...",
+		Short: "push copies images from the host docker daemon into the registry of the cluster",
+		Long: `push copies images from the host docker daemon into the registry of the cluster
+
+The images are streamed through the docker API into the registry container,
+so the registry port does not need to be published on the host. The registry
+domain of the image is dropped, so 'localhost:5000/kubevirt/virt-api:devel'
+is available as 'registry:5000/kubevirt/virt-api:devel' inside the cluster.
+
+The layers are only uploaded if the registry does not contain them yet. The
+manifest is rebuilt by the push, so images referenced only by digest are
+refused, push a tag of them instead.
+`,
+		RunE: push,
+		Args: cobra.MinimumNArgs(1),
+	}
+	return push
+}
+
+func push(cmd *cobra.Command, args []string) error {
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	registry := newRegistryClient(cli, prefix+"-registry")
+	for _, image := range args {
+		repository, tag, err := splitImage(image)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Push the image %s as %s:%s\n", image, repository, tag)
+		if err := pushImage(cli, registry, image, repository, tag, cmd.OutOrStdout()); err != nil {
+			return fmt.Errorf("failed to push the image %s: %v", image, err)
+		}
+	}
+	return nil
+}
+
+// pushImage spools the archive of docker save, uploads the config and the layers which
+// the repository does not contain yet and puts the manifest once all blobs are uploaded
+func pushImage(cli *client.Client, registry *registryClient, image string, repository string, tag string, out io.Writer) error {
+	saved, err := cli.ImageSave(context.Background(), []string{image})
+	if err != nil {
+		return err
+	}
+	defer saved.Close()
+
+	dir, err := ioutil.TempDir("", "gocli-push")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := readSaveArchive(saved, dir)
+	if err != nil {
+		return err
+	}
+	config, layers, err := archive.image()
+	if err != nil {
+		return err
+	}
+
+	m := &manifest{
+		SchemaVersion: 2,
+		MediaType:     mediaTypeManifest,
+		Config:        config.desc,
+	}
+	for _, blob := range append([]archiveBlob{*config}, layers...) {
+		if err := ensureBlob(registry, repository, &blob, out); err != nil {
+			return err
+		}
+		if blob.desc.MediaType == mediaTypeLayer {
+			m.Layers = append(m.Layers, blob.desc)
+		}
+	}
+
+	return registry.putManifest(repository, tag, m)
+}
+
+// ensureBlob uploads the blob unless the repository already contains it
+func ensureBlob(registry *registryClient, repository string, blob *archiveBlob, out io.Writer) error {
+	exists, err := registry.blobExists(repository, blob.desc.Digest)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Fprintf(out, "%s: already exists\n", blob.desc.Digest)
+		return nil
+	}
+
+	content, err := os.Open(blob.file)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	if err := registry.uploadBlob(repository, blob.desc.Digest, content); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "%s: pushed %d bytes\n", blob.desc.Digest, blob.desc.Size)
+	return nil
+}
+
+// splitImage returns the repository without the registry domain and the tag of the image.
+// The manifest is rebuilt by the push, so it can not keep a digest, references by digest need a tag.
+func splitImage(image string) (string, string, error) {
+	parts := strings.SplitN(image, "@", 2)
+	repository := parts[0]
+	tag := ""
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		tag = repository[i+1:]
+		repository = repository[:i]
+	}
+	if tag == "" {
+		if len(parts) == 2 {
+			return "", "", fmt.Errorf("the image %s is referenced by digest, the pushed manifest has another digest, tag the image and push the tag", image)
+		}
+		tag = "latest"
+	}
+	if repository == "" {
+		return "", "", fmt.Errorf("the image %s has no repository", image)
+	}
+
+	parts = strings.SplitN(repository, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		repository = parts[1]
+	}
+	return repository, tag, nil
+}
@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSplitImage(t *testing.T) {
+	tests := []struct {
+		image      string
+		repository string
+		tag        string
+		fails      bool
+	}{
+		{image: "kubevirt/virt-api", repository: "kubevirt/virt-api", tag: "latest"},
+		{image: "kubevirt/virt-api:devel", repository: "kubevirt/virt-api", tag: "devel"},
+		{image: "localhost:5000/kubevirt/virt-api:devel", repository: "kubevirt/virt-api", tag: "devel"},
+		{image: "localhost/kubevirt/virt-api", repository: "kubevirt/virt-api", tag: "latest"},
+		{image: "quay.io/kubevirt/virt-api:v0.20.0", repository: "kubevirt/virt-api", tag: "v0.20.0"},
+		{image: "registry:5000/virt-api", repository: "virt-api", tag: "latest"},
+		{image: "kubevirt/virt-api:devel@sha256:0123", repository: "kubevirt/virt-api", tag: "devel"},
+		{image: "kubevirt/virt-api@sha256:0123", fails: true},
+		{image: "localhost:5000/kubevirt/virt-api@sha256:0123", fails: true},
+		{image: ":devel", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			repository, tag, err := splitImage(tt.image)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s:%s", repository, tag)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if repository != tt.repository || tag != tt.tag {
+				t.Errorf("expected %s:%s, got %s:%s", tt.repository, tt.tag, repository, tag)
+			}
+		})
+	}
+}
+
+type archiveEntry struct {
+	name     string
+	content  []byte
+	linkname string
+}
+
+func writeArchive(t *testing.T, entries []archiveEntry) *bytes.Buffer {
+	buf := new(bytes.Buffer)
+	writer := tar.NewWriter(buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.linkname != "" {
+			header.Typeflag = tar.TypeSymlink
+			header.Linkname = e.linkname
+			header.Size = 0
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write(e.content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf
+}
+
+// layerTar returns a tar archive with one file, like a layer of docker save
+func layerTar(t *testing.T, content string) []byte {
+	return writeArchive(t, []archiveEntry{{name: "etc/file", content: []byte(content)}}).Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	buf := new(bytes.Buffer)
+	writer := gzip.NewWriter(buf)
+	if _, err := writer.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func digest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+func TestReadSaveArchive(t *testing.T) {
+	config := []byte(`{"architecture":"amd64","rootfs":{"type":"layers"}}`)
+	layer1 := layerTar(t, "one")
+	layer2 := layerTar(t, "two")
+	compressed := gzipped(t, layerTar(t, "three"))
+
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		layers  int
+		// compressedLayer is the index of a layer which is kept as it is, -1 if all layers are compressed by the push
+		compressedLayer int
+		fails           bool
+	}{
+		{
+			name: "legacy layout",
+			entries: []archiveEntry{
+				{name: "aaa/VERSION", content: []byte("1.0")},
+				{name: "aaa/json", content: []byte(`{"id":"aaa"}`)},
+				{name: "aaa/layer.tar", content: layer1},
+				{name: "bbb/layer.tar", content: layer2},
+				{name: "0123.json", content: config},
+				{name: "manifest.json", content: []byte(`[{"Config":"0123.json","RepoTags":["kubevirt/virt-api:devel"],"Layers":["aaa/layer.tar","bbb/layer.tar"]}]`)},
+				{name: "repositories", content: []byte(`{}`)},
+			},
+			layers:          2,
+			compressedLayer: -1,
+		},
+		{
+			name: "legacy layout with a linked layer",
+			entries: []archiveEntry{
+				{name: "aaa/layer.tar", content: layer1},
+				{name: "bbb/layer.tar", linkname: "../aaa/layer.tar"},
+				{name: "0123.json", content: config},
+				{name: "manifest.json", content: []byte(`[{"Config":"0123.json","Layers":["aaa/layer.tar","bbb/layer.tar"]}]`)},
+			},
+			layers:          2,
+			compressedLayer: -1,
+		},
+		{
+			name: "OCI layout with the manifest first",
+			entries: []archiveEntry{
+				{name: "oci-layout", content: []byte(`{"imageLayoutVersion":"1.0.0"}`)},
+				{name: "index.json", content: []byte(`{"schemaVersion":2}`)},
+				{name: "manifest.json", content: []byte(`[{"Config":"blobs/sha256/c0","Layers":["blobs/sha256/l1","blobs/sha256/l2","blobs/sha256/l3"]}]`)},
+				{name: "blobs/sha256/m0", content: []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)},
+				{name: "blobs/sha256/c0", content: config},
+				{name: "blobs/sha256/l1", content: layer1},
+				{name: "blobs/sha256/l2", content: layer2},
+				{name: "blobs/sha256/l3", content: compressed},
+			},
+			layers:          3,
+			compressedLayer: 2,
+		},
+		{
+			name: "missing config",
+			entries: []archiveEntry{
+				{name: "blobs/sha256/l1", content: layer1},
+				{name: "manifest.json", content: []byte(`[{"Config":"blobs/sha256/c0","Layers":["blobs/sha256/l1"]}]`)},
+			},
+			fails: true,
+		},
+		{
+			name: "layer which is no tar archive",
+			entries: []archiveEntry{
+				{name: "blobs/sha256/c0", content: config},
+				{name: "blobs/sha256/l1", content: []byte("no tar archive")},
+				{name: "manifest.json", content: []byte(`[{"Config":"blobs/sha256/c0","Layers":["blobs/sha256/l1"]}]`)},
+			},
+			fails: true,
+		},
+		{
+			name: "several images",
+			entries: []archiveEntry{
+				{name: "manifest.json", content: []byte(`[{"Config":"a.json"},{"Config":"b.json"}]`)},
+			},
+			fails: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gocli-push")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			archive, err := readSaveArchive(writeArchive(t, tt.entries), dir)
+			var configBlob *archiveBlob
+			var layers []archiveBlob
+			if err == nil {
+				configBlob, layers, err = archive.image()
+			}
+			if tt.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if configBlob.desc.Digest != digest(config) || configBlob.desc.MediaType != mediaTypeConfig {
+				t.Errorf("expected the config %s, got %+v", digest(config), configBlob.desc)
+			}
+			if len(layers) != tt.layers {
+				t.Fatalf("expected %d layers, got %d", tt.layers, len(layers))
+			}
+			for i, layer := range layers {
+				content, err := ioutil.ReadFile(layer.file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if layer.desc.MediaType != mediaTypeLayer || layer.desc.Digest != digest(content) || layer.desc.Size != int64(len(content)) {
+					t.Errorf("layer %d has the descriptor %+v, which does not match its content", i, layer.desc)
+				}
+				if i == tt.compressedLayer && !bytes.Equal(content, compressed) {
+					t.Errorf("layer %d was compressed again", i)
+				}
+				if i != tt.compressedLayer {
+					reader, err := gzip.NewReader(bytes.NewReader(content))
+					if err != nil {
+						t.Fatalf("layer %d is not gzip compressed: %v", i, err)
+					}
+					uncompressed, err := ioutil.ReadAll(reader)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !bytes.Equal(uncompressed, layer1) && !bytes.Equal(uncompressed, layer2) {
+						t.Errorf("layer %d does not contain the layer of the archive", i)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package registry
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// NewRegistryCommand returns command to interact with the registry of the cluster
+func NewRegistryCommand() *cobra.Command {
+
+	registry := &cobra.Command{
+		Use:   "registry",
+		Short: "registry interacts with the private image registry of the cluster",
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Fprint(cmd.OutOrStderr(), cmd.UsageString())
+		},
+	}
+
+	registry.AddCommand(
+		NewGarbageCollectCommand(),
+		NewListCommand(),
+		NewPushCommand(),
+	)
+
+	return registry
+}
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
@@ -14,9 +17,20 @@ func NewRemoveCommand() *cobra.Command {
 	port := &cobra.Command{
 		Use:   "rm",
 		Short: "rm deletes all traces of a cluster",
-		RunE:  rm,
-		Args:  cobra.NoArgs,
+		Long: `rm deletes all traces of a cluster
+
+Shared volumes, like the registry cache passed via 'run --registry-volume', are kept
+so that other clusters and the next run can reuse them. Pass --purge to remove them too,
+they are only removed if no other cluster uses them anymore. Volumes which existed before
+gocli labeled them as shared are kept by rm and are not removed by --purge. Docker
+daemons older than API 1.23 do not store the labels of volumes, --purge fails with them.
+`,
+		RunE: rm,
+		Args: cobra.NoArgs,
 	}
+
+	port.Flags().Bool("purge", false, "also remove the shared volumes of the cluster which are not used by other clusters")
+
 	return port
 }
 
@@ -27,16 +41,30 @@ func rm(cmd *cobra.Command, _ []string) error {
 		return err
 	}
 
-	cli, err := client.NewEnvClient()
+	purge, err := cmd.Flags().GetBool("purge")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
 
+	// Older daemons neither store the labels of volumes nor list the mounts of containers,
+	// the shared volumes are then only known via SharedVolumesLabel of the containers
+	if purge && !docker.SupportsAPI(cli, docker.APIVersionVolumeLabels) {
+		return fmt.Errorf("--purge needs the docker API %s to find the shared volumes, gocli speaks %s with the daemon, run rm without --purge to keep them", docker.APIVersionVolumeLabels, cli.ClientVersion())
+	}
+
 	containers, err := docker.GetPrefixedContainers(cli, prefix+"-")
 	if err != nil {
 		return err
 	}
 
+	// Shared volumes which were created without the label are known via the containers which mount them
+	labeledByContainers := docker.GetSharedVolumeNames(containers)
+
 	for _, c := range containers {
 		err := cli.ContainerRemove(context.Background(), c.ID, types.ContainerRemoveOptions{Force: true})
 		if err != nil {
@@ -50,11 +78,57 @@ func rm(cmd *cobra.Command, _ []string) error {
 	}
 
 	for _, v := range volumes {
+		if docker.IsSharedVolume(v) || labeledByContainers[v.Name] {
+			continue
+		}
 		err := cli.VolumeRemove(context.Background(), v.Name, true)
 		if err != nil {
 			return err
 		}
 	}
 
+	if !purge {
+		return nil
+	}
+
+	// Shared volumes do not need to carry the prefix, find them via the mounts of the removed containers
+	shared := map[string]bool{}
+	for _, v := range volumes {
+		if docker.IsSharedVolume(v) {
+			shared[v.Name] = true
+		}
+	}
+	for _, name := range docker.GetMountedVolumes(containers) {
+		shared[name] = true
+	}
+
+	for name := range shared {
+		v, err := cli.VolumeInspect(context.Background(), name)
+		if client.IsErrNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !docker.IsSharedVolume(&v) {
+			continue
+		}
+
+		users, err := docker.GetVolumeContainers(cli, name)
+		if err != nil {
+			return err
+		}
+		if len(users) > 0 {
+			fmt.Fprintf(cmd.OutOrStderr(), "Keep the volume %s, it is still used by %s\n", name, strings.TrimPrefix(users[0].Names[0], "/"))
+			continue
+		}
+
+		// Do not force the removal, the daemon refuses to remove a volume which a cluster that started
+		// in the meantime uses already. A cluster which creates its container right after the removal
+		// notices that the volume lost its label and creates it again, see docker.CreateSharedVolumeContainer.
+		if err := cli.VolumeRemove(context.Background(), name, false); err != nil {
+			fmt.Fprintf(cmd.OutOrStderr(), "Keep the volume %s: %v\n", name, err)
+		}
+	}
+
 	return nil
 }
@@ -5,13 +5,10 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
-)
 
-func init() {
-	if os.Getenv("DOCKER_API_VERSION") == "" {
-		os.Setenv("DOCKER_API_VERSION", "1.24")
-	}
-}
+	"kubevirt.io/kubevirtci/gocli/cmd/ceph"
+	"kubevirt.io/kubevirtci/gocli/cmd/registry"
+)
 
 // NewRootCommand returns entrypoint command to interact with all other commands
 func NewRootCommand() *cobra.Command {
@@ -29,12 +26,25 @@ func NewRootCommand() *cobra.Command {
 	root.PersistentFlags().StringP("prefix", "p", "kubevirt", "Prefix to identify docker containers")
 
 	root.AddCommand(
+		NewBaseCommand(),
+		NewBuildCommand(),
+		ceph.NewCephCommand(),
+		NewDoctorCommand(),
+		NewDownCommand(),
+		NewEnvCommand(),
+		NewExecCommand(),
+		NewLockCommand(),
+		NewMustGatherCommand(),
 		NewPortCommand(),
 		NewProvisionCommand(),
 		NewRemoveCommand(),
+		registry.NewRegistryCommand(),
 		NewRunCommand(),
 		NewSSHCommand(),
+		NewStatusCommand(),
 		NewSCPCommand(),
+		NewUpCommand(),
+		NewVersionCommand(),
 	)
 
 	return root
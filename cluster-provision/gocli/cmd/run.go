@@ -6,9 +6,8 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
 	"sync"
-	"text/template"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -20,30 +19,12 @@ import (
 	"github.com/spf13/cobra"
 	"golang.org/x/net/context"
 
+	"kubevirt.io/kubevirtci/gocli/cmd/ceph"
 	"kubevirt.io/kubevirtci/gocli/cmd/okd"
 	"kubevirt.io/kubevirtci/gocli/cmd/utils"
 	"kubevirt.io/kubevirtci/gocli/docker"
 )
 
-const proxySettings = `
-mkdir -p /etc/systemd/system/docker.service.d/
-
-cat <<EOT  >/etc/systemd/system/docker.service.d/proxy.conf
-[Service]
-Environment="HTTP_PROXY={{.Proxy}}"
-Environment="HTTPS_PROXY={{.Proxy}}"
-Environment="NO_PROXY=localhost,127.0.0.1"
-EOT
-
-systemctl daemon-reload
-systemctl restart docker
-EOF
-`
-
-type dockerSetting struct {
-	Proxy string
-}
-
 // NewRunCommand returns command that runs given cluster
 func NewRunCommand() *cobra.Command {
 
@@ -51,7 +32,7 @@ func NewRunCommand() *cobra.Command {
 		Use:   "run",
 		Short: "run starts a given cluster",
 		RunE:  run,
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
 	}
 	run.Flags().UintP("nodes", "n", 1, "number of cluster nodes to start")
 	run.Flags().StringP("memory", "m", "3096M", "amount of ram per node")
@@ -61,18 +42,35 @@ func NewRunCommand() *cobra.Command {
 	run.Flags().BoolP("reverse", "r", false, "revert node startup order")
 	run.Flags().Bool("random-ports", true, "expose all ports on random localhost ports")
 	run.Flags().String("registry-volume", "", "cache docker registry content in the specified volume")
+	run.Flags().String("registry-mirror", "", "pull the images of the listed upstream registries through caching mirrors, in the format upstream=docker.io,quay.io, an entry can point to a different URL like docker.io=http://10.0.0.1:5000")
 	run.Flags().Uint("vnc-port", 0, "port on localhost for vnc")
 	run.Flags().Uint("registry-port", 0, "port on localhost for the docker registry")
 	run.Flags().Uint("ocp-port", 0, "port on localhost for the ocp cluster")
 	run.Flags().Uint("k8s-port", 0, "port on localhost for the k8s cluster")
 	run.Flags().Uint("ssh-port", 0, "port on localhost for ssh server")
 	run.Flags().String("nfs-data", "", "path to data which should be exposed via nfs to the nodes")
+	run.Flags().StringArray("share", nil, "shares a host directory with all nodes via virtio-9p, in the format /host/path:/guest/path[:ro], can be repeated")
 	run.Flags().String("log-to-dir", "", "enables aggregated cluster logging to the folder")
-	run.Flags().Bool("enable-ceph", false, "enables dynamic storage provisioning using Ceph")
-	run.Flags().String("docker-proxy", "", "sets network proxy for docker daemon")
+	run.Flags().String("log-format", utils.LogFormatJSON, "format of the aggregated logs: json keeps the whole records, text only the log lines")
+	run.Flags().Duration("log-rotate", time.Hour, "how often the aggregated log files are rotated, the rotated files are gzip compressed")
+	run.Flags().StringArray("hook", nil, "runs a host script on the nodes, in the format pre-provision|post-provision|post-cluster=./script.sh[@nodeNN], can be repeated")
+	ceph.AddFlags(run.Flags())
+	utils.AddNodeConfigFlags(run.Flags())
+	utils.AddKubeadmFlags(run.Flags())
+	run.Flags().StringArray("manifest", nil, "manifest file or directory of manifests to apply on node01 once the cluster is up, can be repeated, the manifests are applied in the given order")
+	run.Flags().Duration("manifest-timeout", 5*time.Minute, "how long to wait for each Deployment, DaemonSet, StatefulSet and CRD of the manifests to become ready")
+	run.Flags().StringArray("node-label", nil, "label to set on a node after it joined, in the format nodeNN=key=value, can be repeated")
+	run.Flags().StringArray("node-taint", nil, "taint to set on a node after it joined, in the format nodeNN=key[=value]:effect, can be repeated")
+	run.Flags().String("cni", "", "network plugin to deploy on top of flannel after kubeadm init from the manifests which gocli carries: flannel, multus, genie or ovs-cni, by default the plugin of the cluster image is kept")
+	utils.AddImageFlags(run.Flags())
+	run.Flags().String("pull", string(docker.PullAlways), "when to pull the cluster and sidecar images: always, missing or never")
+	run.Flags().String("provision-log-dir", "", "writes the provisioning output of every node and sidecar to one log file per phase in the folder")
+	run.Flags().String("artifacts-dir", "", "on failure, writes the consoles, screenshots and journals of the nodes, the container logs and the last provisioning output to the folder before cleaning up")
+	run.Flags().Bool("keep-on-failure", false, "keeps the containers and volumes when the run fails, to debug them")
+	run.Flags().Bool("preflight", true, "checks the host prerequisites like gocli doctor before any container is created, disable it to skip the checks")
 
 	run.AddCommand(
-		okd.NewRunCommand(),
+		okd.NewRunCommand(collectArtifacts),
 	)
 	return run
 }
@@ -127,59 +125,262 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
+	registryMirror, err := cmd.Flags().GetString("registry-mirror")
+	if err != nil {
+		return err
+	}
+
+	mirrors, err := utils.ParseRegistryMirrors(registryMirror)
+	if err != nil {
+		return err
+	}
+
 	nfsData, err := cmd.Flags().GetString("nfs-data")
 	if err != nil {
 		return err
 	}
 
+	shareValues, err := cmd.Flags().GetStringArray("share")
+	if err != nil {
+		return err
+	}
+
+	shares, err := utils.ParseShares(shareValues)
+	if err != nil {
+		return err
+	}
+
+	hookValues, err := cmd.Flags().GetStringArray("hook")
+	if err != nil {
+		return err
+	}
+
+	hooks, err := utils.ParseHooks(hookValues)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if hook.Node != "" && !nodeInCluster(hook.Node, nodes) {
+			return fmt.Errorf("the %s hook %s runs on %s, but the cluster only has %d nodes", hook.Phase, hook.Script, hook.Node, nodes)
+		}
+	}
+
 	logDir, err := cmd.Flags().GetString("log-to-dir")
 	if err != nil {
 		return err
 	}
 
-	dockerProxy, err := cmd.Flags().GetString("docker-proxy")
+	logFormat, err := cmd.Flags().GetString("log-format")
+	if err != nil {
+		return err
+	}
+	if err := utils.ValidateLogFormat(logFormat); err != nil {
+		return err
+	}
+
+	logRotate, err := cmd.Flags().GetDuration("log-rotate")
 	if err != nil {
 		return err
 	}
 
-	cephEnabled, err := cmd.Flags().GetBool("enable-ceph")
+	fluentdConfig := ""
+	if logDir != "" {
+		fluentdConfig, err = utils.GetLogAggregatorConfig(logFormat, logRotate)
+		if err != nil {
+			return err
+		}
+	}
+
+	nodeConfig, err := utils.ResolveNodeConfig(cmd.Flags())
 	if err != nil {
 		return err
 	}
 
-	cluster := args[0]
+	kubeadmConfig, err := utils.ResolveKubeadmConfig(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	nodeLabelValues, err := cmd.Flags().GetStringArray("node-label")
+	if err != nil {
+		return err
+	}
+
+	nodeLabels, err := utils.ParseNodeLabels(nodeLabelValues)
+	if err != nil {
+		return err
+	}
+
+	nodeTaintValues, err := cmd.Flags().GetStringArray("node-taint")
+	if err != nil {
+		return err
+	}
+
+	nodeTaints, err := utils.ParseNodeTaints(nodeTaintValues)
+	if err != nil {
+		return err
+	}
+
+	for _, label := range nodeLabels {
+		if !nodeInCluster(label.Node, nodes) {
+			return fmt.Errorf("the label %s is set on %s, but the cluster only has %d nodes", label, label.Node, nodes)
+		}
+	}
+	for _, taint := range nodeTaints {
+		if !nodeInCluster(taint.Node, nodes) {
+			return fmt.Errorf("the taint %s is set on %s, but the cluster only has %d nodes", taint, taint.Node, nodes)
+		}
+	}
+
+	cni, err := cmd.Flags().GetString("cni")
+	if err != nil {
+		return err
+	}
+
+	if err := utils.ValidateCNI(cni); err != nil {
+		return err
+	}
+
+	manifestPaths, err := cmd.Flags().GetStringArray("manifest")
+	if err != nil {
+		return err
+	}
+
+	manifests, err := resolveManifests(manifestPaths)
+	if err != nil {
+		return err
+	}
+
+	manifestTimeout, err := cmd.Flags().GetDuration("manifest-timeout")
+	if err != nil {
+		return err
+	}
+
+	cephConfig, err := ceph.ResolveConfig(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	pull, err := cmd.Flags().GetString("pull")
+	if err != nil {
+		return err
+	}
+
+	pullPolicy, err := docker.ParsePullPolicy(pull)
+	if err != nil {
+		return err
+	}
+
+	provisionLogDir, err := cmd.Flags().GetString("provision-log-dir")
+	if err != nil {
+		return err
+	}
+
+	logger, err := utils.NewProvisionLogger(provisionLogDir, cmd.OutOrStdout(), cmd.OutOrStderr())
+	if err != nil {
+		return err
+	}
+
+	images, err := utils.ResolveImages(cmd.Flags())
+	if err != nil {
+		return err
+	}
+
+	cluster := images.Cluster
+	if len(args) > 0 {
+		cluster = args[0]
+	}
+	if cluster == "" {
+		return fmt.Errorf("no cluster image specified, pass it as argument or via the images config")
+	}
 
 	background, err := cmd.Flags().GetBool("background")
 	if err != nil {
 		return err
 	}
 
-	cli, err := client.NewEnvClient()
+	artifactsDir, err := cmd.Flags().GetString("artifacts-dir")
 	if err != nil {
 		return err
 	}
 
+	keepOnFailure, err := cmd.Flags().GetBool("keep-on-failure")
+	if err != nil {
+		return err
+	}
+
+	preflight, err := cmd.Flags().GetBool("preflight")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if preflight {
+		checks := utils.Preflight(context.Background(), cli, utils.PreflightOptions{
+			Nodes:          nodes,
+			Memory:         memory,
+			RegistryVolume: registryVol,
+			Ports:          portMap,
+		})
+		utils.PrintChecks(cmd.OutOrStderr(), checks, false)
+		if err := utils.CheckError(checks); err != nil {
+			return fmt.Errorf("%v, fix them or skip the checks with --preflight=false", err)
+		}
+	}
+
 	b := context.Background()
 	ctx, cancel := context.WithCancel(b)
 
 	containers, volumes, done := docker.NewCleanupHandler(cli, cmd.OutOrStderr())
 
 	defer func() {
+		if err != nil && artifactsDir != "" {
+			if artifactsErr := collectArtifacts(cli, logger, prefix, artifactsDir, cmd.OutOrStderr()); artifactsErr != nil {
+				fmt.Fprintf(cmd.OutOrStderr(), "collecting the failure artifacts failed: %v\n", artifactsErr)
+			}
+		}
+		if err != nil && keepOnFailure {
+			fmt.Fprintf(cmd.OutOrStderr(), "Keep the containers of the failed run, remove them with: gocli --prefix %s rm\n", prefix)
+			done <- nil
+			return
+		}
 		done <- err
 	}()
 
+	// An interrupt only cancels the context, run returns utils.ErrInterrupted at the next step and the deferred
+	// function above cleans up, so that the failure artifacts and --keep-on-failure apply as well
 	go func() {
 		interrupt := make(chan os.Signal, 1)
 		signal.Notify(interrupt, os.Interrupt)
 		<-interrupt
+		fmt.Fprintln(cmd.OutOrStderr(), "Interrupt received, stopping after the current step")
 		cancel()
-		done <- fmt.Errorf("Interrupt received, clean up")
 	}()
 
 	// Pull the cluster image
-	err = docker.ImagePull(cli, ctx, "docker.io/"+cluster, types.ImagePullOptions{})
+	err = docker.EnsureImage(cli, ctx, cluster, pullPolicy)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	// Pull the sidecar images
+	sidecarImages := []string{images.Sidecars.DockerRegistry}
+	if nfsData != "" {
+		sidecarImages = append(sidecarImages, images.Sidecars.NFSGanesha)
+	}
+	if cephConfig.Enabled {
+		sidecarImages = append(sidecarImages, images.Sidecars.Ceph)
+	}
+	if logDir != "" {
+		sidecarImages = append(sidecarImages, images.Sidecars.Fluentd)
+	}
+	err = docker.EnsureImages(cli, ctx, sidecarImages, pullPolicy)
+	if err != nil {
+		return err
 	}
 
 	// Start dnsmasq
@@ -188,7 +389,8 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		Env: []string{
 			fmt.Sprintf("NUM_NODES=%d", nodes),
 		},
-		Cmd: []string{"/bin/bash", "-c", "/dnsmasq.sh"},
+		Labels: docker.ClusterLabels(prefix, cluster),
+		Cmd:    []string{"/bin/bash", "-c", "/dnsmasq.sh"},
 		ExposedPorts: nat.PortSet{
 			utils.TCPPortOrDie(utils.PortSSH):      {},
 			utils.TCPPortOrDie(utils.PortRegistry): {},
@@ -214,61 +416,67 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		return err
 	}
 
-	// Pull the registry image
-	err = docker.ImagePull(cli, ctx, utils.DockerRegistryImage, types.ImagePullOptions{})
-	if err != nil {
-		panic(err)
+	// Start registry
+	registryConfig := &container.Config{
+		Image: images.Sidecars.DockerRegistry,
 	}
-
-	// Create registry volume
-	var registryMounts []mount.Mount
+	registryHostConfig := &container.HostConfig{
+		Privileged:  true, // fixme we just need proper selinux volume labeling
+		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
+	}
+	var registry container.ContainerCreateCreatedBody
 	if registryVol != "" {
-
-		vol, err := cli.VolumeCreate(ctx, volume.VolumesCreateBody{
-			Name: fmt.Sprintf("%s-%s", prefix, "registry"),
-		})
+		// Several registries may write to the same volume, do not let them purge the uploads of each other
+		registryConfig.Env = []string{"REGISTRY_STORAGE_MAINTENANCE_UPLOADPURGING_ENABLED=false"}
+		// The volume caches the registry content across clusters, it is kept when the cluster is removed
+		var vol types.Volume
+		vol, registry, err = docker.CreateSharedVolumeContainer(ctx, cli, registryVol, "/var/lib/registry", registryConfig, registryHostConfig, prefix+"-registry")
 		if err != nil {
 			return err
 		}
-		registryMounts = []mount.Mount{
-			{
-				Type:   mount.TypeVolume,
-				Source: vol.Name,
-				Target: "/var/lib/registry",
-			},
+		if !docker.IsSharedVolume(&vol) {
+			fmt.Fprintf(cmd.OutOrStderr(), "The volume %s exists without the label %s, rm keeps it but rm --purge does not remove it\n", vol.Name, docker.SharedVolumeLabel)
+		}
+	} else {
+		registry, err = cli.ContainerCreate(ctx, registryConfig, registryHostConfig, nil, prefix+"-registry")
+		if err != nil {
+			return err
 		}
-	}
-
-	// Start registry
-	registry, err := cli.ContainerCreate(ctx, &container.Config{
-		Image: utils.DockerRegistryImage,
-	}, &container.HostConfig{
-		Mounts:      registryMounts,
-		Privileged:  true, // fixme we just need proper selinux volume labeling
-		NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
-	}, nil, prefix+"-registry")
-	if err != nil {
-		return err
 	}
 	containers <- registry.ID
 	if err := cli.ContainerStart(ctx, registry.ID, types.ContainerStartOptions{}); err != nil {
 		return err
 	}
 
-	if nfsData != "" {
-		nfsData, err := filepath.Abs(nfsData)
+	// Start the pull-through registry mirrors, their cache is kept in shared volumes which survive the cluster
+	for _, mirror := range mirrors {
+		vol, mirrorContainer, err := docker.CreateSharedVolumeContainer(ctx, cli, mirror.VolumeName(), "/var/lib/registry", &container.Config{
+			Image: images.Sidecars.DockerRegistry,
+			Env:   mirror.Env(),
+		}, &container.HostConfig{
+			Privileged:  true,
+			NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
+		}, prefix+"-"+mirror.Name())
 		if err != nil {
 			return err
 		}
-		// Pull the ganesha image
-		err = docker.ImagePull(cli, ctx, utils.NFSGaneshaImage, types.ImagePullOptions{})
-		if err != nil {
-			panic(err)
+		if !docker.IsSharedVolume(&vol) {
+			fmt.Fprintf(cmd.OutOrStderr(), "The volume %s exists without the label %s, rm keeps it but rm --purge does not remove it\n", vol.Name, docker.SharedVolumeLabel)
+		}
+		containers <- mirrorContainer.ID
+		if err := cli.ContainerStart(ctx, mirrorContainer.ID, types.ContainerStartOptions{}); err != nil {
+			return err
 		}
+	}
 
+	if nfsData != "" {
+		nfsData, err := filepath.Abs(nfsData)
+		if err != nil {
+			return err
+		}
 		// Start the ganesha image
 		nfsServer, err := cli.ContainerCreate(ctx, &container.Config{
-			Image: utils.NFSGaneshaImage,
+			Image: images.Sidecars.NFSGanesha,
 		}, &container.HostConfig{
 			Mounts: []mount.Mount{
 				{
@@ -289,21 +497,10 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
-	if cephEnabled {
-		// Pull Ceph image
-		err = docker.ImagePull(cli, ctx, utils.CephImage, types.ImagePullOptions{})
-		if err != nil {
-			panic(err)
-		}
-
+	if cephConfig.Enabled {
 		cephStorage, err := cli.ContainerCreate(ctx, &container.Config{
-			Image: utils.CephImage,
-			Env: []string{
-				"MON_IP=192.168.66.2",
-				"CEPH_PUBLIC_NETWORK=0.0.0.0/0",
-				"DEMO_DAEMONS=osd,mds",
-				"CEPH_DEMO_UID=demo",
-			},
+			Image: images.Sidecars.Ceph,
+			Env:   cephConfig.ContainerEnv(),
 			Cmd: strslice.StrSlice{
 				"demo",
 			},
@@ -318,6 +515,10 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		if err := cli.ContainerStart(ctx, cephStorage.ID, types.ContainerStartOptions{}); err != nil {
 			return err
 		}
+		// Fail before the nodes are provisioned if the image ignores the OSD settings
+		if err := ceph.VerifyImage(cli, cephStorage.ID, cephConfig); err != nil {
+			return err
+		}
 	}
 
 	if logDir != "" {
@@ -330,18 +531,15 @@ func run(cmd *cobra.Command, args []string) (err error) {
 			os.Mkdir(logDir, 0755)
 		}
 
-		// Pull the fluent image
-		err = docker.ImagePull(cli, ctx, utils.FluentdImage, types.ImagePullOptions{})
-		if err != nil {
-			panic(err)
-		}
-
-		// Start the fluent image
+		// Start the fluent image, the config is passed via the environment to keep the placeholders of fluentd intact
 		fluentd, err := cli.ContainerCreate(ctx, &container.Config{
-			Image: utils.FluentdImage,
+			Image: images.Sidecars.Fluentd,
+			Env: []string{
+				"FLUENTD_INLINE_CONFIG=" + fluentdConfig,
+			},
 			Cmd: strslice.StrSlice{
 				"exec fluentd",
-				"-i \"<system>\n log_level debug\n</system>\n<source>\n@type  forward\n@log_level error\nport  24224\n</source>\n<match **>\n@type file\npath /fluentd/log/collected\n</match>\"",
+				"-i \"$FLUENTD_INLINE_CONFIG\"",
 				"-p /fluentd/plugins $FLUENTD_OPT -v",
 			},
 		}, &container.HostConfig{
@@ -364,17 +562,24 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
+	// Labels and taints are set via the API server on node01, with --reverse node01 joins last
+	joinedNodes := []string{}
+	apiServerUp := false
+
 	wg := sync.WaitGroup{}
 	wg.Add(int(nodes))
 	// start one vm after each other
 	for x := 0; x < int(nodes); x++ {
+		if err := utils.Interrupted(ctx); err != nil {
+			return err
+		}
 
-		nodeName := nodeNameFromIndex(x + 1)
-		nodeNum := fmt.Sprintf("%02d", x+1)
+		nodeIndex := x + 1
 		if reverse {
-			nodeName = nodeNameFromIndex((int(nodes) - x))
-			nodeNum = fmt.Sprintf("%02d", (int(nodes) - x))
+			nodeIndex = int(nodes) - x
 		}
+		nodeName := nodeNameFromIndex(nodeIndex)
+		nodeNum := fmt.Sprintf("%02d", nodeIndex)
 
 		vol, err := cli.VolumeCreate(ctx, volume.VolumesCreateBody{
 			Name: fmt.Sprintf("%s-%s", prefix, nodeName),
@@ -384,8 +589,23 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 		volumes <- vol.Name
 
-		if len(qemuArgs) > 0 {
-			qemuArgs = "--qemu-args " + qemuArgs
+		nodeMounts := []mount.Mount{
+			{
+				Type:   "volume",
+				Source: vol.Name,
+				Target: "/var/run/disk",
+			},
+		}
+		// The serial console and the monitor are kept in the node container for must-gather and the failure artifacts
+		nodeQemuArgs := fmt.Sprintf("%s -serial file:%s -monitor telnet:127.0.0.1:%d,server,nowait", qemuArgs, nodeConsoleLog, utils.PortQEMUMonitor+nodeIndex)
+		for _, share := range shares {
+			nodeMounts = append(nodeMounts, mount.Mount{
+				Type:     mount.TypeBind,
+				Source:   share.HostPath,
+				Target:   share.ContainerPath(),
+				ReadOnly: share.ReadOnly,
+			})
+			nodeQemuArgs += " " + share.QemuArgs()
 		}
 		node, err := cli.ContainerCreate(ctx, &container.Config{
 			Image: cluster,
@@ -395,15 +615,9 @@ func run(cmd *cobra.Command, args []string) (err error) {
 			Volumes: map[string]struct{}{
 				"/var/run/disk/": {},
 			},
-			Cmd: []string{"/bin/bash", "-c", fmt.Sprintf("/vm.sh -n /var/run/disk/disk.qcow2 --memory %s --cpu %s %s", memory, strconv.Itoa(int(cpu)), qemuArgs)},
+			Cmd: []string{"/bin/bash", "-c", vmCommand(memory, cpu, nodeQemuArgs)},
 		}, &container.HostConfig{
-			Mounts: []mount.Mount{
-				{
-					Type:   "volume",
-					Source: vol.Name,
-					Target: "/var/run/disk",
-				},
-			},
+			Mounts:      nodeMounts,
 			Privileged:  true,
 			NetworkMode: container.NetworkMode("container:" + dnsmasq.ID),
 		}, nil, prefix+"-"+nodeName)
@@ -416,7 +630,7 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 
 		// Wait for vm start
-		success, err := docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"}, os.Stdout)
+		success, err := logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "boot", []string{"/bin/bash", "-c", "while [ ! -f /ssh_ready ] ; do sleep 1; done"})
 		if err != nil {
 			return err
 		}
@@ -425,33 +639,85 @@ func run(cmd *cobra.Command, args []string) (err error) {
 			return fmt.Errorf("checking for ssh.sh script for node %s failed", nodeName)
 		}
 
-		if dockerProxy != "" {
-			//if dockerProxy has value, genterate a shell script`/script/docker-proxy.sh` which can be applied to set proxy settings
-			proxyConfig, err := getDockerProxyConfig(dockerProxy)
+		if !nodeConfig.IsEmpty() {
+			// Configure the proxy and the CAs before anything on the node pulls images
+			nodeConfigScript, err := nodeConfig.GetNodeConfigScript()
+			if err != nil {
+				return fmt.Errorf("generating the proxy and CA settings for node %s failed: %v", nodeName, err)
+			}
+			success, err = provisionScript(cli, logger, prefix, nodeName, "config", "node-config", nodeConfigScript)
+			if err != nil {
+				return err
+			}
+			if !success {
+				return fmt.Errorf("applying the proxy and CA settings on node %s failed", nodeName)
+			}
+		}
+
+		if len(mirrors) > 0 {
+			mirrorConfig, err := utils.GetRegistryMirrorScript(mirrors)
+			if err != nil {
+				return fmt.Errorf("generating registry mirror settings for node %s failed: %v", nodeName, err)
+			}
+			success, err = provisionScript(cli, logger, prefix, nodeName, "mirror", "registry-mirror", mirrorConfig)
+			if err != nil {
+				return err
+			}
+			if !success {
+				return fmt.Errorf("configuring the registry mirrors on node %s failed", nodeName)
+			}
+		}
+
+		if len(shares) > 0 {
+			shareScript, err := utils.GetShareMountScript(shares)
+			if err != nil {
+				return fmt.Errorf("generating the share mounts for node %s failed: %v", nodeName, err)
+			}
+			success, err = provisionScript(cli, logger, prefix, nodeName, "shares", "shares", shareScript)
+			if err != nil {
+				return err
+			}
+			if !success {
+				return fmt.Errorf("mounting the shares on node %s failed", nodeName)
+			}
+		}
+
+		if kubeadmConfig.HasKubeletOverrides() {
+			kubeletScript, err := kubeadmConfig.GetKubeletArgsScript()
 			if err != nil {
-				return fmt.Errorf("parsing proxy settings for node %s failed", nodeName)
+				return fmt.Errorf("generating the kubelet arguments for node %s failed: %v", nodeName, err)
 			}
-			success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("cat <<EOF >/scripts/docker-proxy.sh %s", proxyConfig)}, os.Stdout)
+			success, err = provisionScript(cli, logger, prefix, nodeName, "kubeadm", "kubelet-args", kubeletScript)
 			if err != nil {
-				return fmt.Errorf("write failed for proxy provision script for node %s", nodeName)
+				return err
+			}
+			if !success {
+				return fmt.Errorf("setting the kubelet arguments on node %s failed", nodeName)
 			}
-			if success {
-				success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo /bin/bash < /scripts/docker-proxy.sh")}, os.Stdout)
+		}
+
+		// node01 runs kubeadm init with the kubeadm config, the other nodes only join
+		if nodeName == nodeNameFromIndex(1) && kubeadmConfig.HasKubeadmOverrides() {
+			if err := patchKubeadmConfig(cli, logger, prefix, nodeName, kubeadmConfig); err != nil {
+				return err
 			}
 		}
 
+		if err := runHooks(cli, logger, prefix, nodeName, hooks, utils.HookPreProvision); err != nil {
+			return err
+		}
+
 		//check if we have a special provision script
-		success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("test -f /scripts/%s.sh", nodeName)}, os.Stdout)
+		success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "provision", []string{"/bin/bash", "-c", fmt.Sprintf("test -f /scripts/%s.sh", nodeName)})
 		if err != nil {
 			return fmt.Errorf("checking for matching provision script for node %s failed", nodeName)
 		}
 
-		if success {
-			success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo /bin/bash < /scripts/%s.sh", nodeName)}, os.Stdout)
-		} else {
-			success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "ssh.sh sudo /bin/bash < /scripts/nodes.sh"}, os.Stdout)
+		nodeScript := fmt.Sprintf("/scripts/%s.sh", nodeName)
+		if !success {
+			nodeScript = "/scripts/nodes.sh"
 		}
-
+		success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "provision", []string{"/bin/bash", "-c", "ssh.sh sudo /bin/bash < " + nodeScript})
 		if err != nil {
 			return err
 		}
@@ -460,53 +726,98 @@ func run(cmd *cobra.Command, args []string) (err error) {
 			return fmt.Errorf("provisioning node %s failed", nodeName)
 		}
 
+		if kubeadmConfig.HasKubeletOverrides() {
+			if err := overrideLegacyCPUManagerArgs(cli, logger, prefix, nodeName, nodeScript, kubeadmConfig); err != nil {
+				return err
+			}
+		}
+
+		// node01.sh runs kubeadm init and deploys flannel, the network plugin goes on top of it
+		if nodeName == nodeNameFromIndex(1) && cni != "" {
+			cniScript, err := utils.GetCNIScript(cni)
+			if err != nil {
+				return err
+			}
+			success, err = provisionScript(cli, logger, prefix, nodeName, "cni", "cni", cniScript)
+			if err != nil {
+				return err
+			}
+			if !success {
+				return fmt.Errorf("deploying the network plugin %s failed", cni)
+			}
+		}
+
+		joinedNodes = append(joinedNodes, nodeName)
+		apiServerUp = apiServerUp || nodeName == nodeNameFromIndex(1)
+		if apiServerUp {
+			for _, joined := range joinedNodes {
+				labelsScript, err := utils.GetNodeLabelsScript(joined, nodeLabels, nodeTaints)
+				if err != nil {
+					return err
+				}
+				if labelsScript == "" {
+					continue
+				}
+				success, err = provisionScript(cli, logger, prefix, nodeNameFromIndex(1), "labels", "labels-"+joined, labelsScript)
+				if err != nil {
+					return err
+				}
+				if !success {
+					return fmt.Errorf("setting the labels and taints of node %s failed", joined)
+				}
+			}
+			joinedNodes = nil
+		}
+
+		if err := runHooks(cli, logger, prefix, nodeName, hooks, utils.HookPostProvision); err != nil {
+			return err
+		}
+
 		go func(id string) {
 			cli.ContainerWait(ctx, id)
 			wg.Done()
 		}(node.ID)
 	}
 
-	if cephEnabled {
-		keyRing := new(bytes.Buffer)
-		success, err := docker.Exec(cli, nodeContainer(prefix, "ceph"), []string{
-			"/bin/bash",
-			"-c",
-			"ceph auth print-key client.admin | base64",
-		}, keyRing)
-		if err != nil {
-			return err
-		}
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+	// Wait for the network plugin once all nodes joined, so that it runs on every node
+	if cni != "" {
 		nodeName := nodeNameFromIndex(1)
-		key := bytes.TrimSpace(keyRing.Bytes())
-		success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{
-			"/bin/bash",
-			"-c",
-			fmt.Sprintf("ssh.sh sudo sed -i \"s/replace-me/%s/g\" /tmp/ceph/ceph-secret.yaml", key),
-		}, os.Stdout)
+		rolloutScript, err := utils.GetCNIRolloutScript(cni)
 		if err != nil {
 			return err
 		}
-		success, err = docker.Exec(cli, nodeContainer(prefix, nodeName), []string{
-			"/bin/bash",
-			"-c",
-			"ssh.sh sudo /bin/bash < /scripts/ceph-csi.sh",
-		}, os.Stdout)
+		success, err := provisionScript(cli, logger, prefix, nodeName, "cni", "cni-rollout", rolloutScript)
 		if err != nil {
 			return err
 		}
 		if !success {
-			return fmt.Errorf("provisioning Ceph CSI failed")
+			return fmt.Errorf("the network plugin %s did not roll out", cni)
+		}
+	}
+
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+	if cephConfig.Enabled {
+		if err := provisionCeph(cli, logger, prefix, cephConfig); err != nil {
+			return err
 		}
 	}
 
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
 	// If logging is enabled, deploy the default fluent logging
 	if logDir != "" {
 		nodeName := nodeNameFromIndex(1)
-		success, err := docker.Exec(cli, nodeContainer(prefix, nodeName), []string{
-			"/bin/bash",
-			"-c",
-			"ssh.sh sudo /bin/bash < /scripts/logging.sh",
-		}, os.Stdout)
+		loggingScript, err := utils.GetLoggingScript()
+		if err != nil {
+			return err
+		}
+		success, err := provisionScript(cli, logger, prefix, nodeName, "logging", "logging", loggingScript)
 		if err != nil {
 			return err
 		}
@@ -515,9 +826,31 @@ func run(cmd *cobra.Command, args []string) (err error) {
 		}
 	}
 
+	if err := utils.Interrupted(ctx); err != nil {
+		return err
+	}
+	if len(manifests) > 0 {
+		if err := applyManifests(cli, logger, prefix, nodeNameFromIndex(1), manifests, manifestTimeout); err != nil {
+			return err
+		}
+	}
+
+	for x := 0; x < int(nodes); x++ {
+		if err := utils.Interrupted(ctx); err != nil {
+			return err
+		}
+		if err := runHooks(cli, logger, prefix, nodeNameFromIndex(x+1), hooks, utils.HookPostCluster); err != nil {
+			return err
+		}
+	}
+
 	// If background flag was specified, we don't want to clean up if we reach that state
 	if !background {
+		// The nodes stop on their own or the interrupt cancels the wait
 		wg.Wait()
+		if err := utils.Interrupted(ctx); err != nil {
+			return err
+		}
 		done <- fmt.Errorf("Done. please clean up")
 	}
 
@@ -528,21 +861,197 @@ func nodeNameFromIndex(x int) string {
 	return fmt.Sprintf("node%02d", x)
 }
 
+// nodeInCluster returns true if the node is one of the nodes of the cluster
+func nodeInCluster(node string, nodes uint) bool {
+	index, err := utils.NodeIndex(node)
+	return err == nil && index <= int(nodes)
+}
+
+// overrideLegacyCPUManagerArgs appends the kubelet arguments once more after the CPU manager arguments, if the
+// provision script of the node is the one of the published images, which puts them after KUBELET_EXTRA_ARGS
+func overrideLegacyCPUManagerArgs(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, nodeScript string, kubeadmConfig *utils.KubeadmConfig) error {
+	legacy, err := logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "kubeadm", []string{"/bin/bash", "-c", fmt.Sprintf("grep -q %s %s", utils.LegacyCPUManagerArgs, nodeScript)})
+	if err != nil {
+		return err
+	}
+	if !legacy {
+		return nil
+	}
+
+	script, err := kubeadmConfig.GetLegacyKubeletArgsScript()
+	if err != nil {
+		return fmt.Errorf("generating the kubelet arguments for node %s failed: %v", nodeName, err)
+	}
+	success, err := provisionScript(cli, logger, prefix, nodeName, "kubeadm", "kubelet-args-legacy", script)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("setting the kubelet arguments after the CPU manager arguments on node %s failed", nodeName)
+	}
+	return nil
+}
+
 func nodeContainer(prefix string, node string) string {
 	return prefix + "-" + node
 }
 
-func getDockerProxyConfig(proxy string) (string, error) {
-	p := dockerSetting{Proxy: proxy}
-	buf := new(bytes.Buffer)
+// runHooks copies the host scripts of the hooks of the phase into the node container and runs them on the node
+func runHooks(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, hooks []utils.Hook, phase string) error {
+	for i, hook := range hooks {
+		if !hook.RunsOn(phase, nodeName) {
+			continue
+		}
+
+		script := fmt.Sprintf("/scripts/hook-%s-%02d.sh", phase, i)
+		if err := docker.CopyToContainer(context.Background(), cli, nodeContainer(prefix, nodeName), hook.Script, script); err != nil {
+			return fmt.Errorf("copying the %s hook %s to node %s failed: %v", phase, hook.Script, nodeName, err)
+		}
+
+		success, err := logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, phase, []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo /bin/bash < %s", script)})
+		if err != nil {
+			return err
+		}
+		if !success {
+			return fmt.Errorf("the %s hook %s failed on node %s", phase, hook.Script, nodeName)
+		}
+	}
+	return nil
+}
+
+// patchKubeadmConfig merges the overrides into the kubeadm config of the node before kubeadm init runs
+func patchKubeadmConfig(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, config *utils.KubeadmConfig) error {
+	streams, err := logger.Streams(nodeName, "kubeadm")
+	if err != nil {
+		return err
+	}
+	defer streams.Close()
+
+	original := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", "ssh.sh sudo cat " + utils.KubeadmConfigPath}, original, streams.Stderr)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("reading the kubeadm config %s of node %s failed, the cluster image may not use a kubeadm config", utils.KubeadmConfigPath, nodeName)
+	}
+
+	patched, err := config.PatchKubeadmConfig(original.Bytes())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(streams.Stdout, "Patched kubeadm config:\n%s", patched)
+
+	exitCode, err = docker.ExecStreams(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("cat <<'EOF' >/scripts/kubeadm.conf\n%sEOF\n", patched)}, streams.Stdout, streams.Stderr)
+	if err != nil {
+		return err
+	}
+	if exitCode == 0 {
+		exitCode, err = docker.ExecStreams(cli, nodeContainer(prefix, nodeName), []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo tee %s >/dev/null < /scripts/kubeadm.conf", utils.KubeadmConfigPath)}, streams.Stdout, streams.Stderr)
+		if err != nil {
+			return err
+		}
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("writing the kubeadm config of node %s failed", nodeName)
+	}
+	return nil
+}
+
+// provisionCeph waits until the Ceph cluster is healthy, creates its pools and deploys the RBD and the CephFS
+// CSI drivers with the generated Secrets and StorageClasses on node01
+func provisionCeph(cli *client.Client, logger *utils.ProvisionLogger, prefix string, config *ceph.Config) error {
+	cephContainer := prefix + "-ceph"
+	streams, err := logger.Streams("ceph", "pools")
+	if err != nil {
+		return err
+	}
+	defer streams.Close()
+
+	if err := ceph.WaitForHealth(cli, cephContainer, config, streams.Stdout); err != nil {
+		return err
+	}
+
+	poolsScript, err := config.GetPoolsScript()
+	if err != nil {
+		return err
+	}
+	exitCode, err := docker.ExecStreams(cli, cephContainer, []string{"/bin/bash", "-c", poolsScript}, streams.Stdout, streams.Stderr)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("creating the Ceph pools failed")
+	}
+
+	// The placement groups of the new pools have to become active as well
+	if err := ceph.WaitForHealth(cli, cephContainer, config, streams.Stdout); err != nil {
+		return err
+	}
+	if err := ceph.VerifyOSDs(cli, cephContainer, config); err != nil {
+		return err
+	}
 
-	t, err := template.New("docker-proxy").Parse(proxySettings)
+	key := new(bytes.Buffer)
+	exitCode, err = docker.ExecStreams(cli, cephContainer, []string{"/bin/bash", "-c", "ceph auth print-key client.admin | base64 -w0"}, key, streams.Stderr)
 	if err != nil {
-		return "", err
+		return err
+	}
+	if exitCode != 0 || key.Len() == 0 {
+		return fmt.Errorf("reading the Ceph admin key failed")
 	}
-	err = t.Execute(buf, p)
+
+	nodeName := nodeNameFromIndex(1)
+	csiScript, err := config.GetCSIScript(key.String())
 	if err != nil {
-		return "", err
+		return err
+	}
+	success, err := provisionScript(cli, logger, prefix, nodeName, "ceph", "ceph-manifests", csiScript)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("writing the Ceph manifests on node %s failed", nodeName)
+	}
+
+	success, err = logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, "ceph", []string{
+		"/bin/bash",
+		"-c",
+		"ssh.sh sudo /bin/bash < /scripts/ceph-csi.sh",
+	})
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("provisioning Ceph CSI failed")
+	}
+
+	cephfsScript, err := config.GetCephFSScript(key.String())
+	if err != nil {
+		return err
+	}
+	if cephfsScript == "" {
+		return nil
+	}
+	success, err = provisionScript(cli, logger, prefix, nodeName, "ceph", "ceph-cephfs", cephfsScript)
+	if err != nil {
+		return err
+	}
+	if !success {
+		return fmt.Errorf("provisioning the CephFS CSI driver failed")
+	}
+	return nil
+}
+
+// provisionScript writes the generated script to /scripts/<name>.sh in the node container and runs it on the node
+func provisionScript(cli *client.Client, logger *utils.ProvisionLogger, prefix string, nodeName string, phase string, name string, script string) (bool, error) {
+	path := fmt.Sprintf("/scripts/%s.sh", name)
+	success, err := logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, phase, []string{"/bin/bash", "-c", fmt.Sprintf("cat <<'EOF' >%s %s", path, script)})
+	if err != nil {
+		return false, fmt.Errorf("write failed for %s provision script for node %s: %v", name, nodeName, err)
+	}
+	if !success {
+		return false, nil
 	}
-	return buf.String(), nil
+	return logger.Exec(cli, nodeContainer(prefix, nodeName), nodeName, phase, []string{"/bin/bash", "-c", fmt.Sprintf("ssh.sh sudo /bin/bash < %s", path)})
 }
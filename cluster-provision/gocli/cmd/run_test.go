@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestNodeInCluster(t *testing.T) {
+	tests := []struct {
+		node      string
+		nodes     uint
+		inCluster bool
+	}{
+		{node: "node01", nodes: 1, inCluster: true},
+		{node: "node02", nodes: 1, inCluster: false},
+		{node: "node99", nodes: 100, inCluster: true},
+		{node: "node100", nodes: 100, inCluster: true},
+		{node: "node100", nodes: 99, inCluster: false},
+		{node: "node101", nodes: 100, inCluster: false},
+		{node: "node9", nodes: 100, inCluster: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s of %d", tt.node, tt.nodes), func(t *testing.T) {
+			if inCluster := nodeInCluster(tt.node, tt.nodes); inCluster != tt.inCluster {
+				t.Errorf("expected %t, got %t", tt.inCluster, inCluster)
+			}
+		})
+	}
+}
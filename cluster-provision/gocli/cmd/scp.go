@@ -3,7 +3,6 @@ package cmd
 import (
 	"os"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 	"kubevirt.io/kubevirtci/gocli/cmd/utils"
 	"kubevirt.io/kubevirtci/gocli/docker"
@@ -81,7 +80,7 @@ func scp(cmd *cobra.Command, args []string) error {
 	src := args[0]
 	dst := args[1]
 
-	cli, err := client.NewEnvClient()
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
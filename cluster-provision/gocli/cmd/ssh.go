@@ -3,7 +3,6 @@ package cmd
 import (
 	"os"
 
-	"github.com/docker/docker/client"
 	"github.com/spf13/cobra"
 	"kubevirt.io/kubevirtci/gocli/docker"
 )
@@ -29,7 +28,7 @@ func ssh(cmd *cobra.Command, args []string) error {
 
 	node := args[0]
 
-	cli, err := client.NewEnvClient()
+	cli, err := docker.NewClient()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// nodeList contains the fields of kubectl get nodes -o json which status shows
+type nodeList struct {
+	Items []struct {
+		Metadata struct {
+			Name   string            `json:"name"`
+			Labels map[string]string `json:"labels"`
+		} `json:"metadata"`
+		Spec struct {
+			Taints []struct {
+				Key    string `json:"key"`
+				Value  string `json:"value"`
+				Effect string `json:"effect"`
+			} `json:"taints"`
+		} `json:"spec"`
+		Status struct {
+			Conditions []struct {
+				Type   string `json:"type"`
+				Status string `json:"status"`
+			} `json:"conditions"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// NewStatusCommand returns command to show the containers and the nodes of the cluster
+func NewStatusCommand() *cobra.Command {
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "status shows the containers and the nodes of the cluster",
+		Long: `status shows the containers and the nodes of the cluster
+
+The nodes are listed with their readiness, their taints and their labels,
+labels which kubernetes sets on every node are omitted.
+`,
+		RunE: status,
+		Args: cobra.NoArgs,
+	}
+	return status
+}
+
+func status(cmd *cobra.Command, _ []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	containers, err := docker.GetPrefixedContainers(cli, prefix+"-")
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("failed to find a cluster with the prefix %s", prefix)
+	}
+
+	sort.Slice(containers, func(i, j int) bool {
+		return containers[i].Names[0] < containers[j].Names[0]
+	})
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTAINER\tIMAGE\tSTATE")
+	hasNode01 := false
+	for _, c := range containers {
+		name := strings.TrimPrefix(c.Names[0], "/")
+		if name == nodeContainer(prefix, nodeNameFromIndex(1)) {
+			hasNode01 = c.State == "running"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", name, c.Image, c.State)
+	}
+	w.Flush()
+
+	if !hasNode01 {
+		return nil
+	}
+
+	out := new(bytes.Buffer)
+	exitCode, err := docker.ExecStreams(cli, nodeContainer(prefix, nodeNameFromIndex(1)), []string{
+		"/bin/bash",
+		"-c",
+		"ssh.sh sudo kubectl --kubeconfig=/etc/kubernetes/admin.conf get nodes -o json",
+	}, out, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return fmt.Errorf("failed to list the nodes, the API server may not be up yet")
+	}
+
+	nodes := &nodeList{}
+	if err := json.Unmarshal(out.Bytes(), nodes); err != nil {
+		return fmt.Errorf("failed to parse the nodes: %v", err)
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout())
+	w = tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tREADY\tTAINTS\tLABELS")
+	for _, node := range nodes.Items {
+		ready := "Unknown"
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == "Ready" {
+				ready = condition.Status
+			}
+		}
+
+		taints := []string{}
+		for _, taint := range node.Spec.Taints {
+			if taint.Value == "" {
+				taints = append(taints, taint.Key+":"+taint.Effect)
+			} else {
+				taints = append(taints, taint.Key+"="+taint.Value+":"+taint.Effect)
+			}
+		}
+
+		labels := []string{}
+		for key, value := range node.Metadata.Labels {
+			if strings.HasPrefix(key, "beta.kubernetes.io/") || key == "kubernetes.io/hostname" {
+				continue
+			}
+			labels = append(labels, key+"="+value)
+		}
+		sort.Strings(labels)
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", node.Metadata.Name, ready, joinOrNone(taints), joinOrNone(labels))
+	}
+	return w.Flush()
+}
+
+func joinOrNone(values []string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	return strings.Join(values, ",")
+}
@@ -0,0 +1,306 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/spf13/cobra"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/providers"
+	"kubevirt.io/kubevirtci/gocli/cmd/utils"
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewUpCommand returns command to start a cluster of a provider of the catalog
+func NewUpCommand() *cobra.Command {
+
+	up := &cobra.Command{
+		Use:   "up provider [-- run flags]",
+		Short: "up starts a cluster of the provider and writes its kubeconfig and config-provider-<provider>.sh",
+		Long: `up starts a cluster of the provider and writes its kubeconfig and config-provider-<provider>.sh
+
+The provider is looked up in the provider catalog, which contains the cluster
+image, the default resources, the fixed ports and where the kubeconfig is found
+in the cluster. The catalog is compiled into gocli, --catalog or
+GOCLI_PROVIDER_CATALOG replace it. Flags after -- are passed to run.
+
+Once the cluster is up, .kubeconfig, .kubectl and config-provider-<provider>.sh
+are written to <config-path>/<provider>, the kubeconfig points to the published
+API server port. gocli in config-provider-<provider>.sh is the executable, unless
+gocli runs in a container like via cluster-up/cli.sh, then --gocli must name
+the command on the host and --config-path a directory which is mounted at the
+same path from the host.
+`,
+		RunE: up,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	up.Flags().String("catalog", "", fmt.Sprintf("provider catalog file which replaces the embedded one, can also be set via %s", providers.CatalogEnv))
+	up.Flags().String("config-path", "", fmt.Sprintf("directory in which the configs of the provider are written, defaults to %s or _ci-configs", providers.ConfigPathEnv))
+	up.Flags().UintP("nodes", "n", 0, "number of cluster nodes to start, by default the number of the catalog")
+	up.Flags().StringP("memory", "m", "", "amount of ram per node, by default the amount of the catalog")
+	up.Flags().UintP("cpu", "c", 0, "number of cpu cores per node, by default the number of the catalog")
+	up.Flags().String("registry-volume", "", "cache docker registry content in the specified volume")
+	up.Flags().Duration("kubeconfig-timeout", 30*time.Minute, "how long to wait for the kubeconfig and the client to be written in the cluster, the installer of okd writes them only once it is done")
+	up.Flags().String("gocli", "", "command which runs gocli on the host, like cluster-up/cli.sh, by default the executable")
+	up.Flags().Bool("fixed-ports", true, "publish the ports with a fixed localhost port in the catalog on it, disable it to run several clusters on the host")
+
+	return up
+}
+
+func up(cmd *cobra.Command, args []string) error {
+
+	prefix, err := cmd.Flags().GetString("prefix")
+	if err != nil {
+		return err
+	}
+
+	catalogPath, err := cmd.Flags().GetString("catalog")
+	if err != nil {
+		return err
+	}
+
+	configPath, err := cmd.Flags().GetString("config-path")
+	if err != nil {
+		return err
+	}
+
+	nodes, err := cmd.Flags().GetUint("nodes")
+	if err != nil {
+		return err
+	}
+
+	memory, err := cmd.Flags().GetString("memory")
+	if err != nil {
+		return err
+	}
+
+	cpu, err := cmd.Flags().GetUint("cpu")
+	if err != nil {
+		return err
+	}
+
+	registryVolume, err := cmd.Flags().GetString("registry-volume")
+	if err != nil {
+		return err
+	}
+
+	fixedPorts, err := cmd.Flags().GetBool("fixed-ports")
+	if err != nil {
+		return err
+	}
+
+	kubeconfigTimeout, err := cmd.Flags().GetDuration("kubeconfig-timeout")
+	if err != nil {
+		return err
+	}
+
+	gocli, err := cmd.Flags().GetString("gocli")
+	if err != nil {
+		return err
+	}
+
+	// Fail before the cluster is started
+	gocli, err = hostGocli(gocli)
+	if err != nil {
+		return err
+	}
+
+	if err := checkHostConfigPath(configPath); err != nil {
+		return err
+	}
+
+	catalog, err := providers.LoadCatalog(catalogPath)
+	if err != nil {
+		return err
+	}
+
+	provider, err := catalog.Lookup(args[0])
+	if err != nil {
+		return err
+	}
+
+	runArgs, err := providerRunArgs(provider, nodes, memory, cpu, fixedPorts, registryVolume, args[1:])
+	if err != nil {
+		return err
+	}
+
+	runCmd, err := newProviderRunCommand(provider)
+	if err != nil {
+		return err
+	}
+	// The prefix is a flag of the root command, share it with run
+	runCmd.Flags().AddFlagSet(cmd.InheritedFlags())
+	runCmd.SetOutput(cmd.OutOrStdout())
+	if err := runCmd.ParseFlags(runArgs); err != nil {
+		return fmt.Errorf("invalid run flags of the provider %s: %v", provider.Name, err)
+	}
+	if err := runCmd.ValidateArgs(runCmd.Flags().Args()); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Start the cluster %s: %s --prefix %s %s\n", provider.Name, runCmd.CommandPath(), prefix, strings.Join(runArgs, " "))
+	if err := runCmd.RunE(runCmd, runCmd.Flags().Args()); err != nil {
+		return err
+	}
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	if err := fetchKubeconfig(cli, prefix, configPath, provider, kubeconfigTimeout); err != nil {
+		return err
+	}
+
+	config, err := providerConfig(cli, prefix, configPath, catalogPath, provider.Name, gocli)
+	if err != nil {
+		return err
+	}
+	if err := providers.WriteConfigScript(configPath, provider.Name, config); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "The cluster %s is up, connect to it with\n  export KUBECONFIG=%s\n", provider.Name, config.Kubeconfig)
+	return nil
+}
+
+// fetchKubeconfig writes the kubeconfig and the client of the cluster into the config directory of the provider,
+// the kubeconfig points to the published API server port
+func fetchKubeconfig(cli *client.Client, prefix string, configPath string, provider *providers.Provider, timeout time.Duration) error {
+	dir := providers.ConfigDir(configPath, provider.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// The kubeconfig of a cluster which runs in a container, like okd, is written once the installer is done
+	kubeconfig, err := readClusterFile(cli, prefix, provider, provider.Kubeconfig.Path, timeout)
+	if err != nil {
+		return err
+	}
+
+	kubectl, err := readClusterFile(cli, prefix, provider, provider.Kubeconfig.Kubectl, timeout)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".kubectl"), kubectl, 0755); err != nil {
+		return err
+	}
+
+	cluster, err := docker.GetClusterContainer(cli, prefix)
+	if err != nil {
+		return err
+	}
+	port, err := utils.PortByName(provider.Kubeconfig.Port)
+	if err != nil {
+		return err
+	}
+	apiPort, err := utils.GetPublicPort(port, cluster.Ports)
+	if err != nil {
+		return fmt.Errorf("the port %s of the cluster %s: %v", provider.Kubeconfig.Port, prefix, err)
+	}
+	kubeconfig, err = providers.SetKubeconfigServer(kubeconfig, provider.Kubeconfig.Cluster, fmt.Sprintf("https://127.0.0.1:%d", apiPort))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, ".kubeconfig"), kubeconfig, 0600)
+}
+
+// providerRunArgs returns the flags and the image of run for the provider,
+// the resources and ports of the catalog are used unless they are overridden
+func providerRunArgs(provider *providers.Provider, nodes uint, memory string, cpu uint, fixedPorts bool, registryVolume string, extraArgs []string) ([]string, error) {
+	runArgs := []string{"--background", "--random-ports"}
+
+	if provider.Command == "" {
+		if nodes == 0 {
+			nodes = provider.Nodes
+		}
+		if memory == "" {
+			memory = provider.Memory
+		}
+		if cpu == 0 {
+			cpu = provider.CPU
+		}
+		if nodes > 0 {
+			runArgs = append(runArgs, "--nodes", strconv.Itoa(int(nodes)))
+		}
+		if memory != "" {
+			runArgs = append(runArgs, "--memory", memory)
+		}
+		if cpu > 0 {
+			runArgs = append(runArgs, "--cpu", strconv.Itoa(int(cpu)))
+		}
+	} else if nodes > 0 || memory != "" || cpu > 0 {
+		return nil, fmt.Errorf("the provider %s does not support --nodes, --memory and --cpu, pass the flags of run %s after --", provider.Name, provider.Command)
+	}
+
+	if fixedPorts {
+		names := []string{}
+		for name := range provider.Ports {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			runArgs = append(runArgs, fmt.Sprintf("--%s-port", name), strconv.Itoa(int(provider.Ports[name])))
+		}
+	}
+
+	if registryVolume != "" {
+		runArgs = append(runArgs, "--registry-volume", registryVolume)
+	}
+
+	runArgs = append(runArgs, provider.Args...)
+	runArgs = append(runArgs, extraArgs...)
+	return append(runArgs, provider.Image), nil
+}
+
+// newProviderRunCommand returns the run command which starts a cluster of the provider
+func newProviderRunCommand(provider *providers.Provider) (*cobra.Command, error) {
+	run := NewRunCommand()
+	if provider.Command == "" {
+		return run, nil
+	}
+	for _, c := range run.Commands() {
+		if c.Name() == provider.Command {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("the provider %s needs the unknown command run %s", provider.Name, provider.Command)
+}
+
+// readClusterFile returns the content of the file from node01 of the cluster
+// or from the container of the provider, if the provider runs the cluster in a container,
+// it waits up to the timeout for the file to be written
+func readClusterFile(cli *client.Client, prefix string, provider *providers.Provider, path string, timeout time.Duration) ([]byte, error) {
+	container := nodeContainer(prefix, nodeNameFromIndex(1))
+	args := []string{"ssh.sh", "sudo", "cat", path}
+	if provider.Container != "" {
+		container = prefix + "-" + provider.Container
+		args = []string{"cat", path}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+		exitCode, err := docker.ExecStreams(cli, container, args, stdout, stderr)
+		if err != nil {
+			return nil, err
+		}
+		if exitCode == 0 && stdout.Len() > 0 {
+			return stdout.Bytes(), nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("reading %s from %s failed after %s: %s", path, container, timeout, strings.TrimSpace(stderr.String()))
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
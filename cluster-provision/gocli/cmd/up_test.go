@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+
+	"kubevirt.io/kubevirtci/gocli/cmd/providers"
+)
+
+func TestProviderRunArgs(t *testing.T) {
+	k8s := &providers.Provider{Name: "k8s-1.13.3", Image: "kubevirtci/k8s-1.13.3", Nodes: 1, Memory: "5120M", CPU: 5}
+	openshift := &providers.Provider{Name: "os-3.11.0", Image: "kubevirtci/os-3.11.0", Nodes: 1, Args: []string{"--reverse"}, Ports: map[string]uint{"ocp": 8443}}
+	okd := &providers.Provider{Name: "okd-4.1.0", Image: "kubevirtci/okd-4.1.0", Command: "okd", Args: []string{"--master-cpu", "5"}}
+
+	tests := []struct {
+		name           string
+		provider       *providers.Provider
+		nodes          uint
+		memory         string
+		cpu            uint
+		fixedPorts     bool
+		registryVolume string
+		extraArgs      []string
+		expected       []string
+		fails          bool
+	}{
+		{
+			name:     "defaults of the catalog",
+			provider: k8s,
+			expected: []string{"--background", "--random-ports", "--nodes", "1", "--memory", "5120M", "--cpu", "5", "kubevirtci/k8s-1.13.3"},
+		},
+		{
+			name:           "overridden resources and run flags",
+			provider:       k8s,
+			nodes:          2,
+			memory:         "8G",
+			registryVolume: "registry",
+			extraArgs:      []string{"--enable-ceph"},
+			expected: []string{"--background", "--random-ports", "--nodes", "2", "--memory", "8G", "--cpu", "5",
+				"--registry-volume", "registry", "--enable-ceph", "kubevirtci/k8s-1.13.3"},
+		},
+		{
+			name:       "fixed ports and args of the catalog",
+			provider:   openshift,
+			fixedPorts: true,
+			expected:   []string{"--background", "--random-ports", "--nodes", "1", "--ocp-port", "8443", "--reverse", "kubevirtci/os-3.11.0"},
+		},
+		{
+			name:     "ports are random",
+			provider: openshift,
+			expected: []string{"--background", "--random-ports", "--nodes", "1", "--reverse", "kubevirtci/os-3.11.0"},
+		},
+		{
+			name:      "run command of the provider",
+			provider:  okd,
+			extraArgs: []string{"--workers", "2"},
+			expected:  []string{"--background", "--random-ports", "--master-cpu", "5", "--workers", "2", "kubevirtci/okd-4.1.0"},
+		},
+		{name: "resources of a run command", provider: okd, nodes: 2, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := providerRunArgs(tt.provider, tt.nodes, tt.memory, tt.cpu, tt.fixedPorts, tt.registryVolume, tt.extraArgs)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", args)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, args)
+			}
+		})
+	}
+}
+
+func TestNewProviderRunCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected string
+		fails    bool
+	}{
+		{command: "", expected: "run"},
+		{command: "okd", expected: "run okd"},
+		{command: "minikube", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			run, err := newProviderRunCommand(&providers.Provider{Name: "test", Command: tt.command})
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", run.CommandPath())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if run.CommandPath() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, run.CommandPath())
+			}
+			// The flags of the catalog must be known to the command
+			if err := run.ParseFlags([]string{"--background", "--random-ports"}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
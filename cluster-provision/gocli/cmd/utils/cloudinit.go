@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"text/template"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// CloudInitUser is the user which cloud-init creates with the generated SSH key,
+// vm.sh connects to the nodes as this user with /vagrant.key
+const CloudInitUser = "vagrant"
+
+// LabelCloudImage contains the file name of the cloud image a base image was built from
+const LabelCloudImage = "io.kubevirtci.cloud-image"
+
+// cloudConfigSettings is the cloud-config of the seed ISO, it creates the user for ssh.sh and disables cloud-init
+// after the first boot, so that the nodes of the base image keep the configuration and get their hostname via DHCP
+const cloudConfigSettings = `#cloud-config
+users:
+- default
+- name: {{.User}}
+  gecos: kubevirtci
+  shell: /bin/bash
+  sudo: ALL=(ALL) NOPASSWD:ALL
+  lock_passwd: true
+  ssh_authorized_keys:
+  - {{.PublicKey}}
+ssh_pwauth: false
+preserve_hostname: true
+runcmd:
+- rm -f /etc/hostname
+- touch /etc/cloud/cloud-init.disabled
+`
+
+// networkConfigSettings configures DHCP on the virtio interface of the node, the interface is matched by name
+// and not by MAC address, since every node of the base image has another MAC address
+const networkConfigSettings = `version: 2
+ethernets:
+  default:
+    match:
+      name: "e*"
+    dhcp4: true
+`
+
+// metaDataSettings is the meta-data of the seed ISO, the hostname is left to DHCP
+const metaDataSettings = `instance-id: {{.}}
+`
+
+// seedSettings is the command of the node container of a base build. It converts the cloud image into /box.qcow2,
+// writes the NoCloud seed ISO and boots the image with vm.sh, QEMU keeps the VM after it powered off.
+const seedSettings = `
+set -e
+cd /
+
+qemu-img convert -O qcow2 /image /box.qcow2
+rm -f /image
+{{- if .DiskSize}}
+qemu-img resize /box.qcow2 {{.DiskSize}}
+{{- end}}
+chmod 600 /vagrant.key
+mkdir -p /scripts
+
+if ! command -v genisoimage >/dev/null; then
+    echo "the base image has no genisoimage" >&2
+    exit 1
+fi
+genisoimage -output /seed.iso -volid cidata -joliet -rock /seed/user-data /seed/meta-data /seed/network-config
+
+exec /vm.sh -n /var/run/disk/disk.qcow2 --memory {{.Memory}} --cpu {{.CPU}} --qemu-args "-drive file=/seed.iso,media=cdrom -no-shutdown -monitor telnet:127.0.0.1:{{.MonitorPort}},server,nowait"
+`
+
+// cloudInitSettings runs on the node and waits until cloud-init applied the seed ISO
+const cloudInitSettings = `
+set -e
+
+for i in $(seq 1 600); do
+    if [ -f /var/lib/cloud/instance/boot-finished ]; then
+        cat /var/lib/cloud/instance/boot-finished
+        exit 0
+    fi
+    sleep 1
+done
+echo "cloud-init did not finish within 600 seconds" >&2
+tail -n 50 /var/log/cloud-init-output.log >&2 || true
+exit 1
+EOF
+`
+
+// flattenSettings runs in the node container of a base build after the VM powered off, it merges the disk
+// of the node into /box.qcow2 and removes everything which only the build needed
+const flattenSettings = `
+set -e
+cd /
+
+monitor() {
+    exec 3<>/dev/tcp/127.0.0.1/{{.}} || return 1
+    echo "$1" >&3
+    sleep 1
+    timeout 1 cat <&3 || true
+    exec 3>&-
+}
+
+for i in $(seq 1 300); do
+    if monitor "info status" | grep -q "status: shutdown"; then
+        break
+    fi
+    if [ ${i} -eq 300 ]; then
+        echo "the VM did not power off within 300 seconds" >&2
+        exit 1
+    fi
+    sleep 1
+done
+
+echo "Merge /var/run/disk/disk.qcow2 into /box.qcow2"
+qemu-img convert -U -O qcow2 /var/run/disk/disk.qcow2 /box.qcow2.new
+mv -f /box.qcow2.new /box.qcow2
+qemu-img info /box.qcow2
+
+rm -rf /seed /seed.iso /scripts /ssh_ready /usr/local/bin/ssh.sh
+`
+
+// CloudInitSeed contains the files of a NoCloud seed
+type CloudInitSeed struct {
+	UserData      []byte
+	MetaData      []byte
+	NetworkConfig []byte
+}
+
+// GenerateSSHKey returns a new RSA private key in PEM format and its public key in authorized_keys format
+func GenerateSSHKey() ([]byte, string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, "", err
+	}
+	private := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	public, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return private, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(public))), nil
+}
+
+// GetCloudInitSeed returns the NoCloud seed which authorizes the public key for CloudInitUser.
+// The user data of the user is appended as second part of a multipart user data, its lists and maps
+// are merged into the generated cloud-config. An empty network config configures DHCP on the node.
+func GetCloudInitSeed(instanceID string, publicKey string, userData []byte, networkConfig []byte) (*CloudInitSeed, error) {
+	cloudConfig, err := renderCloudInit("cloud-config", cloudConfigSettings, struct {
+		User      string
+		PublicKey string
+	}{
+		User:      CloudInitUser,
+		PublicKey: publicKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seed := &CloudInitSeed{
+		NetworkConfig: networkConfig,
+	}
+	if len(seed.NetworkConfig) == 0 {
+		seed.NetworkConfig = []byte(networkConfigSettings)
+	}
+
+	metaData, err := renderCloudInit("meta-data", metaDataSettings, instanceID)
+	if err != nil {
+		return nil, err
+	}
+	seed.MetaData = []byte(metaData)
+
+	if len(userData) == 0 {
+		seed.UserData = []byte(cloudConfig)
+		return seed, nil
+	}
+
+	contentType, err := userDataContentType(userData)
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	w := multipart.NewWriter(buf)
+	fmt.Fprintf(buf, "Content-Type: multipart/mixed; boundary=\"%s\"\nMIME-Version: 1.0\n\n", w.Boundary())
+	for _, part := range []struct {
+		header textproto.MIMEHeader
+		data   []byte
+	}{
+		{textproto.MIMEHeader{"Content-Type": {"text/cloud-config"}}, []byte(cloudConfig)},
+		{textproto.MIMEHeader{
+			"Content-Type": {contentType},
+			"Merge-Type":   {"list(append)+dict(no_replace,recurse_list)+str()"},
+		}, userData},
+	} {
+		p, err := w.CreatePart(part.header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.Write(part.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	seed.UserData = buf.Bytes()
+	return seed, nil
+}
+
+// GetSeedScript returns the command of the node container of a base build, diskSize may be empty to keep
+// the size of the cloud image
+func GetSeedScript(memory string, cpu uint, diskSize string, monitorPort int) (string, error) {
+	return renderCloudInit("seed", seedSettings, struct {
+		Memory      string
+		CPU         uint
+		DiskSize    string
+		MonitorPort int
+	}{
+		Memory:      memory,
+		CPU:         cpu,
+		DiskSize:    diskSize,
+		MonitorPort: monitorPort,
+	})
+}
+
+// GetCloudInitScript returns a script which waits on the node until cloud-init finished
+func GetCloudInitScript() (string, error) {
+	return cloudInitSettings, nil
+}
+
+// GetFlattenScript returns a script which merges the disk of the powered off node into /box.qcow2,
+// the QEMU monitor of the node has to listen on the port
+func GetFlattenScript(monitorPort int) (string, error) {
+	return renderCloudInit("flatten", flattenSettings, monitorPort)
+}
+
+// userDataContentType returns the MIME type of the user data by its first line like cloud-init does
+func userDataContentType(userData []byte) (string, error) {
+	for _, t := range []struct {
+		prefix      string
+		contentType string
+	}{
+		{"#cloud-config", "text/cloud-config"},
+		{"#cloud-boothook", "text/cloud-boothook"},
+		{"#include", "text/x-include-url"},
+		{"#!", "text/x-shellscript"},
+	} {
+		if bytes.HasPrefix(userData, []byte(t.prefix)) {
+			return t.contentType, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported user data, it has to start with #cloud-config, #cloud-boothook, #include or #!")
+}
+
+func renderCloudInit(name string, settings string, data interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New(name).Parse(settings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"gopkg.in/yaml.v2"
+)
+
+// userDataParts returns the content types, the merge types and the contents of the parts of a multipart user data
+func userDataParts(t *testing.T, userData []byte) ([]string, []string, []string) {
+	reader := textproto.NewReader(bufio.NewReader(bytes.NewReader(userData)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("failed to read the header of the user data: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("expected multipart/mixed user data, got %q: %v", header.Get("Content-Type"), err)
+	}
+
+	types, merges, contents := []string{}, []string{}, []string{}
+	parts := multipart.NewReader(reader.R, params["boundary"])
+	for {
+		part, err := parts.NextPart()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		merges = append(merges, part.Header.Get("Merge-Type"))
+		contents = append(contents, string(content))
+	}
+	return types, merges, contents
+}
+
+func TestGetCloudInitSeed(t *testing.T) {
+	publicKey := "ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAABAQC7 gocli"
+	merge := "list(append)+dict(no_replace,recurse_list)+str()"
+
+	tests := []struct {
+		name          string
+		userData      string
+		networkConfig string
+		types         []string
+		fails         bool
+	}{
+		{name: "generated user data", types: nil},
+		{
+			name:     "cloud-config of the user",
+			userData: "#cloud-config\npackages:\n- vim\n",
+			types:    []string{"text/cloud-config", "text/cloud-config"},
+		},
+		{
+			name:          "script of the user and a network config",
+			userData:      "#!/bin/bash\necho hello\n",
+			networkConfig: "version: 2\nethernets:\n  eth0:\n    dhcp4: false\n",
+			types:         []string{"text/cloud-config", "text/x-shellscript"},
+		},
+		{name: "unsupported user data", userData: "packages: [vim]\n", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed, err := GetCloudInitSeed("kubevirt-1", publicKey, []byte(tt.userData), []byte(tt.networkConfig))
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", seed.UserData)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if string(seed.MetaData) != "instance-id: kubevirt-1\n" {
+				t.Errorf("expected the instance id in the meta data, got %q", seed.MetaData)
+			}
+			expectedNetwork := tt.networkConfig
+			if expectedNetwork == "" {
+				expectedNetwork = networkConfigSettings
+			}
+			if string(seed.NetworkConfig) != expectedNetwork {
+				t.Errorf("expected the network config %q, got %q", expectedNetwork, seed.NetworkConfig)
+			}
+
+			cloudConfig := string(seed.UserData)
+			if tt.types != nil {
+				types, merges, contents := userDataParts(t, seed.UserData)
+				if strings.Join(types, ",") != strings.Join(tt.types, ",") {
+					t.Fatalf("expected the parts %v, got %v", tt.types, types)
+				}
+				if merges[1] != merge {
+					t.Errorf("expected the user data to be merged with %s, got %q", merge, merges[1])
+				}
+				if contents[1] != tt.userData {
+					t.Errorf("expected the user data %q, got %q", tt.userData, contents[1])
+				}
+				cloudConfig = contents[0]
+			}
+
+			if !strings.HasPrefix(cloudConfig, "#cloud-config\n") {
+				t.Fatalf("expected a cloud-config, got\n%s", cloudConfig)
+			}
+			config := struct {
+				Users []interface{} `yaml:"users"`
+			}{}
+			if err := yaml.Unmarshal([]byte(cloudConfig), &config); err != nil {
+				t.Fatalf("failed to parse the cloud-config: %v", err)
+			}
+			if len(config.Users) != 2 {
+				t.Fatalf("expected the default user and %s, got %v", CloudInitUser, config.Users)
+			}
+			user, _ := config.Users[1].(map[interface{}]interface{})
+			keys, _ := user["ssh_authorized_keys"].([]interface{})
+			if user["name"] != CloudInitUser || len(keys) != 1 || keys[0] != publicKey {
+				t.Errorf("expected %s with the public key, got %v", CloudInitUser, user)
+			}
+		})
+	}
+}
+
+func TestGenerateSSHKey(t *testing.T) {
+	private, public, err := GenerateSSHKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.ParsePrivateKey(private)
+	if err != nil {
+		t.Fatalf("failed to parse the private key: %v", err)
+	}
+	if expected := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))); public != expected {
+		t.Errorf("expected the public key %s, got %s", expected, public)
+	}
+}
+
+func TestGetSeedScript(t *testing.T) {
+	tests := []struct {
+		diskSize string
+		resize   bool
+	}{
+		{diskSize: "", resize: false},
+		{diskSize: "20G", resize: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.diskSize, func(t *testing.T) {
+			script, err := GetSeedScript("2048M", 2, tt.diskSize, 4501)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resize := strings.Contains(script, "qemu-img resize /box.qcow2 "+tt.diskSize+"\n"); resize != tt.resize {
+				t.Errorf("expected the disk to be resized: %t, got\n%s", tt.resize, script)
+			}
+			for _, expected := range []string{
+				"genisoimage -output /seed.iso -volid cidata",
+				"--memory 2048M --cpu 2 ",
+				"-monitor telnet:127.0.0.1:4501,server,nowait",
+			} {
+				if !strings.Contains(script, expected) {
+					t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// CNIFlannel is the network plugin which node01.sh of every k8s image deploys
+const CNIFlannel = "flannel"
+
+//go:generate ./generate-manifests.sh utils cniManifestFiles cni_manifests.go cni-plugins-ds.yaml genie.yaml kubernetes-multus.yaml kubernetes-ovs-cni.yaml multus.yaml
+
+// cniManifestsDir contains the manifests of the network plugin on node01
+const cniManifestsDir = "/tmp/gocli-cni"
+
+// cniManifests contains the manifests of cniManifestFiles which are applied on top of flannel per network plugin
+var cniManifests = map[string][]string{
+	CNIFlannel: {},
+	"multus": {
+		"cni-plugins-ds.yaml",
+		"kubernetes-multus.yaml",
+		"multus.yaml",
+	},
+	"genie": {
+		"genie.yaml",
+	},
+	"ovs-cni": {
+		"cni-plugins-ds.yaml",
+		"kubernetes-multus.yaml",
+		"multus.yaml",
+		"kubernetes-ovs-cni.yaml",
+	},
+}
+
+// cniManifest is a manifest which is written to node01 and applied there
+type cniManifest struct {
+	Path    string
+	Content string
+}
+
+// cniSettings writes the manifests which gocli carries to node01, so that every k8s image can deploy them
+const cniSettings = `
+set -e
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+mkdir -p ` + cniManifestsDir + `
+{{- range .}}
+
+cat <<'EOT' >{{.Path}}
+{{.Content}}
+EOT
+kubectl apply -f {{.Path}}
+{{- end}}
+EOF
+`
+
+const cniRolloutSettings = `
+set -e
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+
+daemonsets=$(kubectl -n kube-system get daemonsets -l app=flannel -o custom-columns=NS:.metadata.namespace,NAME:.metadata.name --no-headers)
+{{- range .}}
+daemonsets="${daemonsets}
+$(kubectl get -f {{.Path}} -o custom-columns=KIND:.kind,NS:.metadata.namespace,NAME:.metadata.name --no-headers | awk '$1 == "DaemonSet" {print $2" "$3}')"
+{{- end}}
+
+echo "${daemonsets}" | sort -u | while read namespace name; do
+    if [ -n "${name}" ]; then
+        timeout 600 kubectl -n ${namespace} rollout status daemonset/${name}
+    fi
+done
+EOF
+`
+
+// ValidateCNI returns an error if the network plugin is not supported
+func ValidateCNI(cni string) error {
+	if _, exists := cniManifests[cni]; cni == "" || exists {
+		return nil
+	}
+	supported := []string{}
+	for name := range cniManifests {
+		supported = append(supported, name)
+	}
+	sort.Strings(supported)
+	return fmt.Errorf("unsupported network plugin %s, expected one of %s", cni, strings.Join(supported, ", "))
+}
+
+// GetCNIScript returns a script which applies the manifests of the network plugin on node01 after kubeadm init
+func GetCNIScript(cni string) (string, error) {
+	return renderCNI("cni", cniSettings, cniManifests[cni])
+}
+
+// GetCNIRolloutScript returns a script which waits until the DaemonSets of flannel and of the network plugin are rolled out
+func GetCNIRolloutScript(cni string) (string, error) {
+	return renderCNI("cni-rollout", cniRolloutSettings, cniManifests[cni])
+}
+
+func renderCNI(name string, settings string, files []string) (string, error) {
+	manifests := []cniManifest{}
+	for _, file := range files {
+		manifests = append(manifests, cniManifest{
+			Path:    cniManifestsDir + "/" + file,
+			Content: strings.TrimRight(cniManifestFiles[file], "\n"),
+		})
+	}
+
+	buf := new(bytes.Buffer)
+	t, err := template.New(name).Parse(settings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, manifests); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
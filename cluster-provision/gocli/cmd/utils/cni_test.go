@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCNI(t *testing.T) {
+	tests := []struct {
+		cni   string
+		fails bool
+	}{
+		{cni: ""},
+		{cni: CNIFlannel},
+		{cni: "multus"},
+		{cni: "genie"},
+		{cni: "ovs-cni"},
+		{cni: "calico", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cni, func(t *testing.T) {
+			err := ValidateCNI(tt.cni)
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// TestCNIManifestFiles fails if cni_manifests.go was not generated again after a change of the manifests
+func TestCNIManifestFiles(t *testing.T) {
+	dir := filepath.Join("..", "..", "..", "manifests")
+	if _, err := os.Stat(dir); err != nil {
+		t.Skipf("the manifests of cluster-provision are not available: %v", err)
+	}
+
+	for _, files := range cniManifests {
+		for _, file := range files {
+			content, err := ioutil.ReadFile(filepath.Join(dir, file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimRight(string(content), "\n") != strings.TrimRight(cniManifestFiles[file], "\n") {
+				t.Errorf("the manifest %s differs from cluster-provision/manifests, run go generate ./cmd/utils/", file)
+			}
+		}
+	}
+}
+
+func TestGetCNIScript(t *testing.T) {
+	tests := []struct {
+		cni       string
+		manifests []string
+	}{
+		{cni: CNIFlannel, manifests: nil},
+		{cni: "multus", manifests: []string{"cni-plugins-ds.yaml", "kubernetes-multus.yaml", "multus.yaml"}},
+		{cni: "genie", manifests: []string{"genie.yaml"}},
+		{cni: "ovs-cni", manifests: []string{"cni-plugins-ds.yaml", "kubernetes-multus.yaml", "multus.yaml", "kubernetes-ovs-cni.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cni, func(t *testing.T) {
+			script, err := GetCNIScript(tt.cni)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rollout, err := GetCNIRolloutScript(tt.cni)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if applies := strings.Count(script, "kubectl apply -f "); applies != len(tt.manifests) {
+				t.Errorf("expected %d manifests to be applied, got %d", len(tt.manifests), applies)
+			}
+			last := -1
+			for _, manifest := range tt.manifests {
+				path := cniManifestsDir + "/" + manifest
+				written := strings.Index(script, "cat <<'EOT' >"+path+"\n"+strings.TrimRight(cniManifestFiles[manifest], "\n")+"\nEOT\n")
+				if written == -1 {
+					t.Errorf("expected the script to write %s", path)
+				}
+				applied := strings.Index(script, "kubectl apply -f "+path+"\n")
+				if applied < written || applied < last {
+					t.Errorf("expected %s to be applied after it was written and in order", path)
+				}
+				last = applied
+				if !strings.Contains(rollout, "kubectl get -f "+path+" ") {
+					t.Errorf("expected the rollout script to wait for the DaemonSets of %s", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"bytes"
+	"text/template"
+)
+
+// shutdownSettings runs on the node after provisioning, it fills the free space of the guest with zeros,
+// so that qemu-img convert can drop the clusters of deleted data, and powers the guest off
+const shutdownSettings = `
+set -e
+
+# dd fails once the disk is full
+dd if=/dev/zero of=/var/tmp/zero bs=1M >/dev/null 2>&1 || true
+rm -f /var/tmp/zero
+sync
+# The SSH connection is closed by the shutdown
+nohup bash -c 'sleep 2; poweroff' >/dev/null 2>&1 &
+EOF
+`
+
+// compactSettings runs in the node container, it waits until the guest powered off and converts the disk
+// of the node with qemu-img into the next disk of the container, zeroed clusters are not written to it
+const compactSettings = `
+set -e
+cd /
+
+monitor() {
+    exec 3<>/dev/tcp/127.0.0.1/{{.}} || return 1
+    echo "$1" >&3
+    sleep 1
+    timeout 1 cat <&3 || true
+    exec 3>&-
+}
+
+# QEMU runs with -no-shutdown and keeps the stopped VM after the guest powered off
+for i in $(seq 1 300); do
+    if monitor "info status" | grep -q "status: shutdown"; then
+        break
+    fi
+    if [ ${i} -eq 300 ]; then
+        echo "the VM did not power off within 300 seconds" >&2
+        exit 1
+    fi
+    sleep 1
+done
+
+disk=/var/run/disk/disk.qcow2
+backing=$(qemu-img info -U ${disk} | sed -n 's/^backing file: \([^ ]*\).*/\1/p')
+last=$(ls -t disk*.qcow2 2>/dev/null | head -1 | sed -e 's/disk//' -e 's/.qcow2//')
+next=$(printf "disk%02d.qcow2" $((10#${last:-00} + 1)))
+
+echo "Compact ${disk} into /${next} backed by ${backing}"
+qemu-img convert -U -O qcow2 -B ${backing} ${disk} /${next}
+qemu-img info /${next}
+`
+
+// GetShutdownScript returns a script which zeroes the free space of the node and powers the node off
+func GetShutdownScript() string {
+	return shutdownSettings
+}
+
+// GetCompactScript returns a script which converts the disk of the powered off node into the node container,
+// the QEMU monitor of the node has to listen on the port
+func GetCompactScript(monitorPort int) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New("compact").Parse(compactSettings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, monitorPort); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
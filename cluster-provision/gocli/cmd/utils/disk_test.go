@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGetShutdownScript(t *testing.T) {
+	script := GetShutdownScript()
+	zero := strings.Index(script, "dd if=/dev/zero of=/var/tmp/zero")
+	poweroff := strings.Index(script, "poweroff")
+	if zero == -1 || poweroff < zero {
+		t.Errorf("expected the script to zero the free space before the power off, got\n%s", script)
+	}
+	if !strings.HasSuffix(script, "EOF\n") {
+		t.Errorf("expected the script to end the heredoc of provisionScript, got\n%s", script)
+	}
+}
+
+func TestGetCompactScript(t *testing.T) {
+	tests := []struct {
+		port     int
+		expected []string
+	}{
+		{port: 4501, expected: []string{"exec 3<>/dev/tcp/127.0.0.1/4501 ", "qemu-img convert -U -O qcow2 -B ${backing} ${disk} /${next}"}},
+		{port: 4502, expected: []string{"exec 3<>/dev/tcp/127.0.0.1/4502 "}},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.port), func(t *testing.T) {
+			script, err := GetCompactScript(tt.port)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(script, expected) {
+					t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+				}
+			}
+		})
+	}
+}
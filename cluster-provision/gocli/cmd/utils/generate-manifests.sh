@@ -0,0 +1,34 @@
+#!/bin/bash
+# Generates a go file with a map of the manifests in cluster-provision/manifests by their path, gocli writes
+# them to the nodes at run time, so that the cluster images do not need to contain them.
+#
+# usage: generate-manifests.sh <package> <variable> <output> <manifest>...
+
+set -e
+
+package=$1
+variable=$2
+output=$3
+shift 3
+manifests=$(cd "$(dirname "$0")/../../../manifests" && pwd)
+
+{
+    echo "// Code generated by generate-manifests.sh. DO NOT EDIT."
+    echo
+    echo "package ${package}"
+    echo
+    echo "// ${variable} contains manifests of cluster-provision/manifests by their path"
+    echo "var ${variable} = map[string]string{"
+    for manifest in "$@"; do
+        if grep -q '`' ${manifests}/${manifest}; then
+            echo "${manifest} contains a backtick, it can not be embedded in a raw string" >&2
+            exit 1
+        fi
+        echo "	\"${manifest}\": \`$(cat ${manifests}/${manifest})"
+        echo "\`,"
+    done
+    echo "}"
+} >${output}.tmp
+
+gofmt ${output}.tmp >${output}
+rm ${output}.tmp
@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// HookPreProvision runs on a node before its provisioning script
+	HookPreProvision = "pre-provision"
+	// HookPostProvision runs on a node after its provisioning script
+	HookPostProvision = "post-provision"
+	// HookPostCluster runs once all nodes and the optional storage and logging are provisioned
+	HookPostCluster = "post-cluster"
+)
+
+// nodeNamePattern matches the node names of a cluster: node01 to node99, then node100 and on
+var nodeNamePattern = regexp.MustCompile("^node(0[1-9]|[1-9][0-9]+)$")
+
+// NodeIndex returns the index of the node name, like 1 for node01
+func NodeIndex(node string) (int, error) {
+	if !nodeNamePattern.MatchString(node) {
+		return 0, fmt.Errorf("invalid node name %s, expected node01, node02 and so on", node)
+	}
+	return strconv.Atoi(strings.TrimPrefix(node, "node"))
+}
+
+// Hook is a script from the host which runs on the nodes at a provisioning phase
+type Hook struct {
+	Phase  string
+	Script string
+	// Node limits the hook to one node, empty means all nodes for the provision hooks and node01 for post-cluster hooks
+	Node string
+}
+
+// RunsOn returns true if the hook of the phase runs on the node
+func (h Hook) RunsOn(phase string, node string) bool {
+	if h.Phase != phase {
+		return false
+	}
+	if h.Node != "" {
+		return h.Node == node
+	}
+	return phase != HookPostCluster || node == "node01"
+}
+
+// ParseHooks parses the values of the --hook flag in the format phase=./script.sh[@nodeNN]
+func ParseHooks(values []string) ([]Hook, error) {
+	hooks := []Hook{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid hook %q, expected phase=./script.sh[@nodeNN]", value)
+		}
+
+		hook := Hook{Phase: parts[0]}
+		switch hook.Phase {
+		case HookPreProvision, HookPostProvision, HookPostCluster:
+		default:
+			return nil, fmt.Errorf("invalid hook %q, the phase has to be one of %s, %s or %s", value, HookPreProvision, HookPostProvision, HookPostCluster)
+		}
+
+		script := parts[1]
+		if i := strings.LastIndex(script, "@"); i != -1 && nodeNamePattern.MatchString(script[i+1:]) {
+			hook.Node = script[i+1:]
+			script = script[:i]
+		}
+
+		script, err := filepath.Abs(script)
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(script)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("invalid hook %q, %s is a directory", value, script)
+		}
+		hook.Script = script
+
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "hook.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// A script name with an @ which does not name a node
+	mailScript := filepath.Join(dir, "mail@example.sh")
+	if err := ioutil.WriteFile(mailScript, []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		hooks  []Hook
+		fails  bool
+	}{
+		{name: "no hooks", values: nil, hooks: []Hook{}},
+		{
+			name:   "all phases",
+			values: []string{"pre-provision=" + script, "post-provision=" + script, "post-cluster=" + script},
+			hooks: []Hook{
+				{Phase: HookPreProvision, Script: script},
+				{Phase: HookPostProvision, Script: script},
+				{Phase: HookPostCluster, Script: script},
+			},
+		},
+		{
+			name:   "hook of one node",
+			values: []string{"post-provision=" + script + "@node02"},
+			hooks:  []Hook{{Phase: HookPostProvision, Script: script, Node: "node02"}},
+		},
+		{
+			name:   "script with an @ in its name",
+			values: []string{"pre-provision=" + mailScript},
+			hooks:  []Hook{{Phase: HookPreProvision, Script: mailScript}},
+		},
+		{
+			name:   "script path which is cleaned",
+			values: []string{"pre-provision=" + dir + "/../" + filepath.Base(dir) + "/hook.sh"},
+			hooks:  []Hook{{Phase: HookPreProvision, Script: script}},
+		},
+		{name: "missing script", values: []string{"pre-provision"}, fails: true},
+		{name: "empty script", values: []string{"pre-provision="}, fails: true},
+		{name: "unknown phase", values: []string{"pre-cluster=" + script}, fails: true},
+		{name: "script which does not exist", values: []string{"pre-provision=" + filepath.Join(dir, "missing.sh")}, fails: true},
+		{name: "script which is a directory", values: []string{"pre-provision=" + dir}, fails: true},
+		{
+			name:   "hook of a node above node99",
+			values: []string{"post-provision=" + script + "@node100"},
+			hooks:  []Hook{{Phase: HookPostProvision, Script: script, Node: "node100"}},
+		},
+		{name: "invalid node", values: []string{"pre-provision=" + script + "@node1"}, fails: true},
+		{name: "node without index", values: []string{"pre-provision=" + script + "@node00"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hooks, err := ParseHooks(tt.values)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", hooks)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(hooks, tt.hooks) {
+				t.Errorf("expected %+v, got %+v", tt.hooks, hooks)
+			}
+		})
+	}
+}
+
+func TestHookRunsOn(t *testing.T) {
+	tests := []struct {
+		name  string
+		hook  Hook
+		phase string
+		node  string
+		runs  bool
+	}{
+		{name: "provision hook on every node", hook: Hook{Phase: HookPreProvision}, phase: HookPreProvision, node: "node02", runs: true},
+		{name: "other phase", hook: Hook{Phase: HookPreProvision}, phase: HookPostProvision, node: "node01", runs: false},
+		{name: "hook of the node", hook: Hook{Phase: HookPostProvision, Node: "node02"}, phase: HookPostProvision, node: "node02", runs: true},
+		{name: "hook of another node", hook: Hook{Phase: HookPostProvision, Node: "node02"}, phase: HookPostProvision, node: "node01", runs: false},
+		{name: "post-cluster hook on node01", hook: Hook{Phase: HookPostCluster}, phase: HookPostCluster, node: "node01", runs: true},
+		{name: "post-cluster hook on other nodes", hook: Hook{Phase: HookPostCluster}, phase: HookPostCluster, node: "node02", runs: false},
+		{name: "post-cluster hook of a node", hook: Hook{Phase: HookPostCluster, Node: "node02"}, phase: HookPostCluster, node: "node02", runs: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if runs := tt.hook.RunsOn(tt.phase, tt.node); runs != tt.runs {
+				t.Errorf("expected %t, got %t", tt.runs, runs)
+			}
+		})
+	}
+}
+
+func TestNodeIndex(t *testing.T) {
+	tests := []struct {
+		node  string
+		index int
+		fails bool
+	}{
+		{node: "node01", index: 1},
+		{node: "node09", index: 9},
+		{node: "node99", index: 99},
+		{node: "node100", index: 100},
+		{node: "node1000", index: 1000},
+		{node: "node00", fails: true},
+		{node: "node1", fails: true},
+		{node: "node010", fails: true},
+		{node: "master01", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			index, err := NodeIndex(tt.node)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", index)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if index != tt.index {
+				t.Errorf("expected %d, got %d", tt.index, index)
+			}
+		})
+	}
+}
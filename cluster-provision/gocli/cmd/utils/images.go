@@ -1,5 +1,15 @@
 package utils
 
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
 const (
 	// NFSGaneshaImage contains the reference to NFS docker image
 	NFSGaneshaImage = "docker.io/janeczku/nfs-ganesha@sha256:17fe1813fd20d9fdfa497a26c8a2e39dd49748cd39dbb0559df7627d9bcf4c53"
@@ -10,3 +20,130 @@ const (
 	// FluentdImage contains the reference to fluentd docker image
 	FluentdImage = "docker.io/fluent/fluentd:v1.2-debian"
 )
+
+const (
+	// ImagesConfigEnv contains the environment variable name of the images config file
+	ImagesConfigEnv = "GOCLI_IMAGES_CONFIG"
+	// NFSGaneshaImageEnv contains the environment variable name to override the NFS docker image
+	NFSGaneshaImageEnv = "GOCLI_NFS_GANESHA_IMAGE"
+	// CephImageEnv contains the environment variable name to override the CEPH docker image
+	CephImageEnv = "GOCLI_CEPH_IMAGE"
+	// DockerRegistryImageEnv contains the environment variable name to override the docker registry docker image
+	DockerRegistryImageEnv = "GOCLI_REGISTRY_IMAGE"
+	// FluentdImageEnv contains the environment variable name to override the fluentd docker image
+	FluentdImageEnv = "GOCLI_FLUENTD_IMAGE"
+)
+
+// SidecarImages contains the images of the containers which run next to the cluster
+type SidecarImages struct {
+	NFSGanesha     string `yaml:"nfsGanesha,omitempty"`
+	Ceph           string `yaml:"ceph,omitempty"`
+	DockerRegistry string `yaml:"registry,omitempty"`
+	Fluentd        string `yaml:"fluentd,omitempty"`
+}
+
+// ImagesConfig contains the cluster image and the sidecar images of a cluster,
+// it is the format of the images config file and of the lockfile written by the lock command
+type ImagesConfig struct {
+	Cluster  string        `yaml:"cluster,omitempty"`
+	Sidecars SidecarImages `yaml:"sidecars,omitempty"`
+}
+
+// AddImageFlags adds the flags to override the sidecar images
+func AddImageFlags(flagSet *pflag.FlagSet) {
+	flagSet.String("images-config", "", fmt.Sprintf("config file or lockfile with the cluster and sidecar images to use, can also be set via %s", ImagesConfigEnv))
+	flagSet.String("nfs-ganesha-image", "", fmt.Sprintf("NFS ganesha image, can also be set via %s", NFSGaneshaImageEnv))
+	flagSet.String("ceph-image", "", fmt.Sprintf("Ceph image, can also be set via %s", CephImageEnv))
+	flagSet.String("registry-image", "", fmt.Sprintf("docker registry image, can also be set via %s", DockerRegistryImageEnv))
+	flagSet.String("fluentd-image", "", fmt.Sprintf("fluentd image, can also be set via %s", FluentdImageEnv))
+}
+
+// ResolveImages returns the images to use. Explicit flags take precedence over the environment,
+// the environment takes precedence over the images config file and the config file over the defaults.
+func ResolveImages(flagSet *pflag.FlagSet) (*ImagesConfig, error) {
+	images := &ImagesConfig{
+		Sidecars: SidecarImages{
+			NFSGanesha:     NFSGaneshaImage,
+			Ceph:           CephImage,
+			DockerRegistry: DockerRegistryImage,
+			Fluentd:        FluentdImage,
+		},
+	}
+
+	configFile, err := flagSet.GetString("images-config")
+	if err != nil {
+		return nil, err
+	}
+	if configFile == "" {
+		configFile = os.Getenv(ImagesConfigEnv)
+	}
+	if configFile != "" {
+		config, err := ReadImagesConfig(configFile)
+		if err != nil {
+			return nil, err
+		}
+		images.Cluster = config.Cluster
+		overrideImage(&images.Sidecars.NFSGanesha, config.Sidecars.NFSGanesha)
+		overrideImage(&images.Sidecars.Ceph, config.Sidecars.Ceph)
+		overrideImage(&images.Sidecars.DockerRegistry, config.Sidecars.DockerRegistry)
+		overrideImage(&images.Sidecars.Fluentd, config.Sidecars.Fluentd)
+	}
+
+	for _, o := range []struct {
+		image *string
+		env   string
+		flag  string
+	}{
+		{&images.Sidecars.NFSGanesha, NFSGaneshaImageEnv, "nfs-ganesha-image"},
+		{&images.Sidecars.Ceph, CephImageEnv, "ceph-image"},
+		{&images.Sidecars.DockerRegistry, DockerRegistryImageEnv, "registry-image"},
+		{&images.Sidecars.Fluentd, FluentdImageEnv, "fluentd-image"},
+	} {
+		overrideImage(o.image, os.Getenv(o.env))
+		flagValue, err := flagSet.GetString(o.flag)
+		if err != nil {
+			return nil, err
+		}
+		overrideImage(o.image, flagValue)
+	}
+
+	return images, nil
+}
+
+// ReadImagesConfig reads an images config file or a lockfile
+func ReadImagesConfig(path string) (*ImagesConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := &ImagesConfig{}
+	if err := yaml.UnmarshalStrict(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse the images config %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// WriteImagesConfig writes the images config, for instance as lockfile
+func WriteImagesConfig(path string, config *ImagesConfig) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// PrintImagesConfig prints the images config to the writer
+func PrintImagesConfig(out io.Writer, config *ImagesConfig) error {
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(data)
+	return err
+}
+
+func overrideImage(image *string, override string) {
+	if override != "" {
+		*image = override
+	}
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestResolveImages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "images.yaml")
+	config := "cluster: kubevirtci/k8s-1.13.3\nsidecars:\n  registry: config/registry\n  ceph: config/ceph\n  fluentd: config/fluentd\n"
+	if err := ioutil.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		flags    []string
+		env      map[string]string
+		expected ImagesConfig
+	}{
+		{
+			name: "defaults",
+			expected: ImagesConfig{
+				Sidecars: SidecarImages{NFSGanesha: NFSGaneshaImage, Ceph: CephImage, DockerRegistry: DockerRegistryImage, Fluentd: FluentdImage},
+			},
+		},
+		{
+			name:  "config file overrides the defaults",
+			flags: []string{"--images-config", configFile},
+			expected: ImagesConfig{
+				Cluster:  "kubevirtci/k8s-1.13.3",
+				Sidecars: SidecarImages{NFSGanesha: NFSGaneshaImage, Ceph: "config/ceph", DockerRegistry: "config/registry", Fluentd: "config/fluentd"},
+			},
+		},
+		{
+			name: "config file from the environment",
+			env:  map[string]string{ImagesConfigEnv: configFile},
+			expected: ImagesConfig{
+				Cluster:  "kubevirtci/k8s-1.13.3",
+				Sidecars: SidecarImages{NFSGanesha: NFSGaneshaImage, Ceph: "config/ceph", DockerRegistry: "config/registry", Fluentd: "config/fluentd"},
+			},
+		},
+		{
+			name:  "environment overrides the config file",
+			flags: []string{"--images-config", configFile},
+			env:   map[string]string{DockerRegistryImageEnv: "env/registry", NFSGaneshaImageEnv: "env/nfs"},
+			expected: ImagesConfig{
+				Cluster:  "kubevirtci/k8s-1.13.3",
+				Sidecars: SidecarImages{NFSGanesha: "env/nfs", Ceph: "config/ceph", DockerRegistry: "env/registry", Fluentd: "config/fluentd"},
+			},
+		},
+		{
+			name:  "flags override the environment",
+			flags: []string{"--images-config", configFile, "--registry-image", "flag/registry", "--ceph-image", "flag/ceph"},
+			env:   map[string]string{DockerRegistryImageEnv: "env/registry"},
+			expected: ImagesConfig{
+				Cluster:  "kubevirtci/k8s-1.13.3",
+				Sidecars: SidecarImages{NFSGanesha: NFSGaneshaImage, Ceph: "flag/ceph", DockerRegistry: "flag/registry", Fluentd: "config/fluentd"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				os.Setenv(name, value)
+				defer os.Unsetenv(name)
+			}
+			flagSet := pflag.NewFlagSet("run", pflag.ContinueOnError)
+			AddImageFlags(flagSet)
+			if err := flagSet.Parse(tt.flags); err != nil {
+				t.Fatal(err)
+			}
+
+			images, err := ResolveImages(flagSet)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if *images != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, *images)
+			}
+		})
+	}
+}
+
+func TestResolveImagesInvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-images")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "images.yaml")
+	if err := ioutil.WriteFile(configFile, []byte("sidecars:\n  unknown: image\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	flagSet := pflag.NewFlagSet("run", pflag.ContinueOnError)
+	AddImageFlags(flagSet)
+	if err := flagSet.Parse([]string{"--images-config", configFile}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ResolveImages(flagSet); err == nil {
+		t.Error("expected an error for an unknown sidecar")
+	}
+}
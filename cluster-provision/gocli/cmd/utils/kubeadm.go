@@ -0,0 +1,399 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// KubeadmConfigPath contains the path of the kubeadm config on the nodes, which node01.sh passes to kubeadm init
+const KubeadmConfigPath = "/etc/kubernetes/kubeadm.conf"
+
+// kubeletArgsSettings appends the arguments to KUBELET_EXTRA_ARGS, which the provisioning of the images sets
+// in /etc/sysconfig/kubelet for kubeadm 1.11 and newer and in a drop-in of the kubelet unit before.
+// nodes.sh puts the CPU manager arguments in front of it, later arguments override earlier ones.
+// The nodes.sh of older images puts them after it instead, see kubeletLegacyArgsSettings.
+const kubeletArgsSettings = `
+set -e
+
+if [ -f /etc/sysconfig/kubelet ]; then
+    if grep -q '^KUBELET_EXTRA_ARGS=' /etc/sysconfig/kubelet; then
+        sed -i '/^KUBELET_EXTRA_ARGS=/ s|$| {{.SedArgs}}|' /etc/sysconfig/kubelet
+    else
+        echo 'KUBELET_EXTRA_ARGS={{.Args}}' >>/etc/sysconfig/kubelet
+    fi
+else
+    sed -i '/^Environment="KUBELET_EXTRA_ARGS=/ s|"$| {{.SedArgs}}"|' /etc/systemd/system/kubelet.service.d/09-kubeadm.conf
+fi
+
+systemctl daemon-reload
+EOF
+`
+
+// LegacyCPUManagerArgs is the variable in which the nodes.sh of the published images passes the CPU manager
+// arguments to the kubelet, 10-kubeadm.conf puts it after KUBELET_EXTRA_ARGS
+const LegacyCPUManagerArgs = "KUBELET_CPUMANAGER_ARGS"
+
+// kubeletLegacyArgsSettings appends the arguments to LegacyCPUManagerArgs once nodes.sh defined it, so that
+// they override the CPU manager arguments. The state of the CPU manager only fits the policy which wrote it.
+const kubeletLegacyArgsSettings = `
+set -e
+
+if [ -f /etc/sysconfig/kubelet ] && grep -q '^KUBELET_CPUMANAGER_ARGS=' /etc/sysconfig/kubelet; then
+    sed -i '/^KUBELET_CPUMANAGER_ARGS=/ s|$| {{.SedArgs}}|' /etc/sysconfig/kubelet
+else
+    sed -i '/^Environment="KUBELET_CPUMANAGER_ARGS=/ s|"$| {{.SedArgs}}"|' /etc/systemd/system/kubelet.service.d/09-kubeadm.conf
+fi
+
+systemctl daemon-reload
+rm -f /var/lib/kubelet/cpu_manager_state
+systemctl restart kubelet
+EOF
+`
+
+// KubeadmConfig contains the overrides of the kubeadm config and of the kubelet arguments
+type KubeadmConfig struct {
+	// FeatureGates are enabled or disabled on the API server, the controller manager, the scheduler and the kubelet
+	FeatureGates map[string]bool
+	// Patches are merged into the documents of the kubeadm config with the same kind
+	Patches []yaml.MapSlice
+	// KubeletArgs are appended to KUBELET_EXTRA_ARGS of the kubelet on every node
+	KubeletArgs []string
+}
+
+// AddKubeadmFlags adds the flags to override the kubeadm config and the kubelet arguments
+func AddKubeadmFlags(flagSet *pflag.FlagSet) {
+	flagSet.StringSlice("feature-gates", nil, "feature gates to set on the API server, the controller manager, the scheduler and the kubelet, like CPUManager=true,BlockVolume=false")
+	flagSet.StringArray("kubeadm-patch", nil, "yaml file which is merged into the documents of the kubeadm config with the same kind before kubeadm init, lists of maps are merged by their name or path, other lists are replaced, null values remove keys, can be repeated")
+	flagSet.StringArray("kubelet-arg", nil, "argument to append to the kubelet arguments on every node, like --max-pods=200, can be repeated")
+}
+
+// ResolveKubeadmConfig reads the kubeadm overrides from the flags
+func ResolveKubeadmConfig(flagSet *pflag.FlagSet) (*KubeadmConfig, error) {
+	config := &KubeadmConfig{FeatureGates: map[string]bool{}}
+
+	featureGates, err := flagSet.GetStringSlice("feature-gates")
+	if err != nil {
+		return nil, err
+	}
+	for _, gate := range featureGates {
+		parts := strings.SplitN(gate, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid feature gate %q, expected Name=true|false", gate)
+		}
+		enabled, err := strconv.ParseBool(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid feature gate %q, expected Name=true|false", gate)
+		}
+		config.FeatureGates[strings.TrimSpace(parts[0])] = enabled
+	}
+
+	patches, err := flagSet.GetStringArray("kubeadm-patch")
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range patches {
+		data, err := ioutil.ReadFile(patch)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := decodeDocuments(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the kubeadm patch %s: %v", patch, err)
+		}
+		for _, doc := range docs {
+			if kindOf(doc) == "" {
+				return nil, fmt.Errorf("every document of the kubeadm patch %s needs a kind", patch)
+			}
+		}
+		config.Patches = append(config.Patches, docs...)
+	}
+
+	config.KubeletArgs, err = flagSet.GetStringArray("kubelet-arg")
+	if err != nil {
+		return nil, err
+	}
+	for _, arg := range config.KubeletArgs {
+		if !strings.HasPrefix(arg, "--") || strings.ContainsAny(arg, "\"'\n") {
+			return nil, fmt.Errorf("invalid kubelet argument %q, expected --name=value", arg)
+		}
+	}
+
+	return config, nil
+}
+
+// HasKubeadmOverrides returns true if the kubeadm config of node01 needs to be patched
+func (c *KubeadmConfig) HasKubeadmOverrides() bool {
+	return len(c.FeatureGates) > 0 || len(c.Patches) > 0
+}
+
+// HasKubeletOverrides returns true if the kubelet arguments of the nodes need to be changed
+func (c *KubeadmConfig) HasKubeletOverrides() bool {
+	return len(c.FeatureGates) > 0 || len(c.KubeletArgs) > 0
+}
+
+// PatchKubeadmConfig merges the patches and the feature gates into the kubeadm config
+func (c *KubeadmConfig) PatchKubeadmConfig(original []byte) ([]byte, error) {
+	docs, err := decodeDocuments(original)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the kubeadm config: %v", err)
+	}
+
+	for _, patch := range c.Patches {
+		matched := false
+		for i := range docs {
+			if kindOf(docs[i]) == kindOf(patch) {
+				docs[i] = mergeMapSlice(docs[i], patch)
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("the kubeadm config has no document of kind %s", kindOf(patch))
+		}
+	}
+
+	if len(c.FeatureGates) > 0 {
+		matched := false
+		for i := range docs {
+			kind := kindOf(docs[i])
+			if kind != "ClusterConfiguration" && kind != "MasterConfiguration" {
+				continue
+			}
+			matched = true
+			components := [][]string{{"apiServerExtraArgs"}, {"controllerManagerExtraArgs"}, {"schedulerExtraArgs"}}
+			if apiVersion, _ := lookup(docs[i], "apiVersion").(string); strings.Contains(apiVersion, "v1beta") {
+				components = [][]string{{"apiServer", "extraArgs"}, {"controllerManager", "extraArgs"}, {"scheduler", "extraArgs"}}
+			}
+			for _, component := range components {
+				path := append(component, "feature-gates")
+				existing, _ := lookupPath(docs[i], path).(string)
+				docs[i] = setPath(docs[i], path, mergeFeatureGates(existing, c.FeatureGates))
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("the kubeadm config has no ClusterConfiguration to set the feature gates on")
+		}
+	}
+
+	return encodeDocuments(docs)
+}
+
+// GetKubeletArgsScript returns a script which appends the kubelet arguments and the feature gates to the kubelet of a node
+func (c *KubeadmConfig) GetKubeletArgsScript() (string, error) {
+	return c.renderKubeletArgs("kubelet-args", kubeletArgsSettings)
+}
+
+// GetLegacyKubeletArgsScript returns a script which appends the kubelet arguments after the CPU manager
+// arguments of the nodes.sh of the published images and restarts the kubelet, it runs after nodes.sh
+func (c *KubeadmConfig) GetLegacyKubeletArgsScript() (string, error) {
+	return c.renderKubeletArgs("kubelet-args-legacy", kubeletLegacyArgsSettings)
+}
+
+func (c *KubeadmConfig) renderKubeletArgs(name string, settings string) (string, error) {
+	args := append([]string{}, c.KubeletArgs...)
+	if len(c.FeatureGates) > 0 {
+		args = append(args, "--feature-gates="+mergeFeatureGates("", c.FeatureGates))
+	}
+	joined := strings.Join(args, " ")
+
+	buf := new(bytes.Buffer)
+	t, err := template.New(name).Parse(settings)
+	if err != nil {
+		return "", err
+	}
+	err = t.Execute(buf, struct {
+		Args    string
+		SedArgs string
+	}{
+		Args:    joined,
+		SedArgs: strings.NewReplacer(`\`, `\\`, "|", `\|`, "&", `\&`).Replace(joined),
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// mergeFeatureGates overrides the gates in the comma separated list of feature gates
+func mergeFeatureGates(existing string, gates map[string]bool) string {
+	merged := map[string]string{}
+	for _, gate := range strings.Split(existing, ",") {
+		parts := strings.SplitN(strings.TrimSpace(gate), "=", 2)
+		if len(parts) == 2 {
+			merged[parts[0]] = parts[1]
+		}
+	}
+	for name, enabled := range gates {
+		merged[name] = strconv.FormatBool(enabled)
+	}
+
+	list := []string{}
+	for name, enabled := range merged {
+		list = append(list, name+"="+enabled)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func decodeDocuments(data []byte) ([]yaml.MapSlice, error) {
+	docs := []yaml.MapSlice{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		doc := yaml.MapSlice{}
+		err := decoder.Decode(&doc)
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(doc) > 0 {
+			docs = append(docs, doc)
+		}
+	}
+}
+
+func encodeDocuments(docs []yaml.MapSlice) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	for i, doc := range docs {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
+
+func kindOf(doc yaml.MapSlice) string {
+	kind, _ := lookup(doc, "kind").(string)
+	return kind
+}
+
+func lookup(doc yaml.MapSlice, key string) interface{} {
+	for _, item := range doc {
+		if item.Key == key {
+			return item.Value
+		}
+	}
+	return nil
+}
+
+func lookupPath(doc yaml.MapSlice, path []string) interface{} {
+	var value interface{} = doc
+	for _, key := range path {
+		m, ok := value.(yaml.MapSlice)
+		if !ok {
+			return nil
+		}
+		value = lookup(m, key)
+	}
+	return value
+}
+
+func setPath(doc yaml.MapSlice, path []string, value interface{}) yaml.MapSlice {
+	for i := len(path) - 1; i > 0; i-- {
+		value = yaml.MapSlice{{Key: path[i], Value: value}}
+	}
+	return mergeMapSlice(doc, yaml.MapSlice{{Key: path[0], Value: value}})
+}
+
+// listMergeKeys are the keys which identify the items of lists in the kubeadm config, like the extraVolumes
+// of the control plane by their name or the certificate paths by their path
+var listMergeKeys = []string{"name", "path"}
+
+// mergeMapSlice merges the patch into the document: maps are merged recursively, lists of maps which all
+// have the same merge key are merged item by item, null values remove the key and all other values,
+// including other lists, replace the existing ones
+func mergeMapSlice(doc yaml.MapSlice, patch yaml.MapSlice) yaml.MapSlice {
+	merged := append(yaml.MapSlice{}, doc...)
+	for _, item := range patch {
+		index := -1
+		for i := range merged {
+			if merged[i].Key == item.Key {
+				index = i
+			}
+		}
+
+		switch {
+		case item.Value == nil:
+			if index != -1 {
+				merged = append(merged[:index], merged[index+1:]...)
+			}
+		case index == -1:
+			merged = append(merged, item)
+		default:
+			merged[index].Value = mergeValue(merged[index].Value, item.Value)
+		}
+	}
+	return merged
+}
+
+func mergeValue(existing interface{}, patch interface{}) interface{} {
+	if existingMap, ok := existing.(yaml.MapSlice); ok {
+		if patchMap, ok := patch.(yaml.MapSlice); ok {
+			return mergeMapSlice(existingMap, patchMap)
+		}
+	}
+	existingList, existingIsList := existing.([]interface{})
+	patchList, patchIsList := patch.([]interface{})
+	if !existingIsList || !patchIsList || len(patchList) == 0 {
+		return patch
+	}
+	key := listMergeKey(existingList, patchList)
+	if key == "" {
+		return patch
+	}
+
+	merged := append([]interface{}{}, existingList...)
+	for _, patchItem := range patchList {
+		patchMap := patchItem.(yaml.MapSlice)
+		index := -1
+		for i := range merged {
+			if lookup(merged[i].(yaml.MapSlice), key) == lookup(patchMap, key) {
+				index = i
+			}
+		}
+		if index == -1 {
+			merged = append(merged, patchMap)
+		} else {
+			merged[index] = mergeMapSlice(merged[index].(yaml.MapSlice), patchMap)
+		}
+	}
+	return merged
+}
+
+// listMergeKey returns the merge key which all items of the lists have, the lists are replaced if there is none
+func listMergeKey(lists ...[]interface{}) string {
+	for _, key := range listMergeKeys {
+		found := true
+		for _, list := range lists {
+			for _, item := range list {
+				m, ok := item.(yaml.MapSlice)
+				if !ok {
+					found = false
+					break
+				}
+				if _, ok := lookup(m, key).(string); !ok {
+					found = false
+					break
+				}
+			}
+		}
+		if found {
+			return key
+		}
+	}
+	return ""
+}
@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func mustDecode(t *testing.T, data string) []yaml.MapSlice {
+	docs, err := decodeDocuments([]byte(data))
+	if err != nil {
+		t.Fatalf("failed to decode %s: %v", data, err)
+	}
+	return docs
+}
+
+func TestPatchKubeadmConfig(t *testing.T) {
+	original := `apiVersion: kubeadm.k8s.io/v1beta1
+kind: InitConfiguration
+nodeRegistration:
+  name: node01
+  taints: []
+---
+apiVersion: kubeadm.k8s.io/v1beta1
+kind: ClusterConfiguration
+apiServer:
+  certSANs:
+  - 192.168.66.101
+  extraArgs:
+    enable-admission-plugins: NodeRestriction
+    feature-gates: BlockVolume=true
+  extraVolumes:
+  - name: audit
+    hostPath: /etc/kubernetes/audit
+    mountPath: /etc/kubernetes/audit
+networking:
+  podSubnet: 10.244.0.0/16
+  serviceSubnet: 10.96.0.0/12
+`
+
+	tests := []struct {
+		name     string
+		config   KubeadmConfig
+		original string
+		expected string
+		fails    bool
+	}{
+		{
+			name:     "no overrides",
+			config:   KubeadmConfig{},
+			original: original,
+			expected: original,
+		},
+		{
+			name: "maps are merged",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: ClusterConfiguration
+networking:
+  serviceSubnet: 10.97.0.0/16
+  dnsDomain: cluster.test
+`)},
+			original: original,
+			expected: strings.Replace(original, "  serviceSubnet: 10.96.0.0/12\n", "  serviceSubnet: 10.97.0.0/16\n  dnsDomain: cluster.test\n", 1),
+		},
+		{
+			name: "null values remove keys",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: ClusterConfiguration
+apiServer:
+  extraArgs:
+    enable-admission-plugins: null
+`)},
+			original: original,
+			expected: strings.Replace(original, "    enable-admission-plugins: NodeRestriction\n", "", 1),
+		},
+		{
+			name: "lists of maps are merged by name",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+  - name: audit
+    readOnly: true
+  - name: policies
+    hostPath: /etc/kubernetes/policies
+    mountPath: /etc/kubernetes/policies
+`)},
+			original: original,
+			expected: strings.Replace(original, "    mountPath: /etc/kubernetes/audit\n", `    mountPath: /etc/kubernetes/audit
+    readOnly: true
+  - name: policies
+    hostPath: /etc/kubernetes/policies
+    mountPath: /etc/kubernetes/policies
+`, 1),
+		},
+		{
+			name: "other lists are replaced",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: ClusterConfiguration
+apiServer:
+  certSANs:
+  - 192.168.66.102
+`)},
+			original: original,
+			expected: strings.Replace(original, "  - 192.168.66.101\n", "  - 192.168.66.102\n", 1),
+		},
+		{
+			name: "empty lists replace lists of maps",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: ClusterConfiguration
+apiServer:
+  extraVolumes: []
+`)},
+			original: original,
+			expected: strings.Replace(original, `  extraVolumes:
+  - name: audit
+    hostPath: /etc/kubernetes/audit
+    mountPath: /etc/kubernetes/audit
+`, "  extraVolumes: []\n", 1),
+		},
+		{
+			name: "patches of several kinds",
+			config: KubeadmConfig{Patches: mustDecode(t, `kind: InitConfiguration
+nodeRegistration:
+  criSocket: /var/run/crio/crio.sock
+---
+kind: ClusterConfiguration
+networking:
+  podSubnet: 10.245.0.0/16
+`)},
+			original: original,
+			expected: strings.Replace(strings.Replace(original, "  taints: []\n", "  taints: []\n  criSocket: /var/run/crio/crio.sock\n", 1),
+				"10.244.0.0/16", "10.245.0.0/16", 1),
+		},
+		{
+			name:     "feature gates of the v1beta1 config",
+			config:   KubeadmConfig{FeatureGates: map[string]bool{"CPUManager": true, "BlockVolume": false}},
+			original: original,
+			expected: strings.Replace(original, "    feature-gates: BlockVolume=true\n", "    feature-gates: BlockVolume=false,CPUManager=true\n", 1) + `controllerManager:
+  extraArgs:
+    feature-gates: BlockVolume=false,CPUManager=true
+scheduler:
+  extraArgs:
+    feature-gates: BlockVolume=false,CPUManager=true
+`,
+		},
+		{
+			name:   "feature gates of the v1alpha1 config",
+			config: KubeadmConfig{FeatureGates: map[string]bool{"CPUManager": true}},
+			original: `apiVersion: kubeadm.k8s.io/v1alpha1
+kind: MasterConfiguration
+apiServerExtraArgs:
+  runtime-config: admissionregistration.k8s.io/v1alpha1
+`,
+			expected: `apiVersion: kubeadm.k8s.io/v1alpha1
+kind: MasterConfiguration
+apiServerExtraArgs:
+  runtime-config: admissionregistration.k8s.io/v1alpha1
+  feature-gates: CPUManager=true
+controllerManagerExtraArgs:
+  feature-gates: CPUManager=true
+schedulerExtraArgs:
+  feature-gates: CPUManager=true
+`,
+		},
+		{
+			name:     "patch of a missing kind",
+			config:   KubeadmConfig{Patches: mustDecode(t, "kind: KubeletConfiguration\nmaxPods: 200\n")},
+			original: original,
+			fails:    true,
+		},
+		{
+			name:     "feature gates without a cluster configuration",
+			config:   KubeadmConfig{FeatureGates: map[string]bool{"CPUManager": true}},
+			original: "apiVersion: kubeadm.k8s.io/v1beta1\nkind: InitConfiguration\n",
+			fails:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := tt.config.PatchKubeadmConfig([]byte(tt.original))
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got\n%s", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mustDecode(t, string(patched)), mustDecode(t, tt.expected)) {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, patched)
+			}
+		})
+	}
+}
+
+func TestMergeFeatureGates(t *testing.T) {
+	tests := []struct {
+		existing string
+		gates    map[string]bool
+		expected string
+	}{
+		{existing: "", gates: map[string]bool{"CPUManager": true}, expected: "CPUManager=true"},
+		{existing: "BlockVolume=true", gates: map[string]bool{"CPUManager": true}, expected: "BlockVolume=true,CPUManager=true"},
+		{existing: "BlockVolume=true, CPUManager=false", gates: map[string]bool{"CPUManager": true}, expected: "BlockVolume=true,CPUManager=true"},
+		{existing: "BlockVolume=true", gates: map[string]bool{"BlockVolume": false}, expected: "BlockVolume=false"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.existing, func(t *testing.T) {
+			if merged := mergeFeatureGates(tt.existing, tt.gates); merged != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, merged)
+			}
+		})
+	}
+}
+
+func TestGetKubeletArgsScript(t *testing.T) {
+	config := KubeadmConfig{
+		FeatureGates: map[string]bool{"CPUManager": false},
+		KubeletArgs:  []string{"--max-pods=200", "--root-dir=/var/lib/kubelet|x&y"},
+	}
+	script, err := config.GetKubeletArgsScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		`sed -i '/^KUBELET_EXTRA_ARGS=/ s|$| --max-pods=200 --root-dir=/var/lib/kubelet\|x\&y --feature-gates=CPUManager=false|' /etc/sysconfig/kubelet`,
+		`echo 'KUBELET_EXTRA_ARGS=--max-pods=200 --root-dir=/var/lib/kubelet|x&y --feature-gates=CPUManager=false' >>/etc/sysconfig/kubelet`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+		}
+	}
+}
+
+func TestGetLegacyKubeletArgsScript(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skipf("bash is not available: %v", err)
+	}
+
+	config := KubeadmConfig{
+		FeatureGates: map[string]bool{"CPUManager": true},
+		KubeletArgs:  []string{"--cpu-manager-policy=none", "--root-dir=/var/lib/kubelet|x&y"},
+	}
+	script, err := config.GetLegacyKubeletArgsScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(script, "\nEOF\n") {
+		t.Fatalf("expected the script to end with EOF, got\n%s", script)
+	}
+
+	args := " --cpu-manager-policy=none --root-dir=/var/lib/kubelet|x&y --feature-gates=CPUManager=true"
+	tests := []struct {
+		name      string
+		sysconfig string
+		dropIn    string
+		expected  string
+	}{
+		{
+			name:      "sysconfig of kubeadm 1.11 and newer",
+			sysconfig: "KUBELET_EXTRA_ARGS=\nKUBELET_CPUMANAGER_ARGS=--cpu-manager-policy=static\n",
+			expected:  "KUBELET_EXTRA_ARGS=\nKUBELET_CPUMANAGER_ARGS=--cpu-manager-policy=static" + args + "\n",
+		},
+		{
+			name:     "drop-in of older kubeadm",
+			dropIn:   "[Service]\nEnvironment=\"KUBELET_CPUMANAGER_ARGS=--cpu-manager-policy=static\"\n",
+			expected: "[Service]\nEnvironment=\"KUBELET_CPUMANAGER_ARGS=--cpu-manager-policy=static" + args + "\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gocli-kubelet-args")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			sysconfig := filepath.Join(dir, "kubelet")
+			dropIn := filepath.Join(dir, "09-kubeadm.conf")
+			edited := dropIn
+			if tt.sysconfig != "" {
+				if err := ioutil.WriteFile(sysconfig, []byte(tt.sysconfig), 0644); err != nil {
+					t.Fatal(err)
+				}
+				edited = sysconfig
+			}
+			if tt.dropIn != "" {
+				if err := ioutil.WriteFile(dropIn, []byte(tt.dropIn), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			local := strings.NewReplacer(
+				"/etc/sysconfig/kubelet", sysconfig,
+				"/etc/systemd/system/kubelet.service.d/09-kubeadm.conf", dropIn,
+				"/var/lib/kubelet/cpu_manager_state", filepath.Join(dir, "cpu_manager_state"),
+			).Replace(strings.TrimSuffix(script, "EOF\n"))
+			if out, err := exec.Command(bash, "-c", "systemctl() { :; }\n"+local).CombinedOutput(); err != nil {
+				t.Fatalf("unexpected error: %v\n%s", err, out)
+			}
+
+			content, err := ioutil.ReadFile(edited)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
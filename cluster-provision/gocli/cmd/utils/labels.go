@@ -0,0 +1,139 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var (
+	labelKeyPattern   = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9.]*[a-zA-Z0-9])?/)?[a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?$`)
+	labelValuePattern = regexp.MustCompile(`^([a-zA-Z0-9]([-a-zA-Z0-9_.]*[a-zA-Z0-9])?)?$`)
+)
+
+const nodeLabelsSettings = `
+set -e
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+
+# The node registers itself shortly after kubeadm join
+timeout 300 bash -c 'until kubectl get node {{.Node}} >/dev/null 2>&1; do sleep 2; done'
+{{- range .Labels}}
+kubectl label node {{$.Node}} {{.}} --overwrite
+{{- end}}
+{{- range .Taints}}
+kubectl taint node {{$.Node}} {{.}} --overwrite
+{{- end}}
+EOF
+`
+
+// NodeLabel is a label which is set on a node after it joined the cluster
+type NodeLabel struct {
+	Node  string
+	Key   string
+	Value string
+}
+
+func (l NodeLabel) String() string {
+	return l.Key + "=" + l.Value
+}
+
+// NodeTaint is a taint which is set on a node after it joined the cluster
+type NodeTaint struct {
+	Node   string
+	Key    string
+	Value  string
+	Effect string
+}
+
+func (t NodeTaint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// ParseNodeLabels parses the values of the --node-label flag in the format nodeNN=key=value
+func ParseNodeLabels(values []string) ([]NodeLabel, error) {
+	labels := []NodeLabel{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 3)
+		if len(parts) != 3 || !nodeNamePattern.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid node label %q, expected nodeNN=key=value", value)
+		}
+		if !labelKeyPattern.MatchString(parts[1]) || !labelValuePattern.MatchString(parts[2]) {
+			return nil, fmt.Errorf("invalid node label %q, the key or the value is not a valid label", value)
+		}
+		labels = append(labels, NodeLabel{Node: parts[0], Key: parts[1], Value: parts[2]})
+	}
+	return labels, nil
+}
+
+// ParseNodeTaints parses the values of the --node-taint flag in the format nodeNN=key[=value]:effect
+func ParseNodeTaints(values []string) ([]NodeTaint, error) {
+	taints := []NodeTaint{}
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || !nodeNamePattern.MatchString(parts[0]) {
+			return nil, fmt.Errorf("invalid node taint %q, expected nodeNN=key[=value]:effect", value)
+		}
+
+		taint := NodeTaint{Node: parts[0]}
+		i := strings.LastIndex(parts[1], ":")
+		if i == -1 {
+			return nil, fmt.Errorf("invalid node taint %q, expected nodeNN=key[=value]:effect", value)
+		}
+		taint.Effect = parts[1][i+1:]
+		switch taint.Effect {
+		case "NoSchedule", "PreferNoSchedule", "NoExecute":
+		default:
+			return nil, fmt.Errorf("invalid node taint %q, the effect has to be NoSchedule, PreferNoSchedule or NoExecute", value)
+		}
+
+		keyValue := strings.SplitN(parts[1][:i], "=", 2)
+		taint.Key = keyValue[0]
+		if len(keyValue) == 2 {
+			taint.Value = keyValue[1]
+		}
+		if !labelKeyPattern.MatchString(taint.Key) || !labelValuePattern.MatchString(taint.Value) {
+			return nil, fmt.Errorf("invalid node taint %q, the key or the value is not valid", value)
+		}
+
+		taints = append(taints, taint)
+	}
+	return taints, nil
+}
+
+// GetNodeLabelsScript returns a script which sets the labels and the taints of the node, it has to run on node01
+func GetNodeLabelsScript(node string, labels []NodeLabel, taints []NodeTaint) (string, error) {
+	settings := struct {
+		Node   string
+		Labels []NodeLabel
+		Taints []NodeTaint
+	}{Node: node}
+	for _, label := range labels {
+		if label.Node == node {
+			settings.Labels = append(settings.Labels, label)
+		}
+	}
+	for _, taint := range taints {
+		if taint.Node == node {
+			settings.Taints = append(settings.Taints, taint)
+		}
+	}
+	if len(settings.Labels) == 0 && len(settings.Taints) == 0 {
+		return "", nil
+	}
+
+	buf := new(bytes.Buffer)
+	t, err := template.New("node-labels").Parse(nodeLabelsSettings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, settings); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNodeLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		labels []NodeLabel
+		fails  bool
+	}{
+		{name: "no labels", values: nil, labels: []NodeLabel{}},
+		{
+			name:   "labels of several nodes",
+			values: []string{"node01=disktype=ssd", "node02=kubevirt.io/schedulable=true"},
+			labels: []NodeLabel{
+				{Node: "node01", Key: "disktype", Value: "ssd"},
+				{Node: "node02", Key: "kubevirt.io/schedulable", Value: "true"},
+			},
+		},
+		{
+			name:   "empty value",
+			values: []string{"node01=node-role.kubernetes.io/worker="},
+			labels: []NodeLabel{{Node: "node01", Key: "node-role.kubernetes.io/worker", Value: ""}},
+		},
+		{
+			name:   "node above node99",
+			values: []string{"node100=disktype=ssd"},
+			labels: []NodeLabel{{Node: "node100", Key: "disktype", Value: "ssd"}},
+		},
+		{name: "missing value", values: []string{"node01=disktype"}, fails: true},
+		{name: "missing node", values: []string{"disktype=ssd"}, fails: true},
+		{name: "invalid node name", values: []string{"node1=disktype=ssd"}, fails: true},
+		{name: "invalid key", values: []string{"node01=-disktype=ssd"}, fails: true},
+		{name: "invalid prefix", values: []string{"node01=kubevirt.io/a/b=ssd"}, fails: true},
+		{name: "invalid value", values: []string{"node01=disktype=s=d"}, fails: true},
+		{name: "value with a space", values: []string{"node01=disktype=s d"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			labels, err := ParseNodeLabels(tt.values)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", labels)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(labels, tt.labels) {
+				t.Errorf("expected %+v, got %+v", tt.labels, labels)
+			}
+		})
+	}
+}
+
+func TestParseNodeTaints(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		taints []NodeTaint
+		fails  bool
+	}{
+		{name: "no taints", values: nil, taints: []NodeTaint{}},
+		{
+			name:   "taint with a value",
+			values: []string{"node02=dedicated=gpu:NoSchedule"},
+			taints: []NodeTaint{{Node: "node02", Key: "dedicated", Value: "gpu", Effect: "NoSchedule"}},
+		},
+		{
+			name:   "taints without a value",
+			values: []string{"node01=node-role.kubernetes.io/master:PreferNoSchedule", "node03=maintenance:NoExecute"},
+			taints: []NodeTaint{
+				{Node: "node01", Key: "node-role.kubernetes.io/master", Effect: "PreferNoSchedule"},
+				{Node: "node03", Key: "maintenance", Effect: "NoExecute"},
+			},
+		},
+		{
+			name:   "node above node99",
+			values: []string{"node120=dedicated=gpu:NoSchedule"},
+			taints: []NodeTaint{{Node: "node120", Key: "dedicated", Value: "gpu", Effect: "NoSchedule"}},
+		},
+		{name: "missing effect", values: []string{"node02=dedicated=gpu"}, fails: true},
+		{name: "unknown effect", values: []string{"node02=dedicated=gpu:NoRun"}, fails: true},
+		{name: "missing node", values: []string{"dedicated=gpu:NoSchedule"}, fails: true},
+		{name: "missing key", values: []string{"node02=:NoSchedule"}, fails: true},
+		{name: "invalid value", values: []string{"node02=dedicated=g:pu:NoSchedule"}, fails: true},
+		{name: "invalid key", values: []string{"node02=dedi cated:NoSchedule"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taints, err := ParseNodeTaints(tt.values)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", taints)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(taints, tt.taints) {
+				t.Errorf("expected %+v, got %+v", tt.taints, taints)
+			}
+		})
+	}
+}
+
+func TestGetNodeLabelsScript(t *testing.T) {
+	labels := []NodeLabel{
+		{Node: "node01", Key: "disktype", Value: "ssd"},
+		{Node: "node02", Key: "kubevirt.io/schedulable", Value: "true"},
+	}
+	taints := []NodeTaint{
+		{Node: "node02", Key: "dedicated", Value: "gpu", Effect: "NoSchedule"},
+		{Node: "node02", Key: "maintenance", Effect: "NoExecute"},
+	}
+
+	tests := []struct {
+		node     string
+		expected []string
+		empty    bool
+	}{
+		{node: "node01", expected: []string{"kubectl label node node01 disktype=ssd --overwrite"}},
+		{
+			node: "node02",
+			expected: []string{
+				"kubectl label node node02 kubevirt.io/schedulable=true --overwrite",
+				"kubectl taint node node02 dedicated=gpu:NoSchedule --overwrite",
+				"kubectl taint node node02 maintenance:NoExecute --overwrite",
+			},
+		},
+		{node: "node03", empty: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.node, func(t *testing.T) {
+			script, err := GetNodeLabelsScript(tt.node, labels, taints)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.empty {
+				if script != "" {
+					t.Errorf("expected no script, got\n%s", script)
+				}
+				return
+			}
+			if strings.Count(script, "kubectl label")+strings.Count(script, "kubectl taint") != len(tt.expected) {
+				t.Errorf("expected only the labels and taints of %s, got\n%s", tt.node, script)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(script, expected) {
+					t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+				}
+			}
+		})
+	}
+}
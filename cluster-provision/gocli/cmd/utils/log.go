@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/docker/docker/client"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// tailLines is the number of lines the logger keeps of every node and sidecar phase
+const tailLines = 500
+
+// ProvisionLogger hands out writers for the output of nodes and sidecars.
+// Every line is prefixed with the node or sidecar name, and if a log directory is set,
+// the output is additionally written to one log file per node and phase.
+// The last lines of every phase are kept in memory to be saved as failure artifacts.
+type ProvisionLogger struct {
+	dir       string
+	stdout    io.Writer
+	stderr    io.Writer
+	outLock   *sync.Mutex
+	errLock   *sync.Mutex
+	tails     map[string]*tailBuffer
+	tailsLock *sync.Mutex
+}
+
+// LogStreams contains the stdout and stderr writers of one node or sidecar phase
+type LogStreams struct {
+	Stdout  io.Writer
+	Stderr  io.Writer
+	closers []io.Closer
+}
+
+// NewProvisionLogger returns a new provision logger which writes to stdout and stderr,
+// and to the log directory if it is not empty
+func NewProvisionLogger(dir string, stdout io.Writer, stderr io.Writer) (*ProvisionLogger, error) {
+	if dir != "" {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(absDir, 0755); err != nil {
+			return nil, err
+		}
+		dir = absDir
+	}
+
+	outLock := &sync.Mutex{}
+	errLock := outLock
+	if stdout != stderr {
+		errLock = &sync.Mutex{}
+	}
+
+	return &ProvisionLogger{
+		dir:       dir,
+		stdout:    stdout,
+		stderr:    stderr,
+		outLock:   outLock,
+		errLock:   errLock,
+		tails:     map[string]*tailBuffer{},
+		tailsLock: &sync.Mutex{},
+	}, nil
+}
+
+// Streams returns the writers for the given phase of the node or sidecar,
+// the returned streams have to be closed to flush incomplete lines and to close the log file
+func (l *ProvisionLogger) Streams(name string, phase string) (*LogStreams, error) {
+	prefix := fmt.Sprintf("[%s] ", name)
+	stdout := &prefixWriter{out: l.stdout, prefix: prefix, lock: l.outLock}
+	stderr := &prefixWriter{out: l.stderr, prefix: prefix, lock: l.errLock}
+
+	key := fmt.Sprintf("%s-%s", name, phase)
+	l.tailsLock.Lock()
+	tail, exists := l.tails[key]
+	if !exists {
+		tail = &tailBuffer{}
+		l.tails[key] = tail
+	}
+	l.tailsLock.Unlock()
+	tailLock := &sync.Mutex{}
+	tailStdout := &prefixWriter{out: tail, lock: tailLock}
+	tailStderr := &prefixWriter{out: tail, lock: tailLock}
+
+	streams := &LogStreams{
+		Stdout:  io.MultiWriter(stdout, tailStdout),
+		Stderr:  io.MultiWriter(stderr, tailStderr),
+		closers: []io.Closer{stdout, stderr, tailStdout, tailStderr},
+	}
+
+	if l.dir == "" {
+		return streams, nil
+	}
+
+	file, err := os.OpenFile(filepath.Join(l.dir, fmt.Sprintf("%s-%s.log", name, phase)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	fileLock := &sync.Mutex{}
+	fileStdout := &prefixWriter{out: file, lock: fileLock}
+	fileStderr := &prefixWriter{out: file, lock: fileLock}
+
+	streams.Stdout = io.MultiWriter(streams.Stdout, fileStdout)
+	streams.Stderr = io.MultiWriter(streams.Stderr, fileStderr)
+	streams.closers = append(streams.closers, fileStdout, fileStderr, file)
+	return streams, nil
+}
+
+// WriteTails writes the last lines of every node and sidecar phase to one file per phase in the folder
+func (l *ProvisionLogger) WriteTails(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	l.tailsLock.Lock()
+	defer l.tailsLock.Unlock()
+	for key, tail := range l.tails {
+		if err := ioutil.WriteFile(filepath.Join(dir, key+".log"), tail.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close flushes incomplete lines and closes the log file
+func (s *LogStreams) Close() error {
+	var firstErr error
+	for _, c := range s.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// prefixWriter buffers the output until a line is complete and writes it with the prefix
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+	lock   *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.writeLine(w.buf[:i]); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) Close() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.writeLine(w.buf)
+	w.buf = nil
+	return err
+}
+
+func (w *prefixWriter) writeLine(line []byte) error {
+	// Only keep what a terminal would show after the last carriage return
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		line = line[i+1:]
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := fmt.Fprintf(w.out, "%s%s\n", w.prefix, line)
+	return err
+}
+
+// tailBuffer keeps the last tailLines lines written to it
+type tailBuffer struct {
+	lock  sync.Mutex
+	lines [][]byte
+}
+
+// Write expects complete lines, as the prefixWriter writes them
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.lines = append(t.lines, append([]byte{}, p...))
+	if len(t.lines) > tailLines {
+		t.lines = t.lines[len(t.lines)-tailLines:]
+	}
+	return len(p), nil
+}
+
+// Bytes returns the kept lines
+func (t *tailBuffer) Bytes() []byte {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return bytes.Join(t.lines, nil)
+}
+
+// Exec runs the command in the container and writes its output to the streams of the node or sidecar phase
+func (l *ProvisionLogger) Exec(cli *client.Client, container string, name string, phase string, args []string) (bool, error) {
+	streams, err := l.Streams(name, phase)
+	if err != nil {
+		return false, err
+	}
+	defer streams.Close()
+
+	exitCode, err := docker.ExecStreams(cli, container, args, streams.Stdout, streams.Stderr)
+	if err != nil {
+		return false, err
+	}
+	return exitCode == 0, nil
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{name: "no output", writes: nil, expected: ""},
+		{name: "complete lines", writes: []string{"hello\nworld\n"}, expected: "[node01] hello\n[node01] world\n"},
+		{name: "line split across writes", writes: []string{"hel", "lo\nwor", "ld\n"}, expected: "[node01] hello\n[node01] world\n"},
+		{name: "empty line", writes: []string{"\n"}, expected: "[node01] \n"},
+		{name: "partial final line", writes: []string{"hello\n", "no newline"}, expected: "[node01] hello\n[node01] no newline\n"},
+		{name: "progress line", writes: []string{"10%\r", "50%\r100%\n"}, expected: "[node01] 100%\n"},
+		{name: "carriage return line feed", writes: []string{"hello\r\n"}, expected: "[node01] hello\n"},
+		{name: "partial progress line", writes: []string{"10%\r50%"}, expected: "[node01] 50%\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			w := &prefixWriter{out: out, prefix: "[node01] ", lock: &sync.Mutex{}}
+			for _, write := range tt.writes {
+				n, err := w.Write([]byte(write))
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if n != len(write) {
+					t.Errorf("expected %d bytes to be written, got %d", len(write), n)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, out)
+			}
+		})
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	tail := &tailBuffer{}
+	expected := new(bytes.Buffer)
+	for i := 0; i < tailLines+10; i++ {
+		line := []byte(string(rune('a'+i%26)) + "\n")
+		tail.Write(line)
+		if i >= 10 {
+			expected.Write(line)
+		}
+	}
+	if !bytes.Equal(tail.Bytes(), expected.Bytes()) {
+		t.Errorf("expected the last %d lines, got\n%s", tailLines, tail.Bytes())
+	}
+}
@@ -0,0 +1,332 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+)
+
+const (
+	// LogFormatJSON writes every record as one JSON object per line
+	LogFormatJSON = "json"
+	// LogFormatText writes only the log lines of the pods and the messages of the journal
+	LogFormatText = "text"
+)
+
+// journalUnits are the journald sources collected on every node, the name is the suffix of the tag
+var journalUnits = []struct {
+	Name    string
+	Matches string
+}{
+	{"kubelet", `[{ "_SYSTEMD_UNIT": "kubelet.service" }]`},
+	{"docker", `[{ "_SYSTEMD_UNIT": "docker.service" }]`},
+	{"crio", `[{ "_SYSTEMD_UNIT": "crio.service" }]`},
+	{"kernel", `[{ "_TRANSPORT": "kernel" }]`},
+	{"audit", `[{ "_TRANSPORT": "audit" }]`},
+}
+
+// aggregatorSettings is the config of the fluentd sidecar, the files are split by node, namespace and pod,
+// rotated every timekey and compressed
+const aggregatorSettings = `
+<system>
+  log_level info
+</system>
+
+<source>
+  @type forward
+  @log_level error
+  port {{.Port}}
+</source>
+
+<match fluent.**>
+  @type null
+</match>
+
+<match kubernetes.**>
+  @type file
+  path /fluentd/log/collected/${node}/pods/${namespace}/${pod}.%Y%m%d-%H%M
+  append true
+  compress gzip
+  <format>
+{{- if eq .Format "text"}}
+    @type single_value
+    message_key log
+    add_newline false
+{{- else}}
+    @type json
+{{- end}}
+  </format>
+  <buffer node,namespace,pod,time>
+    @type file
+    path /fluentd/log/buffer/pods
+    timekey {{.Rotate}}
+    timekey_use_utc true
+    timekey_wait 0
+    flush_mode interval
+    flush_interval 10s
+    flush_at_shutdown true
+  </buffer>
+</match>
+
+<match journal.**>
+  @type file
+  path /fluentd/log/collected/${node}/${tag}.%Y%m%d-%H%M
+  append true
+  compress gzip
+  <format>
+{{- if eq .Format "text"}}
+    @type single_value
+    message_key MESSAGE
+{{- else}}
+    @type json
+{{- end}}
+  </format>
+  <buffer node,tag,time>
+    @type file
+    path /fluentd/log/buffer/journal
+    timekey {{.Rotate}}
+    timekey_use_utc true
+    timekey_wait 0
+    flush_mode interval
+    flush_interval 10s
+    flush_at_shutdown true
+  </buffer>
+</match>
+`
+
+// loggingSettings runs on node01 and deploys a fluentd DaemonSet which forwards
+// the container logs and the journal of every node to the fluentd sidecar
+const loggingSettings = `
+set -e
+
+cat <<'EOT' >/tmp/gocli-logging.yaml
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: logging
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: fluentd-config
+  namespace: logging
+data:
+  fluent.conf: |+
+    <match fluent.**>
+      @type null
+    </match>
+
+    <source>
+      @type tail
+      @id in_tail_container_logs
+      path /var/log/containers/*.log
+      pos_file /var/log/fluentd-containers.log.pos
+      tag kubernetes.*
+      read_from_head true
+      <parse>
+        @type json
+        time_format %Y-%m-%dT%H:%M:%S.%NZ
+      </parse>
+    </source>
+
+    <filter kubernetes.**>
+      @type kubernetes_metadata
+      @id filter_kube_metadata
+    </filter>
+
+    <filter kubernetes.**>
+      @type record_transformer
+      enable_ruby true
+      <record>
+        namespace ${record.dig("kubernetes", "namespace_name")}
+        pod ${record.dig("kubernetes", "pod_name")}
+        container ${record.dig("kubernetes", "container_name")}
+      </record>
+    </filter>
+{{- range .Units}}
+
+    <source>
+      @type systemd
+      @id in_systemd_{{.Name}}
+      path "#{File.directory?('/var/log/journal') ? '/var/log/journal' : '/run/log/journal'}"
+      matches {{.Matches}}
+      <storage>
+        @type local
+        persistent true
+        path /var/log/fluentd-journald-{{.Name}}-cursor.json
+      </storage>
+      read_from_head true
+      tag journal.{{.Name}}
+    </source>
+{{- end}}
+
+    <filter **>
+      @type record_transformer
+      <record>
+        node "#{ENV['NODE_NAME']}"
+      </record>
+    </filter>
+
+    <match **>
+      @type forward
+      @log_level error
+      heartbeat_type none
+      <buffer>
+        @type file
+        path /var/tmp/fluent/forward.*.buffer
+        flush_interval 5s
+      </buffer>
+      <server>
+        name aggregator
+        host {{.Host}}
+        port {{.Port}}
+      </server>
+    </match>
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: fluentd
+  namespace: logging
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: fluentd
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - pods
+  - namespaces
+  verbs:
+  - get
+  - list
+  - watch
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: fluentd
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: fluentd
+subjects:
+- kind: ServiceAccount
+  name: fluentd
+  namespace: logging
+---
+apiVersion: apps/v1
+kind: DaemonSet
+metadata:
+  name: fluentd
+  namespace: logging
+  labels:
+    k8s-app: fluentd-logging
+spec:
+  selector:
+    matchLabels:
+      k8s-app: fluentd-logging
+  template:
+    metadata:
+      labels:
+        k8s-app: fluentd-logging
+    spec:
+      serviceAccountName: fluentd
+      tolerations:
+      - operator: Exists
+      containers:
+      - name: fluentd
+        image: fluent/fluentd-kubernetes-daemonset:v1.2-debian-syslog
+        securityContext:
+          privileged: true
+        env:
+        - name: NODE_NAME
+          valueFrom:
+            fieldRef:
+              fieldPath: spec.nodeName
+        volumeMounts:
+        - name: varlog
+          mountPath: /var/log
+        - name: runlogjournal
+          mountPath: /run/log/journal
+          readOnly: true
+        - name: varlibdockercontainers
+          mountPath: /var/lib/docker/containers
+          readOnly: true
+        - name: configs
+          mountPath: /fluentd/etc/
+      terminationGracePeriodSeconds: 30
+      volumes:
+      - name: varlog
+        hostPath:
+          path: /var/log
+      - name: runlogjournal
+        hostPath:
+          path: /run/log/journal
+      - name: varlibdockercontainers
+        hostPath:
+          path: /var/lib/docker/containers
+      - name: configs
+        configMap:
+          name: fluentd-config
+EOT
+
+export KUBECONFIG=/etc/kubernetes/admin.conf
+kubectl apply -f /tmp/gocli-logging.yaml
+timeout 600 kubectl -n logging rollout status daemonset/fluentd
+EOF
+`
+
+// ValidateLogFormat returns an error if the format of the collected logs is not supported
+func ValidateLogFormat(format string) error {
+	if format != LogFormatJSON && format != LogFormatText {
+		return fmt.Errorf("unsupported log format %s, expected %s or %s", format, LogFormatJSON, LogFormatText)
+	}
+	return nil
+}
+
+// GetLogAggregatorConfig returns the config of the fluentd sidecar, which writes the collected logs
+// in the format to one gzip compressed file per node and pod or per node and journal source
+// and starts new files every rotate interval
+func GetLogAggregatorConfig(format string, rotate time.Duration) (string, error) {
+	if rotate < time.Minute {
+		return "", fmt.Errorf("the log rotation interval has to be at least one minute")
+	}
+	return renderLogging("log-aggregator", aggregatorSettings, struct {
+		Port   int
+		Format string
+		Rotate int
+	}{
+		Port:   PortFluentd,
+		Format: format,
+		Rotate: int(rotate.Seconds()),
+	})
+}
+
+// GetLoggingScript returns a script which deploys the fluentd DaemonSet, it has to run on node01
+func GetLoggingScript() (string, error) {
+	return renderLogging("logging", loggingSettings, struct {
+		Host  string
+		Port  int
+		Units interface{}
+	}{
+		Host:  "192.168.66.2",
+		Port:  PortFluentd,
+		Units: journalUnits,
+	})
+}
+
+func renderLogging(name string, settings string, data interface{}) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New(name).Parse(settings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestValidateLogFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		fails  bool
+	}{
+		{format: LogFormatJSON},
+		{format: LogFormatText},
+		{format: "", fails: true},
+		{format: "JSON", fails: true},
+		{format: "logfmt", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			err := ValidateLogFormat(tt.format)
+			if tt.fails && err == nil {
+				t.Fatal("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestGetLogAggregatorConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		rotate   time.Duration
+		expected []string
+		absent   []string
+		fails    bool
+	}{
+		{
+			name:   "json every hour",
+			format: LogFormatJSON,
+			rotate: time.Hour,
+			expected: []string{
+				fmt.Sprintf("  port %d\n", PortFluentd),
+				"  <format>\n    @type json\n  </format>\n  <buffer node,namespace,pod,time>\n",
+				"  <format>\n    @type json\n  </format>\n  <buffer node,tag,time>\n",
+				"path /fluentd/log/collected/${node}/pods/${namespace}/${pod}.%Y%m%d-%H%M\n",
+				"path /fluentd/log/collected/${node}/${tag}.%Y%m%d-%H%M\n",
+			},
+			absent: []string{"single_value", "message_key"},
+		},
+		{
+			name:   "text every 90 seconds",
+			format: LogFormatText,
+			rotate: 90 * time.Second,
+			expected: []string{
+				"    @type single_value\n    message_key log\n    add_newline false\n  </format>\n",
+				"    @type single_value\n    message_key MESSAGE\n  </format>\n",
+			},
+			absent: []string{"@type json"},
+		},
+		{name: "rotation below a minute", format: LogFormatJSON, rotate: 59 * time.Second, fails: true},
+		{name: "no rotation", format: LogFormatText, rotate: 0, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := GetLogAggregatorConfig(tt.format, tt.rotate)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got\n%s", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			timekey := fmt.Sprintf("    timekey %d\n", int(tt.rotate.Seconds()))
+			if count := strings.Count(config, timekey); count != 2 {
+				t.Errorf("expected %q in both buffers, got %d in\n%s", timekey, count, config)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(config, expected) {
+					t.Errorf("expected the config to contain %q, got\n%s", expected, config)
+				}
+			}
+			for _, absent := range tt.absent {
+				if strings.Contains(config, absent) {
+					t.Errorf("expected the config not to contain %q, got\n%s", absent, config)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLoggingScript(t *testing.T) {
+	script, err := GetLoggingScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(script, "\nset -e\n") || !strings.HasSuffix(script, "\nEOF\n") {
+		t.Fatalf("expected the script to start with set -e and end with EOF, got\n%s", script)
+	}
+
+	start := "cat <<'EOT' >/tmp/gocli-logging.yaml\n"
+	i := strings.Index(script, start)
+	j := strings.Index(script, "\nEOT\n")
+	if i == -1 || j < i {
+		t.Fatalf("expected the script to write /tmp/gocli-logging.yaml, got\n%s", script)
+	}
+
+	kinds := []string{}
+	fluentConf := ""
+	for _, document := range strings.Split(script[i+len(start):j], "\n---\n") {
+		object := struct {
+			Kind string
+			Data map[string]string
+		}{}
+		if err := yaml.Unmarshal([]byte(document), &object); err != nil {
+			t.Fatalf("unexpected error: %v\n%s", err, document)
+		}
+		kinds = append(kinds, object.Kind)
+		if object.Kind == "ConfigMap" {
+			fluentConf = object.Data["fluent.conf"]
+		}
+	}
+	if joined := strings.Join(kinds, ","); joined != "Namespace,ConfigMap,ServiceAccount,ClusterRole,ClusterRoleBinding,DaemonSet" {
+		t.Errorf("expected the logging objects, got %s", joined)
+	}
+
+	for _, unit := range journalUnits {
+		expected := fmt.Sprintf("  @id in_systemd_%s\n  path \"#{File.directory?('/var/log/journal') ? '/var/log/journal' : '/run/log/journal'}\"\n  matches %s\n", unit.Name, unit.Matches)
+		if !strings.Contains(fluentConf, expected) {
+			t.Errorf("expected the fluentd config to contain %q, got\n%s", expected, fluentConf)
+		}
+		if !strings.Contains(fluentConf, "  tag journal."+unit.Name+"\n") {
+			t.Errorf("expected the fluentd config to tag the journal of %s, got\n%s", unit.Name, fluentConf)
+		}
+	}
+	expected := fmt.Sprintf("    host 192.168.66.2\n    port %d\n", PortFluentd)
+	if !strings.Contains(fluentConf, expected) {
+		t.Errorf("expected the fluentd config to forward to %q, got\n%s", expected, fluentConf)
+	}
+}
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const registryMirrorSettings = `
+set -e
+# jq is not part of the node images, python is since yum needs it
+python=$(command -v python3 || command -v python2 || command -v python || echo /usr/libexec/platform-python)
+
+if [ -d /etc/docker ]; then
+{{- range .Mirrors}}{{if ne .Upstream "docker.io"}}
+    echo "Docker only supports a mirror for docker.io, the images of {{.Upstream}} are pulled directly"
+{{- end}}{{end}}
+{{- if .DockerMirror}}
+    touch /etc/docker/daemon.json
+    $python - /etc/docker/daemon.json '{{.DockerSettings}}' <<'EOT'
+{{.MergeDaemonJSON}}
+EOT
+    systemctl restart docker
+{{- end}}
+fi
+
+if systemctl cat crio >/dev/null 2>&1; then
+    cp -n /etc/containers/registries.conf /etc/containers/registries.conf.orig 2>/dev/null || true
+    touch /etc/containers/registries.conf
+    $python - /etc/containers/registries.conf '{{.CRIOSettings}}' <<'EOT'
+{{.MergeRegistriesConf}}
+EOT
+    systemctl restart crio
+fi
+EOF
+`
+
+// mergeDaemonJSON adds the insecure registries and the mirrors to the docker daemon.json
+// of the path in the first argument, the settings of the node are kept
+const mergeDaemonJSON = `import json, sys
+
+path, settings = sys.argv[1], json.loads(sys.argv[2])
+with open(path) as f:
+    content = f.read().strip()
+config = json.loads(content) if content else {}
+for key in ("insecure-registries", "registry-mirrors"):
+    current = config.get(key, [])
+    config[key] = [r for r in settings[key] if r not in current] + current
+with open(path, "w") as f:
+    json.dump(config, f, indent=2, sort_keys=True)
+    f.write("\n")`
+
+// mergeRegistriesConf adds the insecure registries and the mirrors to the registries.conf of CRI-O
+// of the path in the first argument. The v2 syntax gets a [[registry]] table per mirror in a block which
+// replaces the block of an earlier run. The v1 syntax, which CRI-O before 1.14 reads, has no mirrors:
+// the mirror of docker.io becomes the first search registry, so that unqualified images are pulled through it.
+const mergeRegistriesConf = `import json, re, sys
+
+path, settings = sys.argv[1], json.loads(sys.argv[2])
+begin, end = "# BEGIN gocli registry mirrors", "# END gocli registry mirrors"
+with open(path) as f:
+    content = f.read()
+content = re.sub(r"(?ms)^" + begin + r"$.*?^" + end + r"$\n?", "", content)
+
+
+def set_v1_registries(content, table, registries):
+    header = re.search(r"(?m)^\[" + re.escape(table) + r"\]\s*$", content)
+    if not header:
+        return content.rstrip("\n") + "\n\n[%s]\nregistries = %s\n" % (table, json.dumps(registries))
+    match = re.compile(r"(?ms)^registries\s*=\s*\[(.*?)\]").search(content, header.end())
+    next_table = re.compile(r"(?m)^\[").search(content, header.end())
+    if not match or (next_table and next_table.start() < match.start()):
+        return content[:header.end()] + "\nregistries = %s" % json.dumps(registries) + content[header.end():]
+    current = re.findall(r"[\"']([^\"']*)[\"']", match.group(1))
+    registries = [r for r in registries if r not in current] + current
+    return content[:match.start()] + "registries = %s" % json.dumps(registries) + content[match.end():]
+
+
+if re.search(r"(?m)^\[registries\.", content):
+    content = set_v1_registries(content, "registries.insecure", settings["insecure"])
+    for mirror in settings["mirrors"]:
+        if mirror["upstream"] == "docker.io":
+            content = set_v1_registries(content, "registries.search", [mirror["endpoint"]])
+        else:
+            print("CRI-O with the v1 registries.conf does not support mirrors, the images of %s are pulled directly" % mirror["upstream"])
+else:
+    tables = []
+    for registry in settings["insecure"]:
+        tables.append('[[registry]]\nlocation = "%s"\ninsecure = true' % registry)
+    for mirror in settings["mirrors"]:
+        if re.search(r'(?m)^\s*location\s*=\s*"%s"' % re.escape(mirror["upstream"]), content):
+            print("registries.conf configures %s already, the mirror is not added" % mirror["upstream"])
+            continue
+        tables.append('[[registry]]\nlocation = "%s"\n\n[[registry.mirror]]\nlocation = "%s"\ninsecure = true' % (mirror["upstream"], mirror["endpoint"]))
+    if not re.search(r"(?m)^unqualified-search-registries\s*=", content):
+        content = 'unqualified-search-registries = ["docker.io"]\n' + content
+    content = content.rstrip("\n") + "\n\n" + begin + "\n" + "\n\n".join(tables) + "\n" + end + "\n"
+
+with open(path, "w") as f:
+    f.write(content)`
+
+var nameInvalidChars = regexp.MustCompile("[^a-zA-Z0-9_.-]+")
+
+// RegistryMirror is a pull-through cache of an upstream registry which runs next to the cluster
+type RegistryMirror struct {
+	// Upstream is the registry host the guests pull from, like docker.io
+	Upstream string
+	// RemoteURL is the URL the mirror fetches the images from
+	RemoteURL string
+	// Port is the port of the mirror in the cluster network
+	Port int
+}
+
+// Name returns a name for the mirror which can be used in container and volume names
+func (m RegistryMirror) Name() string {
+	return "mirror-" + strings.Trim(nameInvalidChars.ReplaceAllString(m.Upstream, "-"), "-")
+}
+
+// VolumeName returns the name of the volume which keeps the cache, it does not carry the prefix
+// of the cluster so that all clusters share the cache of an upstream
+func (m RegistryMirror) VolumeName() string {
+	return "kubevirtci-" + m.Name()
+}
+
+// Endpoint returns the address of the mirror in the cluster network
+func (m RegistryMirror) Endpoint() string {
+	return fmt.Sprintf("registry:%d", m.Port)
+}
+
+// Env returns the environment of the registry container which runs the mirror
+func (m RegistryMirror) Env() []string {
+	return []string{
+		fmt.Sprintf("REGISTRY_HTTP_ADDR=:%d", m.Port),
+		"REGISTRY_PROXY_REMOTEURL=" + m.RemoteURL,
+		"REGISTRY_STORAGE_MAINTENANCE_UPLOADPURGING_ENABLED=false",
+	}
+}
+
+// ParseRegistryMirrors parses the value of the --registry-mirror flag, in the format
+// upstream=docker.io,quay.io. An entry can point the mirror to a different URL,
+// for instance to a local stand-in of the upstream: upstream=docker.io=http://10.0.0.1:5000
+func ParseRegistryMirrors(value string) ([]RegistryMirror, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(value, "upstream=") {
+		return nil, fmt.Errorf("invalid registry mirror %q, expected upstream=<registry>[,<registry>...]", value)
+	}
+
+	mirrors := []RegistryMirror{}
+	seen := map[string]bool{}
+	for i, entry := range strings.Split(strings.TrimPrefix(value, "upstream="), ",") {
+		parts := strings.SplitN(entry, "=", 2)
+		upstream := strings.TrimSpace(parts[0])
+		if upstream == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q, the upstream registry is empty", value)
+		}
+		if strings.ContainsAny(upstream, "'\" /") {
+			return nil, fmt.Errorf("invalid registry mirror %q, the upstream %s is no registry host", value, upstream)
+		}
+		if seen[upstream] {
+			return nil, fmt.Errorf("invalid registry mirror %q, the upstream %s is listed twice", value, upstream)
+		}
+		seen[upstream] = true
+
+		remoteURL := "https://" + upstream
+		if upstream == "docker.io" {
+			remoteURL = "https://registry-1.docker.io"
+		}
+		if len(parts) == 2 {
+			remoteURL = strings.TrimSpace(parts[1])
+		}
+
+		mirrors = append(mirrors, RegistryMirror{
+			Upstream:  upstream,
+			RemoteURL: remoteURL,
+			Port:      PortRegistryMirror + i,
+		})
+	}
+	return mirrors, nil
+}
+
+// GetRegistryMirrorScript returns a script which adds the mirrors to the settings of the container runtime of a node.
+// Docker only supports a mirror for docker.io, CRI-O gets a mirror for every upstream.
+func GetRegistryMirrorScript(mirrors []RegistryMirror) (string, error) {
+	insecure := []string{fmt.Sprintf("registry:%d", PortRegistry)}
+	dockerMirrors := []string{}
+	crioMirrors := []map[string]string{}
+	var dockerMirror *RegistryMirror
+	for i, mirror := range mirrors {
+		insecure = append(insecure, mirror.Endpoint())
+		crioMirrors = append(crioMirrors, map[string]string{"upstream": mirror.Upstream, "endpoint": mirror.Endpoint()})
+		if mirror.Upstream == "docker.io" {
+			dockerMirror = &mirrors[i]
+			dockerMirrors = append(dockerMirrors, "http://"+mirror.Endpoint())
+		}
+	}
+
+	dockerSettings, err := json.Marshal(map[string][]string{"insecure-registries": insecure, "registry-mirrors": dockerMirrors})
+	if err != nil {
+		return "", err
+	}
+	crioSettings, err := json.Marshal(map[string]interface{}{"insecure": insecure, "mirrors": crioMirrors})
+	if err != nil {
+		return "", err
+	}
+
+	settings := struct {
+		Mirrors             []RegistryMirror
+		DockerMirror        *RegistryMirror
+		DockerSettings      string
+		CRIOSettings        string
+		MergeDaemonJSON     string
+		MergeRegistriesConf string
+	}{
+		Mirrors:             mirrors,
+		DockerMirror:        dockerMirror,
+		DockerSettings:      string(dockerSettings),
+		CRIOSettings:        string(crioSettings),
+		MergeDaemonJSON:     mergeDaemonJSON,
+		MergeRegistriesConf: mergeRegistriesConf,
+	}
+
+	buf := new(bytes.Buffer)
+	t, err := template.New("registry-mirror").Parse(registryMirrorSettings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, settings); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
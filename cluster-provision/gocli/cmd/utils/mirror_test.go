@@ -0,0 +1,400 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+func TestParseRegistryMirrors(t *testing.T) {
+	tests := []struct {
+		value   string
+		mirrors []RegistryMirror
+		fails   bool
+	}{
+		{value: "", mirrors: nil},
+		{
+			value: "upstream=docker.io,quay.io",
+			mirrors: []RegistryMirror{
+				{Upstream: "docker.io", RemoteURL: "https://registry-1.docker.io", Port: PortRegistryMirror},
+				{Upstream: "quay.io", RemoteURL: "https://quay.io", Port: PortRegistryMirror + 1},
+			},
+		},
+		{
+			value: "upstream=docker.io=http://10.0.0.1:5000",
+			mirrors: []RegistryMirror{
+				{Upstream: "docker.io", RemoteURL: "http://10.0.0.1:5000", Port: PortRegistryMirror},
+			},
+		},
+		{
+			value: "upstream= gcr.io ,k8s.gcr.io= http://127.0.0.1:5000 ",
+			mirrors: []RegistryMirror{
+				{Upstream: "gcr.io", RemoteURL: "https://gcr.io", Port: PortRegistryMirror},
+				{Upstream: "k8s.gcr.io", RemoteURL: "http://127.0.0.1:5000", Port: PortRegistryMirror + 1},
+			},
+		},
+		{value: "docker.io", fails: true},
+		{value: "upstream=", fails: true},
+		{value: "upstream=docker.io,,quay.io", fails: true},
+		{value: "upstream=docker.io,docker.io", fails: true},
+		{value: "upstream=docker.io/library", fails: true},
+		{value: "upstream=quay'.io", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			mirrors, err := ParseRegistryMirrors(tt.value)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", mirrors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(mirrors, tt.mirrors) {
+				t.Errorf("expected %+v, got %+v", tt.mirrors, mirrors)
+			}
+		})
+	}
+}
+
+func TestRegistryMirrorNames(t *testing.T) {
+	mirror := RegistryMirror{Upstream: "k8s.gcr.io:443", Port: PortRegistryMirror}
+	if name := mirror.Name(); name != "mirror-k8s.gcr.io-443" {
+		t.Errorf("expected the name mirror-k8s.gcr.io-443, got %s", name)
+	}
+	if name := mirror.VolumeName(); name != "kubevirtci-mirror-k8s.gcr.io-443" {
+		t.Errorf("expected the volume kubevirtci-mirror-k8s.gcr.io-443, got %s", name)
+	}
+}
+
+// runMergeScript runs one of the python programs of the registry mirror script on the content of a settings file
+func runMergeScript(t *testing.T, script string, content string, settings string) string {
+	python := ""
+	for _, name := range []string{"python3", "python2", "python"} {
+		if path, err := exec.LookPath(name); err == nil {
+			python = path
+			break
+		}
+	}
+	if python == "" {
+		t.Skip("python is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "gocli-mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "settings")
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(python, "-", file, settings)
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("the script failed: %v\n%s", err, out)
+	}
+	merged, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(merged)
+}
+
+func TestMergeDaemonJSON(t *testing.T) {
+	settings := `{"insecure-registries": ["registry:5000", "registry:5001"], "registry-mirrors": ["http://registry:5001"]}`
+
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]interface{}
+	}{
+		{
+			name:    "empty file",
+			content: "",
+			expected: map[string]interface{}{
+				"insecure-registries": []interface{}{"registry:5000", "registry:5001"},
+				"registry-mirrors":    []interface{}{"http://registry:5001"},
+			},
+		},
+		{
+			name:    "settings of the node",
+			content: `{"insecure-registries": ["registry:5000"], "log-driver": "journald", "registry-mirrors": ["https://mirror.example.com"]}`,
+			expected: map[string]interface{}{
+				"insecure-registries": []interface{}{"registry:5001", "registry:5000"},
+				"log-driver":          "journald",
+				"registry-mirrors":    []interface{}{"http://registry:5001", "https://mirror.example.com"},
+			},
+		},
+		{
+			name:    "merged before",
+			content: `{"insecure-registries": ["registry:5000", "registry:5001"], "registry-mirrors": ["http://registry:5001"]}`,
+			expected: map[string]interface{}{
+				"insecure-registries": []interface{}{"registry:5000", "registry:5001"},
+				"registry-mirrors":    []interface{}{"http://registry:5001"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := map[string]interface{}{}
+			if err := json.Unmarshal([]byte(runMergeScript(t, mergeDaemonJSON, tt.content, settings)), &merged); err != nil {
+				t.Fatalf("daemon.json is no valid JSON: %v", err)
+			}
+			if !reflect.DeepEqual(merged, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, merged)
+			}
+		})
+	}
+}
+
+func TestMergeRegistriesConf(t *testing.T) {
+	settings := `{"insecure": ["registry:5000", "registry:5001", "registry:5002"], "mirrors": [{"upstream": "docker.io", "endpoint": "registry:5001"}, {"upstream": "quay.io", "endpoint": "registry:5002"}]}`
+	v2Block := `# BEGIN gocli registry mirrors
+[[registry]]
+location = "registry:5000"
+insecure = true
+
+[[registry]]
+location = "registry:5001"
+insecure = true
+
+[[registry]]
+location = "registry:5002"
+insecure = true
+
+[[registry]]
+location = "docker.io"
+
+[[registry.mirror]]
+location = "registry:5001"
+insecure = true
+
+[[registry]]
+location = "quay.io"
+
+[[registry.mirror]]
+location = "registry:5002"
+insecure = true
+# END gocli registry mirrors
+`
+
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{
+			name:     "empty file",
+			content:  "",
+			expected: "unqualified-search-registries = [\"docker.io\"]\n\n" + v2Block,
+		},
+		{
+			name:     "v2 settings of the node",
+			content:  "unqualified-search-registries = [\"registry.fedoraproject.org\", \"docker.io\"]\n\n[[registry]]\nlocation = \"example.com\"\nblocked = true\n",
+			expected: "unqualified-search-registries = [\"registry.fedoraproject.org\", \"docker.io\"]\n\n[[registry]]\nlocation = \"example.com\"\nblocked = true\n\n" + v2Block,
+		},
+		{
+			name:     "v2 merged before",
+			content:  "unqualified-search-registries = [\"docker.io\"]\n\n" + v2Block,
+			expected: "unqualified-search-registries = [\"docker.io\"]\n\n" + v2Block,
+		},
+		{
+			name:    "v2 with a table of the upstream",
+			content: "[[registry]]\nlocation = \"quay.io\"\ninsecure = false\n",
+			expected: "unqualified-search-registries = [\"docker.io\"]\n[[registry]]\nlocation = \"quay.io\"\ninsecure = false\n\n" +
+				strings.Replace(v2Block, "\n[[registry]]\nlocation = \"quay.io\"\n\n[[registry.mirror]]\nlocation = \"registry:5002\"\ninsecure = true\n", "", 1),
+		},
+		{
+			name:     "v1 settings of the node",
+			content:  "[registries.search]\nregistries = ['docker.io', 'registry.access.redhat.com']\n\n[registries.insecure]\nregistries = []\n\n[registries.block]\nregistries = []\n",
+			expected: "[registries.search]\nregistries = [\"registry:5001\", \"docker.io\", \"registry.access.redhat.com\"]\n\n[registries.insecure]\nregistries = [\"registry:5000\", \"registry:5001\", \"registry:5002\"]\n\n[registries.block]\nregistries = []\n",
+		},
+		{
+			name:     "v1 without insecure registries",
+			content:  "[registries.search]\nregistries = [\n  'docker.io',\n]\n",
+			expected: "[registries.search]\nregistries = [\"registry:5001\", \"docker.io\"]\n\n[registries.insecure]\nregistries = [\"registry:5000\", \"registry:5001\", \"registry:5002\"]\n",
+		},
+		{
+			name:     "v1 merged before",
+			content:  "[registries.search]\nregistries = [\"registry:5001\", \"docker.io\"]\n\n[registries.insecure]\nregistries = [\"registry:5000\", \"registry:5001\", \"registry:5002\"]\n",
+			expected: "[registries.search]\nregistries = [\"registry:5001\", \"docker.io\"]\n\n[registries.insecure]\nregistries = [\"registry:5000\", \"registry:5001\", \"registry:5002\"]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged := runMergeScript(t, mergeRegistriesConf, tt.content, settings)
+			if merged != tt.expected {
+				t.Errorf("expected\n%s\ngot\n%s", tt.expected, merged)
+			}
+		})
+	}
+}
+
+func TestGetRegistryMirrorScript(t *testing.T) {
+	mirrors, err := ParseRegistryMirrors("upstream=docker.io,quay.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err := GetRegistryMirrorScript(mirrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// provisionScript writes the script with a heredoc which ends at the only EOF line
+	if !strings.HasSuffix(script, "\nEOF\n") || strings.Count(script, "\nEOF\n") != 1 {
+		t.Errorf("expected the script to end with the only EOF line, got\n%s", script)
+	}
+	for _, expected := range []string{
+		`'{"insecure-registries":["registry:5000","registry:5001","registry:5002"],"registry-mirrors":["http://registry:5001"]}'`,
+		"the images of quay.io are pulled directly",
+		`{"endpoint":"registry:5002","upstream":"quay.io"}`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+		}
+	}
+
+	mirrors, err = ParseRegistryMirrors("upstream=quay.io")
+	if err != nil {
+		t.Fatal(err)
+	}
+	script, err = GetRegistryMirrorScript(mirrors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(script, "/etc/docker/daemon.json") {
+		t.Errorf("expected no docker settings without a mirror of docker.io, got\n%s", script)
+	}
+}
+
+// standInRegistry serves one image like an upstream registry, it is enough for the pull of the manifest through a mirror
+func standInRegistry(t *testing.T) (*httptest.Server, string) {
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	configDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(config))
+	manifest := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.docker.distribution.manifest.v2+json","config":{"mediaType":"application/vnd.docker.container.image.v1+json","size":%d,"digest":"%s"},"layers":[]}`, len(config), configDigest))
+	manifestDigest := fmt.Sprintf("sha256:%x", sha256.Sum256(manifest))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v2/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Docker-Distribution-API-Version", "registry/2.0")
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/kubevirt/stand-in/manifests/latest", "/v2/kubevirt/stand-in/manifests/" + manifestDigest:
+			w.Header().Set("Content-Type", "application/vnd.docker.distribution.manifest.v2+json")
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(manifest)))
+			if r.Method != http.MethodHead {
+				w.Write(manifest)
+			}
+		case "/v2/kubevirt/stand-in/blobs/" + configDigest:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Docker-Content-Digest", configDigest)
+			w.Header().Set("Content-Length", fmt.Sprintf("%d", len(config)))
+			if r.Method != http.MethodHead {
+				w.Write(config)
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return httptest.NewServer(mux), manifestDigest
+}
+
+// TestRegistryMirrorStandIn runs a mirror in front of a local stand-in of the upstream and pulls a manifest through it.
+// It needs a local docker daemon with the registry image.
+func TestRegistryMirrorStandIn(t *testing.T) {
+	cli, err := docker.NewClient()
+	if err != nil {
+		t.Skipf("no docker client: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := cli.ServerVersion(ctx); err != nil {
+		t.Skipf("the docker daemon is not reachable: %v", err)
+	}
+	if _, _, err := cli.ImageInspectWithRaw(ctx, DockerRegistryImage); err != nil {
+		t.Skipf("the image %s is not available: %v", DockerRegistryImage, err)
+	}
+
+	upstream, manifestDigest := standInRegistry(t)
+	defer upstream.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	mirrors, err := ParseRegistryMirrors("upstream=docker.io=" + upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirror := mirrors[0]
+	mirror.Port = port
+
+	// The mirror shares the network of the host to reach the stand-in on the loopback device
+	created, err := cli.ContainerCreate(ctx, &container.Config{
+		Image: DockerRegistryImage,
+		Env:   mirror.Env(),
+	}, &container.HostConfig{
+		NetworkMode: "host",
+	}, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+	if err := cli.ContainerStart(ctx, created.ID, types.ContainerStartOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/v2/kubevirt/stand-in/manifests/latest", port), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Accept", "application/vnd.docker.distribution.manifest.v2+json")
+
+	var response *http.Response
+	for i := 0; i < 30; i++ {
+		response, err = http.DefaultClient.Do(request)
+		if err == nil {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		t.Fatalf("the mirror did not answer: %v", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		t.Fatalf("expected the manifest of the stand-in, got %s: %s", response.Status, body)
+	}
+	if digest := response.Header.Get("Docker-Content-Digest"); digest != manifestDigest {
+		t.Errorf("expected the manifest %s, got %s", manifestDigest, digest)
+	}
+}
@@ -15,6 +15,8 @@ const (
 	PortSSHWorker = 2202
 	// PortRegistry contains private image registry port
 	PortRegistry = 5000
+	// PortRegistryMirror contains the port of the first pull-through registry mirror, further mirrors use the following ports
+	PortRegistryMirror = 5001
 	// PortOCP contains OCP API server port
 	PortOCP = 8443
 	// PortAPI contains API server port
@@ -23,6 +25,10 @@ const (
 	PortVNC = 5901
 	//PortOCPConsole contains OCP console port
 	PortOCPConsole = 443
+	// PortQEMUMonitor contains the base port of the QEMU monitors, node NN listens on PortQEMUMonitor+NN
+	PortQEMUMonitor = 4500
+	// PortFluentd contains the port on which the fluentd sidecar receives the logs of the nodes
+	PortFluentd = 24224
 
 	// PortNameSSH contains master node SSH port name
 	PortNameSSH = "ssh"
@@ -41,6 +47,27 @@ const (
 	PortNameOCPConsole = "console"
 )
 
+// PortByName returns the container port of the port name
+func PortByName(name string) (uint16, error) {
+	switch name {
+	case PortNameSSH:
+		return PortSSH, nil
+	case PortNameSSHWorker:
+		return PortSSHWorker, nil
+	case PortNameAPI:
+		return PortAPI, nil
+	case PortNameRegistry:
+		return PortRegistry, nil
+	case PortNameOCP:
+		return PortOCP, nil
+	case PortNameOCPConsole:
+		return PortOCPConsole, nil
+	case PortNameVNC:
+		return PortVNC, nil
+	}
+	return 0, fmt.Errorf("unknown port name %s", name)
+}
+
 // GetPublicPort returns public port by private port
 func GetPublicPort(port uint16, ports []types.Port) (uint16, error) {
 	for _, p := range ports {
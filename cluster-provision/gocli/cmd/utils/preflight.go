@@ -0,0 +1,397 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"golang.org/x/sys/unix"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+const (
+	// CheckOK marks a satisfied host prerequisite
+	CheckOK = "ok"
+	// CheckWarning marks a host prerequisite which could not be verified or which may cause trouble later
+	CheckWarning = "warning"
+	// CheckFailed marks a host prerequisite which prevents the cluster from starting
+	CheckFailed = "failed"
+)
+
+// Check is the result of a host prerequisite check, failed checks come with a remedy
+type Check struct {
+	Name    string
+	Status  string
+	Message string
+	Remedy  string
+}
+
+// PreflightOptions describes what the cluster requires from the host
+type PreflightOptions struct {
+	// Nodes is the number of nodes, the memory is not checked without nodes
+	Nodes uint
+	// Memory is the amount of ram per node, like 3096M
+	Memory string
+	// RegistryVolume is the volume which caches the registry content
+	RegistryVolume string
+	// Ports are the explicit localhost ports
+	Ports nat.PortMap
+}
+
+// Preflight checks the host prerequisites of a cluster before any container is created.
+// The KVM, SELinux and port checks look at the local host, they are skipped if the
+// docker daemon runs on another host. The memory and SELinux checks ask the daemon,
+// they are skipped if the daemon can not be used.
+func Preflight(ctx context.Context, cli *client.Client, opts PreflightOptions) []Check {
+	daemon := checkDockerAPI(ctx, cli)
+	checks := []Check{daemon}
+	usable := daemon.Status != CheckFailed
+
+	if host := os.Getenv("DOCKER_HOST"); host != "" && !strings.HasPrefix(host, "unix://") {
+		checks = append(checks, Check{
+			Name:    "host",
+			Status:  CheckWarning,
+			Message: fmt.Sprintf("the docker daemon runs on %s, KVM, SELinux and the ports are not checked", host),
+			Remedy:  "run gocli doctor on the docker host",
+		})
+		if usable {
+			checks = append(checks, checkMemory(ctx, cli, opts.Nodes, opts.Memory, false))
+		}
+		return checks
+	}
+
+	checks = append(checks, checkKVM(), checkNestedVirtualization(sysModuleDir))
+	if usable {
+		checks = append(checks, checkMemory(ctx, cli, opts.Nodes, opts.Memory, true))
+		if opts.RegistryVolume != "" {
+			checks = append(checks, checkSELinux(ctx, cli, opts.RegistryVolume))
+		}
+	}
+	checks = append(checks, checkPorts(ctx, cli, opts.Ports)...)
+	return checks
+}
+
+// PrintChecks writes the checks with their remedies, only the failed and warning ones unless all is set
+func PrintChecks(out io.Writer, checks []Check, all bool) {
+	for _, c := range checks {
+		if c.Status == CheckOK && !all {
+			continue
+		}
+		fmt.Fprintf(out, "[%s] %s: %s\n", c.Status, c.Name, c.Message)
+		if c.Status != CheckOK && c.Remedy != "" {
+			fmt.Fprintf(out, "    remedy: %s\n", c.Remedy)
+		}
+	}
+}
+
+// CheckError returns an error if one of the checks failed
+func CheckError(checks []Check) error {
+	failed := 0
+	for _, c := range checks {
+		if c.Status == CheckFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d host prerequisites are not met", failed, len(checks))
+	}
+	return nil
+}
+
+func checkDockerAPI(ctx context.Context, cli *client.Client) Check {
+	check := Check{Name: "docker"}
+	pinned := os.Getenv("DOCKER_API_VERSION") != ""
+	version, err := cli.ServerVersion(ctx)
+	if err != nil {
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("the docker daemon is not reachable: %v", err)
+		check.Remedy = "start the docker daemon, make sure the user may access /var/run/docker.sock or point DOCKER_HOST to the daemon"
+		if pinned {
+			check.Remedy = "unset DOCKER_API_VERSION to negotiate the API version with the daemon, or " + check.Remedy
+		}
+		return check
+	}
+
+	api := cli.ClientVersion()
+	switch {
+	case !docker.SupportsAPI(cli, docker.APIVersionMounts):
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("gocli speaks the API %s with the docker daemon %s, it needs %s to mount the volumes of the nodes", api, version.Version, docker.APIVersionMounts)
+		check.Remedy = "upgrade docker to 1.13 or newer"
+		if pinned {
+			check.Remedy = "unset DOCKER_API_VERSION or " + check.Remedy
+		}
+	case versions.LessThan(docker.MaxAPIVersion, version.MinAPIVersion):
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("the docker daemon %s requires the API %s or newer, gocli only supports up to %s", version.Version, version.MinAPIVersion, docker.MaxAPIVersion)
+		check.Remedy = "upgrade gocli or use an older docker daemon"
+	case versions.GreaterThan(api, docker.MaxAPIVersion):
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("the docker daemon %s supports the API %s to %s, gocli speaks %s but only knows the fields up to %s", version.Version, version.MinAPIVersion, version.APIVersion, api, docker.MaxAPIVersion)
+		check.Remedy = fmt.Sprintf("use a docker daemon which supports the API %s if requests fail", docker.MaxAPIVersion)
+	default:
+		check.Status = CheckOK
+		check.Message = fmt.Sprintf("docker %s, API %s", version.Version, api)
+	}
+	return check
+}
+
+func checkKVM() Check {
+	check := Check{Name: "kvm"}
+	info, err := os.Stat("/dev/kvm")
+	switch {
+	case os.IsNotExist(err):
+		check.Status = CheckFailed
+		check.Message = "/dev/kvm does not exist, the nodes can not be virtualized"
+		check.Remedy = "enable VT-x or AMD-V in the firmware and load the kvm module: modprobe kvm_intel or modprobe kvm_amd"
+	case err != nil:
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("/dev/kvm is not accessible: %v", err)
+		check.Remedy = "run gocli with access to /dev/kvm, like in a privileged container"
+	case info.Mode()&os.ModeCharDevice == 0:
+		check.Status = CheckFailed
+		check.Message = "/dev/kvm is not a character device"
+		check.Remedy = "remove /dev/kvm and reload the kvm module"
+	default:
+		check.Status = CheckOK
+		check.Message = "/dev/kvm is available"
+	}
+	return check
+}
+
+// sysModuleDir contains the parameters of the loaded kernel modules
+const sysModuleDir = "/sys/module"
+
+// checkNestedVirtualization only warns if nested virtualization is disabled, since the nodes start
+// without it and only the virtual machines in the cluster fall back to software emulation
+func checkNestedVirtualization(moduleDir string) Check {
+	check := Check{Name: "nested virtualization"}
+	for _, module := range []string{"kvm_intel", "kvm_amd"} {
+		data, err := ioutil.ReadFile(filepath.Join(moduleDir, module, "parameters", "nested"))
+		if err != nil {
+			continue
+		}
+		switch strings.TrimSpace(string(data)) {
+		case "Y", "1":
+			check.Status = CheckOK
+			check.Message = fmt.Sprintf("%s allows nested virtualization", module)
+		default:
+			check.Status = CheckWarning
+			check.Message = fmt.Sprintf("%s does not allow nested virtualization, the virtual machines in the cluster can only use software emulation", module)
+			check.Remedy = fmt.Sprintf("echo 'options %s nested=1' >/etc/modprobe.d/kvm-nested.conf and reload the module: modprobe -r %s && modprobe %s", module, module, module)
+		}
+		return check
+	}
+	check.Status = CheckWarning
+	check.Message = "neither kvm_intel nor kvm_amd is loaded, nested virtualization is unknown"
+	check.Remedy = "load the kvm module of the cpu: modprobe kvm_intel or modprobe kvm_amd"
+	return check
+}
+
+func checkMemory(ctx context.Context, cli *client.Client, nodes uint, memory string, local bool) Check {
+	check := Check{Name: "memory"}
+	if nodes == 0 || memory == "" {
+		check.Status = CheckOK
+		check.Message = "no nodes requested"
+		return check
+	}
+	perNode, err := units.RAMInBytes(memory)
+	if err != nil {
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("invalid memory %s: %v", memory, err)
+		check.Remedy = "pass the memory per node like 3096M or 4G"
+		return check
+	}
+	required := perNode * int64(nodes)
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("the memory of the docker host is unknown: %v", err)
+		return check
+	}
+	if required > info.MemTotal {
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("%d nodes with %s need %s, the docker host has %s", nodes, memory, units.BytesSize(float64(required)), units.BytesSize(float64(info.MemTotal)))
+		check.Remedy = "start fewer nodes with --nodes or give them less memory with --memory"
+		return check
+	}
+
+	if local {
+		if available, err := memAvailable(); err == nil && required > available {
+			check.Status = CheckWarning
+			check.Message = fmt.Sprintf("%d nodes with %s need %s, only %s are available", nodes, memory, units.BytesSize(float64(required)), units.BytesSize(float64(available)))
+			check.Remedy = "stop other clusters or virtual machines, or the nodes may be killed when they run out of memory"
+			return check
+		}
+	}
+	check.Status = CheckOK
+	check.Message = fmt.Sprintf("%d nodes with %s fit into %s", nodes, memory, units.BytesSize(float64(info.MemTotal)))
+	return check
+}
+
+// memAvailable returns MemAvailable of /proc/meminfo in bytes
+func memAvailable() (int64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" && fields[2] == "kB" {
+			kb, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, err
+			}
+			return kb * 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("/proc/meminfo has no MemAvailable")
+}
+
+// checkSELinux checks that the registry volume is accessible from confined containers, docker labels the
+// volumes which it creates itself, but not the host directories which a volume is bound to
+func checkSELinux(ctx context.Context, cli *client.Client, name string) Check {
+	check := Check{Name: "selinux", Status: CheckOK}
+	enforce, err := ioutil.ReadFile("/sys/fs/selinux/enforce")
+	if err != nil || strings.TrimSpace(string(enforce)) != "1" {
+		check.Message = "SELinux is not enforcing"
+		return check
+	}
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("the security options of the docker daemon are unknown: %v", err)
+		return check
+	}
+	confined := false
+	for _, opt := range info.SecurityOptions {
+		if opt == "selinux" || strings.Contains(opt, "name=selinux") {
+			confined = true
+		}
+	}
+	if !confined {
+		check.Message = "the docker daemon does not confine containers with SELinux"
+		return check
+	}
+
+	vol, err := cli.VolumeInspect(ctx, name)
+	if client.IsErrVolumeNotFound(err) {
+		check.Message = fmt.Sprintf("the registry volume %s will be created and labelled by docker", name)
+		return check
+	}
+	if err != nil {
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("the registry volume %s can not be inspected: %v", name, err)
+		return check
+	}
+	device := boundDirectory(vol)
+	if device == "" {
+		check.Message = fmt.Sprintf("the registry volume %s is managed by docker", name)
+		return check
+	}
+
+	label, err := selinuxLabel(device)
+	if err != nil {
+		check.Status = CheckWarning
+		check.Message = fmt.Sprintf("the SELinux label of %s, which the registry volume %s is bound to, is unknown: %v", device, name, err)
+		check.Remedy = fmt.Sprintf("make sure %s is labelled container_file_t", device)
+		return check
+	}
+	if !strings.Contains(label, ":container_file_t:") && !strings.Contains(label, ":svirt_sandbox_file_t:") {
+		check.Status = CheckFailed
+		check.Message = fmt.Sprintf("%s, which the registry volume %s is bound to, is labelled %s, SELinux blocks the registry from using it", device, name, label)
+		check.Remedy = fmt.Sprintf("chcon -R -t container_file_t %s", device)
+		return check
+	}
+	check.Message = fmt.Sprintf("%s, which the registry volume %s is bound to, is labelled %s", device, name, label)
+	return check
+}
+
+// boundDirectory returns the host directory of a local volume created with -o bind, or an empty string
+func boundDirectory(vol types.Volume) string {
+	if vol.Driver != "local" || !strings.Contains(vol.Options["o"], "bind") {
+		return ""
+	}
+	return vol.Options["device"]
+}
+
+func selinuxLabel(path string) (string, error) {
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(path, "security.selinux", buf)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(buf[:n]), "\x00"), nil
+}
+
+// checkPorts checks that the explicit localhost ports are free and names the containers which publish them
+func checkPorts(ctx context.Context, cli *client.Client, ports nat.PortMap) []Check {
+	checks := []Check{}
+	sorted := []string{}
+	for port := range ports {
+		sorted = append(sorted, string(port))
+	}
+	sort.Strings(sorted)
+	for _, name := range sorted {
+		port := nat.Port(name)
+		for _, binding := range ports[port] {
+			check := Check{Name: fmt.Sprintf("port %s", binding.HostPort)}
+			listener, err := net.Listen("tcp", net.JoinHostPort(binding.HostIP, binding.HostPort))
+			if err == nil {
+				listener.Close()
+				check.Status = CheckOK
+				check.Message = fmt.Sprintf("%s:%s is free for %s", binding.HostIP, binding.HostPort, port)
+				checks = append(checks, check)
+				continue
+			}
+
+			check.Status = CheckFailed
+			check.Message = fmt.Sprintf("%s:%s for %s is taken: %v", binding.HostIP, binding.HostPort, port, err)
+			check.Remedy = "stop the process which listens on the port, pass another port or drop the port flag to publish the port on a random one"
+			if owner := publishingContainer(ctx, cli, binding.HostPort); owner != "" {
+				check.Message = fmt.Sprintf("%s:%s for %s is published by the container %s", binding.HostIP, binding.HostPort, port, owner)
+				check.Remedy = fmt.Sprintf("remove the container %s, like with gocli --prefix <prefix> rm, or pass another port", owner)
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// publishingContainer returns the name of the running container which publishes the host port
+func publishingContainer(ctx context.Context, cli *client.Client, hostPort string) string {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return ""
+	}
+	for _, c := range containers {
+		for _, p := range c.Ports {
+			if strconv.Itoa(int(p.PublicPort)) == hostPort && len(c.Names) > 0 {
+				return strings.TrimPrefix(c.Names[0], "/")
+			}
+		}
+	}
+	return ""
+}
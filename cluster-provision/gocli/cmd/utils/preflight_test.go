@@ -0,0 +1,129 @@
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestCheckNestedVirtualization(t *testing.T) {
+	tests := []struct {
+		name   string
+		module string
+		nested string
+		status string
+	}{
+		{name: "intel nested", module: "kvm_intel", nested: "Y\n", status: CheckOK},
+		{name: "amd nested", module: "kvm_amd", nested: "1\n", status: CheckOK},
+		{name: "intel not nested", module: "kvm_intel", nested: "N\n", status: CheckWarning},
+		{name: "amd not nested", module: "kvm_amd", nested: "0\n", status: CheckWarning},
+		{name: "no kvm module", status: CheckWarning},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gocli-modules")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if tt.module != "" {
+				parameters := filepath.Join(dir, tt.module, "parameters")
+				if err := os.MkdirAll(parameters, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := ioutil.WriteFile(filepath.Join(parameters, "nested"), []byte(tt.nested), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			check := checkNestedVirtualization(dir)
+			if check.Status != tt.status {
+				t.Errorf("expected %s, got %s: %s", tt.status, check.Status, check.Message)
+			}
+			if check.Status != CheckOK && check.Remedy == "" {
+				t.Errorf("expected a remedy, got none: %s", check.Message)
+			}
+		})
+	}
+}
+
+func TestCheckError(t *testing.T) {
+	tests := []struct {
+		name   string
+		checks []Check
+		fails  bool
+	}{
+		{name: "no checks", checks: nil},
+		{name: "warnings", checks: []Check{{Status: CheckOK}, {Status: CheckWarning}}},
+		{name: "failed check", checks: []Check{{Status: CheckWarning}, {Status: CheckFailed}}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckError(tt.checks)
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestPrintChecks(t *testing.T) {
+	checks := []Check{
+		{Name: "kvm", Status: CheckOK, Message: "/dev/kvm is available"},
+		{Name: "nested virtualization", Status: CheckWarning, Message: "kvm_intel does not allow nested virtualization", Remedy: "modprobe kvm_intel nested=1"},
+	}
+
+	tests := []struct {
+		all      bool
+		expected string
+	}{
+		{all: false, expected: "[warning] nested virtualization: kvm_intel does not allow nested virtualization\n    remedy: modprobe kvm_intel nested=1\n"},
+		{all: true, expected: "[ok] kvm: /dev/kvm is available\n[warning] nested virtualization: kvm_intel does not allow nested virtualization\n    remedy: modprobe kvm_intel nested=1\n"},
+	}
+
+	for _, tt := range tests {
+		out := new(bytes.Buffer)
+		PrintChecks(out, checks, tt.all)
+		if out.String() != tt.expected {
+			t.Errorf("expected\n%s\ngot\n%s", tt.expected, out)
+		}
+	}
+}
+
+func TestBoundDirectory(t *testing.T) {
+	tests := []struct {
+		name     string
+		volume   types.Volume
+		expected string
+	}{
+		{name: "managed by docker", volume: types.Volume{Driver: "local"}, expected: ""},
+		{
+			name:     "bound to a directory",
+			volume:   types.Volume{Driver: "local", Options: map[string]string{"type": "none", "o": "bind", "device": "/srv/registry"}},
+			expected: "/srv/registry",
+		},
+		{
+			name:     "other driver",
+			volume:   types.Volume{Driver: "nfs", Options: map[string]string{"o": "bind", "device": "/srv/registry"}},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if device := boundDirectory(tt.volume); device != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, device)
+			}
+		})
+	}
+}
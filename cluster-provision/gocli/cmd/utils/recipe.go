@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// LabelRecipeName contains the name of the recipe the image was built from
+	LabelRecipeName = "io.kubevirtci.recipe.name"
+	// LabelRecipeDigest contains the sha256 of the recipe file the image was built from
+	LabelRecipeDigest = "io.kubevirtci.recipe.sha256"
+	// LabelBaseImage contains the base image the image was built from, referenced by its digest
+	LabelBaseImage = "io.kubevirtci.base"
+	// LabelKubernetesVersion contains the Kubernetes version which is installed in the image
+	LabelKubernetesVersion = "io.kubevirtci.kubernetes.version"
+)
+
+// RecipeManifestsDir is the directory on the node to which the manifests of a recipe are copied,
+// they are prefixed with their position, so that the scripts of the image can apply them in order
+const RecipeManifestsDir = "/manifests"
+
+var (
+	packagePattern = regexp.MustCompile(`^[a-zA-Z0-9][-a-zA-Z0-9_.+:*]*$`)
+	argPattern     = regexp.MustCompile(`^[-a-zA-Z0-9_.=:/]+$`)
+	versionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+(-[-a-zA-Z0-9.]+)?$`)
+	labelPattern   = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+	guestPattern   = regexp.MustCompile(`^/[-a-zA-Z0-9_./]*[^/]$`)
+	memoryPattern  = regexp.MustCompile(`^[0-9]+[KMGkmg]?$`)
+)
+
+// RecipeFile is a file or directory of the host which is copied to the destination path on the node
+type RecipeFile struct {
+	Source      string `yaml:"source"`
+	Destination string `yaml:"destination"`
+}
+
+// Recipe declares how a provider image is built from a base image
+type Recipe struct {
+	// Name describes the recipe, it is recorded as label of the image
+	Name string `yaml:"name"`
+	// Base is the image which is provisioned, it should be referenced by its digest
+	Base string `yaml:"base"`
+	// Tag is the reference of the built image
+	Tag string `yaml:"tag"`
+	// KubernetesVersion is passed as version to the provision scripts
+	KubernetesVersion string `yaml:"kubernetesVersion,omitempty"`
+	// Packages are installed on the node with yum before the provision scripts run
+	Packages []string `yaml:"packages,omitempty"`
+	// Scripts is the directory with the provision scripts and the scripts which the image runs
+	// on the nodes of a cluster, like node01.sh and nodes.sh, it is copied to /scripts of the image
+	Scripts string `yaml:"scripts"`
+	// Provision are the scripts of the scripts directory which run on the node in the given order
+	Provision []string `yaml:"provision,omitempty"`
+	// Args are passed as arguments to every provision script
+	Args []string `yaml:"args,omitempty"`
+	// Manifests are files or directories of manifests which are copied to RecipeManifestsDir on the node
+	Manifests []string `yaml:"manifests,omitempty"`
+	// Files are copied to the node before the packages are installed
+	Files []RecipeFile `yaml:"files,omitempty"`
+	// Memory is the amount of ram of the node which is provisioned, like 3096M
+	Memory string `yaml:"memory,omitempty"`
+	// CPU is the number of cpu cores of the node which is provisioned
+	CPU uint `yaml:"cpu,omitempty"`
+	// Labels are added to the labels with the build metadata of the image
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Digest is the sha256 of the recipe file
+	Digest string `yaml:"-"`
+}
+
+// LoadRecipe reads and validates a recipe, the paths of the recipe are resolved relative to its directory
+func LoadRecipe(recipePath string) (*Recipe, error) {
+	data, err := ioutil.ReadFile(recipePath)
+	if err != nil {
+		return nil, err
+	}
+	recipe := &Recipe{
+		Provision: []string{"provision.sh"},
+		Memory:    "3096M",
+		CPU:       2,
+	}
+	if err := yaml.UnmarshalStrict(data, recipe); err != nil {
+		return nil, fmt.Errorf("failed to parse the recipe %s: %v", recipePath, err)
+	}
+	sum := sha256.Sum256(data)
+	recipe.Digest = hex.EncodeToString(sum[:])
+
+	dir, err := filepath.Abs(filepath.Dir(recipePath))
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(p string) string {
+		if filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+
+	if err := recipe.validate(); err != nil {
+		return nil, fmt.Errorf("invalid recipe %s: %v", recipePath, err)
+	}
+
+	recipe.Scripts = resolve(recipe.Scripts)
+	for _, script := range recipe.Provision {
+		if _, err := os.Stat(filepath.Join(recipe.Scripts, script)); err != nil {
+			return nil, fmt.Errorf("invalid recipe %s: the provision script %s is missing: %v", recipePath, script, err)
+		}
+	}
+	for i := range recipe.Manifests {
+		recipe.Manifests[i] = resolve(recipe.Manifests[i])
+	}
+	for i := range recipe.Files {
+		recipe.Files[i].Source = resolve(recipe.Files[i].Source)
+		if _, err := os.Stat(recipe.Files[i].Source); err != nil {
+			return nil, fmt.Errorf("invalid recipe %s: %v", recipePath, err)
+		}
+	}
+	return recipe, nil
+}
+
+func (r *Recipe) validate() error {
+	if r.Base == "" {
+		return fmt.Errorf("the base image is missing")
+	}
+	if r.Tag == "" {
+		return fmt.Errorf("the tag of the image is missing")
+	}
+	if r.Scripts == "" {
+		return fmt.Errorf("the scripts directory is missing")
+	}
+	if len(r.Provision) == 0 {
+		return fmt.Errorf("at least one provision script is needed")
+	}
+	for _, script := range r.Provision {
+		if script != path.Base(script) || !packagePattern.MatchString(script) {
+			return fmt.Errorf("the provision script %q has to be a file name of the scripts directory", script)
+		}
+	}
+	for _, arg := range r.Args {
+		if !argPattern.MatchString(arg) {
+			return fmt.Errorf("invalid argument %q of the provision scripts", arg)
+		}
+	}
+	if err := ValidateKubernetesVersion(r.KubernetesVersion); err != nil {
+		return err
+	}
+	for _, pkg := range r.Packages {
+		if !packagePattern.MatchString(pkg) {
+			return fmt.Errorf("invalid package %q", pkg)
+		}
+	}
+	for _, file := range r.Files {
+		if file.Source == "" {
+			return fmt.Errorf("the source of the file %s is missing", file.Destination)
+		}
+		if err := ValidateGuestPath(file.Destination); err != nil {
+			return err
+		}
+	}
+	if !memoryPattern.MatchString(r.Memory) {
+		return fmt.Errorf("invalid memory %q, expected a number with an optional unit like 3096M", r.Memory)
+	}
+	if r.CPU == 0 {
+		return fmt.Errorf("at least one cpu core is needed")
+	}
+	for key := range r.Labels {
+		if !labelPattern.MatchString(key) {
+			return fmt.Errorf("invalid label %q", key)
+		}
+	}
+	return nil
+}
+
+// ValidateKubernetesVersion returns an error if the version is neither empty nor a version like 1.13.3
+func ValidateKubernetesVersion(version string) error {
+	if version != "" && !versionPattern.MatchString(version) {
+		return fmt.Errorf("invalid Kubernetes version %q", version)
+	}
+	return nil
+}
+
+// ValidateGuestPath returns an error if the path on the node is not absolute or contains characters
+// which would have to be quoted in the shell
+func ValidateGuestPath(p string) error {
+	if !guestPattern.MatchString(p) {
+		return fmt.Errorf("the path %q on the node has to be absolute and may only contain letters, digits and -_./", p)
+	}
+	return nil
+}
+
+// Env returns the environment of the provision scripts
+func (r *Recipe) Env() []string {
+	if r.KubernetesVersion == "" {
+		return nil
+	}
+	return []string{"version=" + r.KubernetesVersion}
+}
+
+// BuildLabels returns the labels with the build metadata of the image and the labels of the recipe,
+// base is the reference of the base image which was provisioned
+func (r *Recipe) BuildLabels(base string) map[string]string {
+	labels := map[string]string{}
+	for key, value := range r.Labels {
+		labels[key] = value
+	}
+	labels[LabelRecipeDigest] = r.Digest
+	labels[LabelBaseImage] = base
+	if r.Name != "" {
+		labels[LabelRecipeName] = r.Name
+	}
+	if r.KubernetesVersion != "" {
+		labels[LabelKubernetesVersion] = r.KubernetesVersion
+	}
+	return labels
+}
+
+// LabelChanges returns the labels as LABEL instructions for the commit of an image, sorted by key
+func LabelChanges(labels map[string]string) []string {
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	changes := []string{}
+	for _, key := range keys {
+		changes = append(changes, fmt.Sprintf("LABEL %s=%q", key, labels[key]))
+	}
+	return changes
+}
@@ -0,0 +1,141 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateKubernetesVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		fails   bool
+	}{
+		{version: ""},
+		{version: "1.13.3"},
+		{version: "1.14.0-beta.1"},
+		{version: "1.13", fails: true},
+		{version: "v1.13.3", fails: true},
+		{version: "1.13.3; reboot", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			err := ValidateKubernetesVersion(tt.version)
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadRecipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-recipe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "scripts"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "scripts", "provision.sh"), []byte("#!/bin/bash\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "flannel.yaml"), []byte("kind: List\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	header := "name: k8s-1.13.3\nbase: kubevirtci/centos\ntag: kubevirtci/k8s-1.13.3\nscripts: scripts\n"
+	tests := []struct {
+		name   string
+		recipe string
+		check  func(r *Recipe) bool
+		fails  bool
+	}{
+		{
+			name:   "defaults",
+			recipe: header,
+			check: func(r *Recipe) bool {
+				return reflect.DeepEqual(r.Provision, []string{"provision.sh"}) && r.Memory == "3096M" && r.CPU == 2 &&
+					r.Scripts == filepath.Join(dir, "scripts") && r.Env() == nil
+			},
+		},
+		{
+			name:   "version, arguments and files",
+			recipe: header + "kubernetesVersion: 1.13.3\nargs:\n- \"true\"\nfiles:\n- source: flannel.yaml\n  destination: /tmp/flannel.yaml\n",
+			check: func(r *Recipe) bool {
+				return reflect.DeepEqual(r.Env(), []string{"version=1.13.3"}) && reflect.DeepEqual(r.Args, []string{"true"}) &&
+					reflect.DeepEqual(r.Files, []RecipeFile{{Source: filepath.Join(dir, "flannel.yaml"), Destination: "/tmp/flannel.yaml"}})
+			},
+		},
+		{name: "unknown field", recipe: header + "crio: true\n", fails: true},
+		{name: "missing base", recipe: "tag: kubevirtci/k8s-1.13.3\nscripts: scripts\n", fails: true},
+		{name: "missing provision script", recipe: header + "provision:\n- nodes.sh\n", fails: true},
+		{name: "invalid argument", recipe: header + "args:\n- \"true; reboot\"\n", fails: true},
+		{name: "invalid version", recipe: header + "kubernetesVersion: v1.13\n", fails: true},
+		{name: "missing file", recipe: header + "files:\n- source: genie.yaml\n  destination: /tmp/genie.yaml\n", fails: true},
+		{name: "relative destination", recipe: header + "files:\n- source: flannel.yaml\n  destination: tmp/flannel.yaml\n", fails: true},
+		{
+			name:   "memory in gigabytes",
+			recipe: header + "memory: 5G\n",
+			check:  func(r *Recipe) bool { return r.Memory == "5G" },
+		},
+		{name: "memory with arguments", recipe: header + "memory: \"3096M --cpu 64\"\n", fails: true},
+		{name: "memory with a command", recipe: header + "memory: 3096M;reboot\n", fails: true},
+		{name: "memory with an unknown unit", recipe: header + "memory: 3T\n", fails: true},
+		{name: "empty memory", recipe: header + "memory: \"\"\n", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "recipe.yaml")
+			if err := ioutil.WriteFile(path, []byte(tt.recipe), 0644); err != nil {
+				t.Fatal(err)
+			}
+			recipe, err := LoadRecipe(path)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", recipe)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.check(recipe) {
+				t.Errorf("unexpected recipe %+v", recipe)
+			}
+		})
+	}
+}
+
+// TestProviderRecipes fails if a recipe of the providers in cluster-provision is invalid
+func TestProviderRecipes(t *testing.T) {
+	dir := filepath.Join("..", "..", "..")
+	recipes, err := filepath.Glob(filepath.Join(dir, "*", "recipe.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	versioned, err := filepath.Glob(filepath.Join(dir, "*", "*", "recipe.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recipes = append(recipes, versioned...)
+	if len(recipes) == 0 {
+		t.Skip("the providers of cluster-provision are not available")
+	}
+
+	for _, path := range recipes {
+		t.Run(path, func(t *testing.T) {
+			if _, err := LoadRecipe(path); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+const shareSettings = `
+set -e
+
+modprobe 9pnet_virtio 2>/dev/null || true
+modprobe 9p 2>/dev/null || true
+if ! grep -qw 9p /proc/filesystems; then
+    echo "the kernel of the node does not support 9p file systems" >&2
+    exit 1
+fi
+{{- range .}}
+
+mkdir -p '{{.GuestPath}}'
+mountpoint -q '{{.GuestPath}}' || mount -t 9p -o trans=virtio,version=9p2000.L,msize=262144{{if .ReadOnly}},ro{{end}} {{.Tag}} '{{.GuestPath}}'
+{{- end}}
+EOF
+`
+
+// Share is a host directory which is attached to the node VMs via virtio-9p
+type Share struct {
+	HostPath  string
+	GuestPath string
+	ReadOnly  bool
+	// Tag identifies the share between qemu and the guest
+	Tag string
+}
+
+// ContainerPath returns the path the host directory is mounted to in the node container
+func (s Share) ContainerPath() string {
+	return "/shares/" + s.Tag
+}
+
+// QemuArgs returns the qemu arguments which attach the share to the VM
+func (s Share) QemuArgs() string {
+	readOnly := ""
+	if s.ReadOnly {
+		readOnly = ",readonly"
+	}
+	return fmt.Sprintf("-fsdev local,id=%s,path=%s,security_model=none%s -device virtio-9p-pci,fsdev=%s,mount_tag=%s",
+		s.Tag, s.ContainerPath(), readOnly, s.Tag, s.Tag)
+}
+
+// ParseShares parses the values of the --share flag in the format /host/path:/guest/path[:ro]
+func ParseShares(values []string) ([]Share, error) {
+	shares := []Share{}
+	for i, value := range values {
+		parts := strings.Split(value, ":")
+		if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid share %q, expected /host/path:/guest/path[:ro]", value)
+		}
+
+		share := Share{
+			GuestPath: parts[1],
+			Tag:       fmt.Sprintf("share%d", i),
+		}
+		if len(parts) == 3 {
+			if parts[2] != "ro" {
+				return nil, fmt.Errorf("invalid share %q, the only supported option is ro", value)
+			}
+			share.ReadOnly = true
+		}
+		if !filepath.IsAbs(share.GuestPath) || strings.ContainsAny(share.GuestPath, "'") {
+			return nil, fmt.Errorf("invalid share %q, the guest path has to be absolute and must not contain quotes", value)
+		}
+
+		hostPath, err := filepath.Abs(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(hostPath)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("invalid share %q, %s is not a directory", value, hostPath)
+		}
+		share.HostPath = hostPath
+
+		shares = append(shares, share)
+	}
+	return shares, nil
+}
+
+// GetShareMountScript returns a script which mounts the shares in the node
+func GetShareMountScript(shares []Share) (string, error) {
+	buf := new(bytes.Buffer)
+	t, err := template.New("shares").Parse(shareSettings)
+	if err != nil {
+		return "", err
+	}
+	if err := t.Execute(buf, shares); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
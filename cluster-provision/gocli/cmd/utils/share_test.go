@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseShares(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gocli-share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := filepath.Join(dir, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(file, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		shares []Share
+		fails  bool
+	}{
+		{name: "no shares", values: nil, shares: []Share{}},
+		{
+			name:   "read write share",
+			values: []string{data + ":/mnt/data"},
+			shares: []Share{{HostPath: data, GuestPath: "/mnt/data", Tag: "share0"}},
+		},
+		{
+			name:   "several shares",
+			values: []string{data + ":/mnt/data:ro", dir + ":/mnt/dir"},
+			shares: []Share{
+				{HostPath: data, GuestPath: "/mnt/data", ReadOnly: true, Tag: "share0"},
+				{HostPath: dir, GuestPath: "/mnt/dir", Tag: "share1"},
+			},
+		},
+		{
+			name:   "host path which is cleaned",
+			values: []string{data + "/../data/:/mnt/data"},
+			shares: []Share{{HostPath: data, GuestPath: "/mnt/data", Tag: "share0"}},
+		},
+		{name: "missing guest path", values: []string{data}, fails: true},
+		{name: "empty host path", values: []string{":/mnt/data"}, fails: true},
+		{name: "empty guest path", values: []string{data + ":"}, fails: true},
+		{name: "unknown option", values: []string{data + ":/mnt/data:rw"}, fails: true},
+		{name: "too many fields", values: []string{data + ":/mnt/data:ro:z"}, fails: true},
+		{name: "relative guest path", values: []string{data + ":mnt/data"}, fails: true},
+		{name: "guest path with a quote", values: []string{data + ":/mnt/it's"}, fails: true},
+		{name: "missing host path", values: []string{filepath.Join(dir, "missing") + ":/mnt/data"}, fails: true},
+		{name: "host path which is a file", values: []string{file + ":/mnt/data"}, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := ParseShares(tt.values)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", shares)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(shares, tt.shares) {
+				t.Errorf("expected %+v, got %+v", tt.shares, shares)
+			}
+		})
+	}
+}
+
+func TestShareQemuArgs(t *testing.T) {
+	tests := []struct {
+		share    Share
+		expected string
+	}{
+		{
+			share:    Share{HostPath: "/data", GuestPath: "/mnt/data", Tag: "share0"},
+			expected: "-fsdev local,id=share0,path=/shares/share0,security_model=none -device virtio-9p-pci,fsdev=share0,mount_tag=share0",
+		},
+		{
+			share:    Share{HostPath: "/data", GuestPath: "/mnt/data", ReadOnly: true, Tag: "share1"},
+			expected: "-fsdev local,id=share1,path=/shares/share1,security_model=none,readonly -device virtio-9p-pci,fsdev=share1,mount_tag=share1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.share.Tag, func(t *testing.T) {
+			if args := tt.share.QemuArgs(); args != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, args)
+			}
+		})
+	}
+}
+
+func TestGetShareMountScript(t *testing.T) {
+	script, err := GetShareMountScript([]Share{
+		{HostPath: "/data", GuestPath: "/mnt/data", Tag: "share0"},
+		{HostPath: "/config", GuestPath: "/mnt/config", ReadOnly: true, Tag: "share1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"mount -t 9p -o trans=virtio,version=9p2000.L,msize=262144 share0 '/mnt/data'",
+		"mount -t 9p -o trans=virtio,version=9p2000.L,msize=262144,ro share1 '/mnt/config'",
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected the script to contain %s, got\n%s", expected, script)
+		}
+	}
+}
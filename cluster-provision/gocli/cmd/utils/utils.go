@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/docker/go-connections/nat"
 	"github.com/spf13/pflag"
@@ -25,3 +28,20 @@ func AppendIfExplicit(ports nat.PortMap, exposedPort int, flagSet *pflag.FlagSet
 	}
 	return nil
 }
+
+// ShellQuote quotes the value as one word for bash, single quotes in it are escaped
+func ShellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+// ErrInterrupted is returned by the run commands once an interrupt canceled their context
+var ErrInterrupted = fmt.Errorf("Interrupt received, clean up")
+
+// Interrupted returns ErrInterrupted if the context was canceled, docker calls with the context fail on their own,
+// the provisioning steps without it finish first
+func Interrupted(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"os/exec"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skipf("bash is not available: %v", err)
+	}
+
+	tests := []string{
+		"",
+		"plain",
+		"with space",
+		"it's",
+		`double "quotes"`,
+		"$HOME `id` $(id) \\ ! * ?",
+		"-machine type=q35 -device 'virtio-9p-pci'",
+	}
+
+	for _, value := range tests {
+		t.Run(value, func(t *testing.T) {
+			out, err := exec.Command(bash, "-c", "printf %s "+ShellQuote(value)).Output()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(out) != value {
+				t.Errorf("expected %q, got %q", value, out)
+			}
+		})
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	tests := []struct {
+		name     string
+		cancel   bool
+		expected error
+	}{
+		{name: "running", cancel: false, expected: nil},
+		{name: "interrupted", cancel: true, expected: ErrInterrupted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+			if err := Interrupted(ctx); err != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, err)
+			}
+		})
+	}
+}
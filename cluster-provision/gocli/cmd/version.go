@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/context"
+
+	"kubevirt.io/kubevirtci/gocli/docker"
+)
+
+// NewVersionCommand returns command to print the docker API versions of gocli and of the daemon
+func NewVersionCommand() *cobra.Command {
+
+	version := &cobra.Command{
+		Use:   "version",
+		Short: "version prints the docker API versions of gocli and of the docker daemon",
+		Long: `version prints the docker API versions of gocli and of the docker daemon
+
+gocli negotiates the API version with the daemon, it speaks the newest version
+which both support. DOCKER_API_VERSION pins the version instead.
+`,
+		RunE: version,
+		Args: cobra.NoArgs,
+	}
+
+	return version
+}
+
+func version(cmd *cobra.Command, _ []string) error {
+
+	cli, err := docker.NewClient()
+	if err != nil {
+		return err
+	}
+
+	negotiation := "negotiated with the daemon"
+	if os.Getenv("DOCKER_API_VERSION") != "" {
+		negotiation = "pinned by DOCKER_API_VERSION"
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Client API version: %s (%s, gocli supports up to %s)\n", cli.ClientVersion(), negotiation, docker.MaxAPIVersion)
+
+	server, err := cli.ServerVersion(context.Background())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Server version:     %s\n", server.Version)
+	fmt.Fprintf(cmd.OutOrStdout(), "Server API version: %s (minimum version %s)\n", server.APIVersion, server.MinAPIVersion)
+	return nil
+}
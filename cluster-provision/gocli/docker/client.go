@@ -0,0 +1,69 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/versions"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// MaxAPIVersion is the newest docker API version which the vendored client types describe
+	MaxAPIVersion = client.DefaultVersion
+	// APIVersionMounts is the first API version which knows the mounts of the host config,
+	// older daemons silently ignore them and start the containers without their volumes
+	APIVersionMounts = "1.25"
+	// APIVersionVolumeLabels is the first API version which stores the labels of volumes and lists
+	// the mounts of containers, older daemons silently drop the labels
+	APIVersionVolumeLabels = "1.23"
+)
+
+// NewClient returns a client of the docker daemon of DOCKER_HOST which speaks the newest
+// API version supported by gocli and the daemon. DOCKER_API_VERSION pins the version.
+// If the daemon is not reachable, the client speaks MaxAPIVersion and its first request fails.
+func NewClient() (*client.Client, error) {
+	cli, err := client.NewEnvClient()
+	if err != nil {
+		return nil, err
+	}
+	if os.Getenv("DOCKER_API_VERSION") != "" {
+		return cli, nil
+	}
+
+	// Without a version the daemon answers with its own API version, so the request
+	// also works with daemons which dropped the versions known to gocli
+	cli.UpdateClientVersion("")
+	server, err := cli.ServerVersion(context.Background())
+	if err != nil {
+		cli.UpdateClientVersion(MaxAPIVersion)
+		return cli, nil
+	}
+	version, err := NegotiateAPIVersion(server.APIVersion, server.MinAPIVersion)
+	if err != nil {
+		return nil, fmt.Errorf("the docker daemon %s: %v", server.Version, err)
+	}
+	cli.UpdateClientVersion(version)
+	return cli, nil
+}
+
+// NegotiateAPIVersion returns the newest API version which gocli and the daemon support.
+// A daemon which dropped MaxAPIVersion would get requests without the fields which its
+// API requires, so that is an error instead of a downgrade.
+func NegotiateAPIVersion(serverVersion string, serverMinVersion string) (string, error) {
+	if serverMinVersion != "" && versions.LessThan(MaxAPIVersion, serverMinVersion) {
+		return "", fmt.Errorf("the daemon requires the API %s or newer, gocli only supports up to %s, upgrade gocli or use an older docker daemon", serverMinVersion, MaxAPIVersion)
+	}
+	version := MaxAPIVersion
+	if serverVersion != "" && versions.LessThan(serverVersion, version) {
+		version = serverVersion
+	}
+	return version, nil
+}
+
+// SupportsAPI returns true if the client speaks at least the API version, features which need
+// a newer API than the oldest supported daemon are only used if the client supports them
+func SupportsAPI(cli *client.Client, version string) bool {
+	return versions.GreaterThanOrEqualTo(cli.ClientVersion(), version)
+}
@@ -0,0 +1,134 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	tests := []struct {
+		name             string
+		serverVersion    string
+		serverMinVersion string
+		expected         string
+		fails            bool
+	}{
+		{name: "unknown daemon", expected: MaxAPIVersion},
+		{name: "newer daemon", serverVersion: "1.39", serverMinVersion: "1.12", expected: MaxAPIVersion},
+		{name: "same daemon", serverVersion: MaxAPIVersion, serverMinVersion: "1.12", expected: MaxAPIVersion},
+		{name: "daemon with the version as minimum", serverVersion: "1.40", serverMinVersion: MaxAPIVersion, expected: MaxAPIVersion},
+		{name: "older daemon", serverVersion: "1.24", serverMinVersion: "1.12", expected: "1.24"},
+		{name: "daemon without minimum", serverVersion: "1.22", expected: "1.22"},
+		{name: "daemon which dropped the version", serverVersion: "1.44", serverMinVersion: "1.40", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, err := NegotiateAPIVersion(tt.serverVersion, tt.serverMinVersion)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", version)
+				}
+				if !strings.Contains(err.Error(), "upgrade gocli") {
+					t.Errorf("expected the error to name the remedy, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, version)
+			}
+		})
+	}
+}
+
+func TestSupportsAPI(t *testing.T) {
+	tests := []struct {
+		clientVersion string
+		version       string
+		supported     bool
+	}{
+		{clientVersion: "1.25", version: APIVersionMounts, supported: true},
+		{clientVersion: "1.24", version: APIVersionMounts, supported: false},
+		{clientVersion: "1.24", version: APIVersionVolumeLabels, supported: true},
+		{clientVersion: "1.23", version: APIVersionVolumeLabels, supported: true},
+		{clientVersion: "1.22", version: APIVersionVolumeLabels, supported: false},
+		{clientVersion: "1.40", version: APIVersionMounts, supported: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientVersion+"-"+tt.version, func(t *testing.T) {
+			cli, err := client.NewClient("unix:///var/run/docker.sock", tt.clientVersion, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if supported := SupportsAPI(cli, tt.version); supported != tt.supported {
+				t.Errorf("expected %t, got %t", tt.supported, supported)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	for _, name := range []string{"DOCKER_HOST", "DOCKER_API_VERSION", "DOCKER_CERT_PATH"} {
+		value, set := os.LookupEnv(name)
+		defer func(name string) {
+			if set {
+				os.Setenv(name, value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}(name)
+		os.Unsetenv(name)
+	}
+
+	tests := []struct {
+		name     string
+		version  string
+		expected string
+		fails    bool
+	}{
+		{name: "newer daemon", version: `{"Version": "18.09.7", "ApiVersion": "1.39", "MinAPIVersion": "1.12"}`, expected: MaxAPIVersion},
+		{name: "older daemon", version: `{"Version": "1.12.6", "ApiVersion": "1.24", "MinAPIVersion": "1.12"}`, expected: "1.24"},
+		{name: "daemon which dropped the version", version: `{"Version": "25.0.0", "ApiVersion": "1.44", "MinAPIVersion": "1.40"}`, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/version" {
+					http.Error(w, "unexpected request "+r.URL.Path, http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.version))
+			}))
+			defer server.Close()
+			os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+
+			cli, err := NewClient()
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got the API %s", cli.ClientVersion())
+				}
+				if !strings.Contains(err.Error(), "upgrade gocli") {
+					t.Errorf("expected the error to name the remedy, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if version := cli.ClientVersion(); version != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, version)
+			}
+		})
+	}
+}
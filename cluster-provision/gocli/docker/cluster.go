@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+)
+
+const (
+	// ClusterLabel marks the container which publishes the ports of a cluster, its value is the prefix of the cluster
+	ClusterLabel = "io.kubevirtci.cluster"
+	// ClusterImageLabel contains the cluster image the cluster was started from
+	ClusterImageLabel = "io.kubevirtci.cluster.image"
+)
+
+// ClusterLabels returns the labels of the container which publishes the ports of the cluster
+func ClusterLabels(prefix string, image string) map[string]string {
+	return map[string]string{
+		ClusterLabel:      prefix,
+		ClusterImageLabel: image,
+	}
+}
+
+// GetClusterContainer returns the container which publishes the ports of the cluster with the prefix.
+// Clusters started before the containers were labeled are found by the names of dnsmasq and of the okd cluster container.
+func GetClusterContainer(cli *client.Client, prefix string) (*types.Container, error) {
+	args, err := filters.ParseFlag(fmt.Sprintf("label=%s=%s", ClusterLabel, prefix), filters.NewArgs())
+	if err != nil {
+		return nil, err
+	}
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+		Filters: args,
+		All:     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 1 {
+		return &containers[0], nil
+	}
+
+	for _, name := range []string{prefix + "-dnsmasq", prefix + "-cluster"} {
+		containers, err := GetPrefixedContainers(cli, name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range containers {
+			if containers[i].Names[0] == "/"+name {
+				return &containers[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("failed to find a cluster with the prefix %s", prefix)
+}
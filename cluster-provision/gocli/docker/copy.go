@@ -0,0 +1,42 @@
+package docker
+
+import (
+	"context"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/archive"
+)
+
+// CopyToContainer copies the file or directory from the host into the container like docker cp.
+// A destination path which ends with / has to be an existing directory, the source is copied into it.
+// Otherwise the parent directory of the destination path has to exist and the source is copied to the path.
+func CopyToContainer(ctx context.Context, cli *client.Client, container string, srcPath string, dstPath string) error {
+	dstInfo := archive.CopyInfo{
+		Path: dstPath,
+	}
+	if strings.HasSuffix(dstPath, "/") {
+		dstInfo.Exists = true
+		dstInfo.IsDir = true
+	}
+
+	srcInfo, err := archive.CopyInfoSourcePath(srcPath, true)
+	if err != nil {
+		return err
+	}
+
+	srcArchive, err := archive.TarResource(srcInfo)
+	if err != nil {
+		return err
+	}
+	defer srcArchive.Close()
+
+	dstDir, preparedArchive, err := archive.PrepareArchiveCopy(srcArchive, srcInfo, dstInfo)
+	if err != nil {
+		return err
+	}
+	defer preparedArchive.Close()
+
+	return cli.CopyToContainer(ctx, container, dstDir, preparedArchive, types.CopyToContainerOptions{})
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// DialExec runs the command in the container and returns a connection to its stdin and stdout.
+// Combined with a command like netcat it reaches ports which are only available in the network
+// namespace of the container, even if they are not published on the host.
+func DialExec(ctx context.Context, cli *client.Client, container string, args []string) (net.Conn, error) {
+	id, err := cli.ContainerExecCreate(ctx, container, types.ExecConfig{
+		Cmd:          args,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	attached, err := cli.ContainerExecAttach(ctx, id.ID, types.ExecConfig{
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(demultiplexStreams(writer, ioutil.Discard, attached.Reader))
+	}()
+
+	return &execConn{attached: attached, reader: reader}, nil
+}
+
+// execConn is a net.Conn which writes to stdin and reads from stdout of an exec session
+type execConn struct {
+	attached types.HijackedResponse
+	reader   *io.PipeReader
+}
+
+func (c *execConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
+
+func (c *execConn) Write(b []byte) (int, error) {
+	return c.attached.Conn.Write(b)
+}
+
+func (c *execConn) Close() error {
+	c.attached.CloseWrite()
+	c.attached.Close()
+	return c.reader.Close()
+}
+
+func (c *execConn) LocalAddr() net.Addr {
+	return c.attached.Conn.LocalAddr()
+}
+
+func (c *execConn) RemoteAddr() net.Addr {
+	return c.attached.Conn.RemoteAddr()
+}
+
+func (c *execConn) SetDeadline(t time.Time) error {
+	return c.attached.Conn.SetDeadline(t)
+}
+
+func (c *execConn) SetReadDeadline(t time.Time) error {
+	return c.attached.Conn.SetReadDeadline(t)
+}
+
+func (c *execConn) SetWriteDeadline(t time.Time) error {
+	return c.attached.Conn.SetWriteDeadline(t)
+}
@@ -42,6 +42,12 @@ func GetPrefixedVolumes(cli *client.Client, prefix string) ([]*types.Volume, err
 }
 
 func ImagePull(cli *client.Client, ctx context.Context, ref string, options types.ImagePullOptions) error {
+	return imagePull(cli, ctx, ref, options, func(reader io.ReadCloser) error {
+		return PrintProgress(reader, os.Stdout)
+	})
+}
+
+func imagePull(cli *client.Client, ctx context.Context, ref string, options types.ImagePullOptions, progress func(io.ReadCloser) error) error {
 
 	for _, i := range []int{0, 1, 2, 6} {
 		time.Sleep(time.Duration(i) * time.Second)
@@ -50,7 +56,8 @@ func ImagePull(cli *client.Client, ctx context.Context, ref string, options type
 			log.Printf("failed to download %s: %v\n", ref, err)
 			continue
 		}
-		err = PrintProgress(reader, os.Stdout)
+		err = progress(reader)
+		reader.Close()
 		if err != nil {
 			log.Printf("failed to download %s: %v\n", ref, err)
 			continue
@@ -74,10 +81,20 @@ func GetDDNSMasqContainer(cli *client.Client, prefix string) (*types.Container,
 }
 
 func Exec(cli *client.Client, container string, args []string, out io.Writer) (bool, error) {
+	exitCode, err := ExecStreams(cli, container, args, out, out)
+	if err != nil {
+		return false, err
+	}
+	return exitCode == 0, nil
+}
+
+// ExecStreams runs the command without a TTY, so that stdout and stderr of the command
+// can be written to different writers, and returns the exit code of the command
+func ExecStreams(cli *client.Client, container string, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
 	ctx := context.Background()
 	id, err := cli.ContainerExecCreate(ctx, container, types.ExecConfig{
 		Privileged:   true,
-		Tty:          true,
+		Tty:          false,
 		Detach:       false,
 		Cmd:          args,
 		AttachStdout: true,
@@ -85,26 +102,54 @@ func Exec(cli *client.Client, container string, args []string, out io.Writer) (b
 	})
 
 	if err != nil {
-		return false, err
+		return -1, err
 	}
 
 	attached, err := cli.ContainerExecAttach(ctx, id.ID, types.ExecConfig{
 		AttachStderr: true,
 		AttachStdout: true,
-		Tty:          true,
+		Tty:          false,
 	})
 	if err != nil {
-		return false, err
+		return -1, err
 	}
 	defer attached.Close()
 
-	io.Copy(out, attached.Reader)
+	if err := demultiplexStreams(stdout, stderr, attached.Reader); err != nil {
+		return -1, err
+	}
 
 	resp, err := cli.ContainerExecInspect(ctx, id.ID)
 	if err != nil {
-		return false, err
+		return -1, err
+	}
+	return resp.ExitCode, nil
+}
+
+// ContainerLogs writes the stdout and the stderr of the container with timestamps to the writers
+func ContainerLogs(cli *client.Client, container string, stdout io.Writer, stderr io.Writer) error {
+	ctx := context.Background()
+	info, err := cli.ContainerInspect(ctx, container)
+	if err != nil {
+		return err
+	}
+
+	logs, err := cli.ContainerLogs(ctx, container, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+
+	// The output of containers with a TTY is not multiplexed
+	if info.Config != nil && info.Config.Tty {
+		_, err = io.Copy(stdout, logs)
+		return err
 	}
-	return resp.ExitCode == 0, nil
+	return demultiplexStreams(stdout, stderr, logs)
 }
 
 func Terminal(cli *client.Client, container string, args []string, file *os.File) (int, error) {
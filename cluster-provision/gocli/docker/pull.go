@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+)
+
+// PullPolicy defines when images are pulled from their registry
+type PullPolicy string
+
+const (
+	// PullAlways pulls the image, even if it is present locally
+	PullAlways PullPolicy = "always"
+	// PullMissing only pulls the image if it is not present locally
+	PullMissing PullPolicy = "missing"
+	// PullNever never pulls the image and fails if it is not present locally
+	PullNever PullPolicy = "never"
+)
+
+// ParsePullPolicy validates the given pull policy
+func ParsePullPolicy(policy string) (PullPolicy, error) {
+	switch p := PullPolicy(policy); p {
+	case PullAlways, PullMissing, PullNever:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown pull policy %q, expected one of %s, %s or %s", policy, PullAlways, PullMissing, PullNever)
+}
+
+// ImagePresent checks if the image reference is present in the local image store
+func ImagePresent(cli *client.Client, ctx context.Context, ref string) (bool, error) {
+	_, _, err := cli.ImageInspectWithRaw(ctx, ref)
+	if err == nil {
+		return true, nil
+	}
+	if client.IsErrImageNotFound(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// EnsureImage makes the image available locally according to the pull policy and prints the pull progress
+func EnsureImage(cli *client.Client, ctx context.Context, ref string, policy PullPolicy) error {
+	pull, err := needsPull(cli, ctx, ref, policy)
+	if err != nil || !pull {
+		return err
+	}
+	fmt.Printf("Download the image %s\n", ref)
+	return ImagePull(cli, ctx, ref, types.ImagePullOptions{})
+}
+
+// EnsureImages makes all images available locally according to the pull policy.
+// The images are pulled concurrently, so only the start and the end of every pull is printed.
+func EnsureImages(cli *client.Client, ctx context.Context, refs []string, policy PullPolicy) error {
+	wg := sync.WaitGroup{}
+	errs := make(chan error, len(refs))
+
+	for _, ref := range refs {
+		wg.Add(1)
+		go func(ref string) {
+			defer wg.Done()
+			pull, err := needsPull(cli, ctx, ref, policy)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !pull {
+				return
+			}
+			fmt.Printf("Download the image %s\n", ref)
+			err = imagePull(cli, ctx, ref, types.ImagePullOptions{}, waitForPull)
+			if err != nil {
+				errs <- err
+				return
+			}
+			fmt.Printf("Downloaded the image %s\n", ref)
+		}(ref)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	msgs := []string{}
+	for err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("failed to provide images: %s", strings.Join(msgs, "; "))
+	}
+	return nil
+}
+
+func needsPull(cli *client.Client, ctx context.Context, ref string, policy PullPolicy) (bool, error) {
+	if policy == PullAlways {
+		return true, nil
+	}
+
+	present, err := ImagePresent(cli, ctx, ref)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up the image %s: %v", ref, err)
+	}
+
+	if !present && policy == PullNever {
+		return false, fmt.Errorf("the image %s is not present locally and the pull policy is %s", ref, PullNever)
+	}
+	return !present, nil
+}
+
+// waitForPull consumes the pull progress without printing it
+func waitForPull(progressReader io.ReadCloser) error {
+	scanner := bufio.NewScanner(progressReader)
+	for scanner.Scan() {
+		if err := checkForError(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,106 @@
+package docker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/client"
+)
+
+func TestParsePullPolicy(t *testing.T) {
+	tests := []struct {
+		policy   string
+		expected PullPolicy
+		fails    bool
+	}{
+		{policy: "always", expected: PullAlways},
+		{policy: "missing", expected: PullMissing},
+		{policy: "never", expected: PullNever},
+		{policy: "Always", fails: true},
+		{policy: "if-not-present", fails: true},
+		{policy: "", fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			policy, err := ParsePullPolicy(tt.policy)
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", policy)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if policy != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, policy)
+			}
+		})
+	}
+}
+
+func TestNeedsPull(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   PullPolicy
+		status   int
+		lookup   bool
+		expected bool
+		fails    bool
+	}{
+		{name: "always pulls a present image", policy: PullAlways, status: http.StatusOK, lookup: false, expected: true},
+		{name: "always pulls a missing image", policy: PullAlways, status: http.StatusNotFound, lookup: false, expected: true},
+		{name: "missing keeps a present image", policy: PullMissing, status: http.StatusOK, lookup: true, expected: false},
+		{name: "missing pulls a missing image", policy: PullMissing, status: http.StatusNotFound, lookup: true, expected: true},
+		{name: "never keeps a present image", policy: PullNever, status: http.StatusOK, lookup: true, expected: false},
+		{name: "never fails on a missing image", policy: PullNever, status: http.StatusNotFound, lookup: true, fails: true},
+		{name: "failed lookup", policy: PullMissing, status: http.StatusInternalServerError, lookup: true, fails: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lookups := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.HasSuffix(r.URL.Path, "/images/kubevirtci/k8s-1.13.3/json") {
+					http.Error(w, "unexpected request "+r.URL.Path, http.StatusBadRequest)
+					return
+				}
+				lookups++
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				if tt.status == http.StatusOK {
+					w.Write([]byte(`{"Id": "sha256:1234"}`))
+				} else {
+					w.Write([]byte(`{"message": "no such image"}`))
+				}
+			}))
+			defer server.Close()
+
+			cli, err := client.NewClient("tcp://"+strings.TrimPrefix(server.URL, "http://"), MaxAPIVersion, &http.Client{Transport: &http.Transport{}}, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pull, err := needsPull(cli, context.Background(), "kubevirtci/k8s-1.13.3", tt.policy)
+			if (lookups > 0) != tt.lookup {
+				t.Errorf("expected the image to be looked up: %t, got %d lookups", tt.lookup, lookups)
+			}
+			if tt.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %t", pull)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pull != tt.expected {
+				t.Errorf("expected %t, got %t", tt.expected, pull)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	stdWriterPrefixLen = 8
+	stdWriterFdIndex   = 0
+	stdWriterSizeIndex = 4
+)
+
+const (
+	streamStdin = iota
+	streamStdout
+	streamStderr
+	streamSystemErr
+)
+
+// demultiplexStreams splits the multiplexed stream which the docker daemon sends for exec sessions
+// without a TTY into the stdout and stderr writers.
+func demultiplexStreams(stdout io.Writer, stderr io.Writer, src io.Reader) error {
+	header := make([]byte, stdWriterPrefixLen)
+	for {
+		if _, err := io.ReadFull(src, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[stdWriterSizeIndex:]))
+		var out io.Writer
+		switch header[stdWriterFdIndex] {
+		case streamStdin, streamStdout:
+			out = stdout
+		case streamStderr:
+			out = stderr
+		case streamSystemErr:
+			msg := make([]byte, size)
+			if _, err := io.ReadFull(src, msg); err != nil {
+				return err
+			}
+			return fmt.Errorf("error from daemon in stream: %s", string(msg))
+		default:
+			return fmt.Errorf("unrecognized stream: %d", header[stdWriterFdIndex])
+		}
+
+		if _, err := io.CopyN(out, src, size); err != nil {
+			return err
+		}
+	}
+}
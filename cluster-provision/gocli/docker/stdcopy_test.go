@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// frame returns the payload with the header of the stream, like the docker daemon sends it
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, stdWriterPrefixLen)
+	header[stdWriterFdIndex] = stream
+	binary.BigEndian.PutUint32(header[stdWriterSizeIndex:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemultiplexStreams(t *testing.T) {
+	tests := []struct {
+		name    string
+		frames  [][]byte
+		oneByte bool
+		stdout  string
+		stderr  string
+		fails   bool
+	}{
+		{name: "no output"},
+		{
+			name:   "stdout and stderr",
+			frames: [][]byte{frame(streamStdout, "hello\n"), frame(streamStderr, "oops\n"), frame(streamStdout, "world\n")},
+			stdout: "hello\nworld\n",
+			stderr: "oops\n",
+		},
+		{
+			name:    "headers split across reads",
+			frames:  [][]byte{frame(streamStdout, "hello\n"), frame(streamStderr, "oops\n")},
+			oneByte: true,
+			stdout:  "hello\n",
+			stderr:  "oops\n",
+		},
+		{name: "stdin is written to stdout", frames: [][]byte{frame(streamStdin, "echo\n")}, stdout: "echo\n"},
+		{name: "empty frame", frames: [][]byte{frame(streamStdout, ""), frame(streamStdout, "done\n")}, stdout: "done\n"},
+		{
+			name:   "unknown stream",
+			frames: [][]byte{frame(streamStdout, "hello\n"), frame(7, "what\n")},
+			stdout: "hello\n",
+			fails:  true,
+		},
+		{name: "error of the daemon", frames: [][]byte{frame(streamSystemErr, "exec failed")}, fails: true},
+		{name: "truncated header", frames: [][]byte{frame(streamStdout, "hello\n")[:4]}, fails: true},
+		{
+			name:   "truncated payload",
+			frames: [][]byte{frame(streamStdout, "hello\n")[:stdWriterPrefixLen+2]},
+			stdout: "he",
+			fails:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = bytes.NewReader(bytes.Join(tt.frames, nil))
+			if tt.oneByte {
+				src = iotest.OneByteReader(src)
+			}
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+
+			err := demultiplexStreams(stdout, stderr, src)
+			if tt.fails && err == nil {
+				t.Error("expected an error")
+			}
+			if !tt.fails && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if stdout.String() != tt.stdout {
+				t.Errorf("expected stdout %q, got %q", tt.stdout, stdout)
+			}
+			if stderr.String() != tt.stderr {
+				t.Errorf("expected stderr %q, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// SharedVolumeLabel marks volumes which can be used by more than one cluster, like registry caches.
+// Shared volumes survive the removal of a cluster.
+const SharedVolumeLabel = "io.kubevirtci.shared"
+
+// SharedVolumesLabel lists the shared volumes which a container mounts, rm keeps them even if
+// they miss SharedVolumeLabel because they were created before gocli labeled them
+const SharedVolumesLabel = "io.kubevirtci.shared-volumes"
+
+// CreateSharedVolume creates the volume with the given name or returns the existing one.
+// Daemons older than APIVersionVolumeLabels get a volume without SharedVolumeLabel, rm keeps
+// it via SharedVolumesLabel of its containers, but rm --purge does not remove it.
+func CreateSharedVolume(ctx context.Context, cli *client.Client, name string) (types.Volume, error) {
+	body := volume.VolumesCreateBody{Name: name}
+	if SupportsAPI(cli, APIVersionVolumeLabels) {
+		body.Labels = map[string]string{SharedVolumeLabel: "true"}
+	}
+	return cli.VolumeCreate(ctx, body)
+}
+
+// IsSharedVolume returns true if the volume was created by CreateSharedVolume
+func IsSharedVolume(v *types.Volume) bool {
+	_, shared := v.Labels[SharedVolumeLabel]
+	return shared
+}
+
+// CreateSharedVolumeContainer creates the shared volume and the container which mounts it at the target.
+// The container carries SharedVolumesLabel, so that rm keeps an existing volume which misses the label.
+// rm --purge only removes volumes which no container uses, but it may remove the volume between its
+// creation and the creation of the container, docker then creates an empty unlabeled volume for the mount.
+// In that case the container is removed and both are created again.
+func CreateSharedVolumeContainer(ctx context.Context, cli *client.Client, volumeName string, target string, config *container.Config, hostConfig *container.HostConfig, name string) (types.Volume, container.ContainerCreateCreatedBody, error) {
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[SharedVolumesLabel] = volumeName
+	hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+		Type:   mount.TypeVolume,
+		Source: volumeName,
+		Target: target,
+	})
+
+	for attempt := 0; attempt < 3; attempt++ {
+		vol, err := CreateSharedVolume(ctx, cli, volumeName)
+		if err != nil {
+			return vol, container.ContainerCreateCreatedBody{}, err
+		}
+		created, err := cli.ContainerCreate(ctx, config, hostConfig, nil, name)
+		if err != nil {
+			return vol, created, err
+		}
+
+		// Once the container exists the volume is in use and rm --purge keeps it
+		mounted, err := cli.VolumeInspect(ctx, volumeName)
+		if err == nil && (IsSharedVolume(&mounted) || !IsSharedVolume(&vol)) {
+			return vol, created, nil
+		}
+		if err := cli.ContainerRemove(ctx, created.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			return vol, created, err
+		}
+	}
+	return types.Volume{}, container.ContainerCreateCreatedBody{}, fmt.Errorf("the volume %s was removed repeatedly while creating the container %s", volumeName, name)
+}
+
+// GetSharedVolumeNames returns the names of the shared volumes which the containers list in SharedVolumesLabel
+func GetSharedVolumeNames(containers []types.Container) map[string]bool {
+	names := map[string]bool{}
+	for _, c := range containers {
+		for _, name := range strings.Split(c.Labels[SharedVolumesLabel], ",") {
+			if name != "" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+// GetVolumeContainers returns all containers which mount the volume
+func GetVolumeContainers(cli *client.Client, name string) ([]types.Container, error) {
+	args, err := filters.ParseFlag("volume="+name, filters.NewArgs())
+	if err != nil {
+		return nil, err
+	}
+	return cli.ContainerList(context.Background(), types.ContainerListOptions{
+		Filters: args,
+		All:     true,
+	})
+}
+
+// GetMountedVolumes returns the names of the volumes mounted by the containers
+func GetMountedVolumes(containers []types.Container) []string {
+	names := []string{}
+	for _, c := range containers {
+		for _, m := range c.Mounts {
+			if m.Type == mount.TypeVolume && m.Name != "" {
+				names = append(names, m.Name)
+			}
+		}
+	}
+	return names
+}
@@ -8,19 +8,16 @@ do
     sleep 2
 done
 
-# enable CPU manager
+# enable CPU manager, the arguments go in front of KUBELET_EXTRA_ARGS so that the kubelet
+# arguments which gocli appends override them
+cpumanager_args="--feature-gates=CPUManager=true --cpu-manager-policy=static --kube-reserved=cpu=500m --system-reserved=cpu=500m"
 # kubeadm 1.11 uses a new config method for the kubelet
 if [ -f /etc/sysconfig/kubelet ]; then
     # TODO use config file! this is deprecated
-    cat <<EOT >>/etc/sysconfig/kubelet
-KUBELET_CPUMANAGER_ARGS=--feature-gates=CPUManager=true --cpu-manager-policy=static --kube-reserved=cpu=500m --system-reserved=cpu=500m
-EOT
+    sed -i "s|^KUBELET_EXTRA_ARGS=|KUBELET_EXTRA_ARGS=${cpumanager_args} |" /etc/sysconfig/kubelet
 else
-    cat <<EOT >>/etc/systemd/system/kubelet.service.d/09-kubeadm.conf
-Environment="KUBELET_CPUMANAGER_ARGS=--feature-gates=CPUManager=true --cpu-manager-policy=static --kube-reserved=cpu=500m --system-reserved=cpu=500m"
-EOT
+    sed -i "s|^Environment=\"KUBELET_EXTRA_ARGS=|Environment=\"KUBELET_EXTRA_ARGS=${cpumanager_args} |" /etc/systemd/system/kubelet.service.d/09-kubeadm.conf
 fi
-sed -i 's/$KUBELET_EXTRA_ARGS/$KUBELET_EXTRA_ARGS $KUBELET_CPUMANAGER_ARGS/' /etc/systemd/system/kubelet.service.d/10-kubeadm.conf
 
 systemctl daemon-reload
 service kubelet restart
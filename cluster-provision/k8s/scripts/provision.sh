@@ -224,4 +224,5 @@ docker pull quay.io/k8scsi/csi-attacher:v1.0.1
 docker pull quay.io/k8scsi/csi-provisioner:v1.0.1
 docker pull quay.io/k8scsi/csi-snapshotter:v1.0.1
 docker pull quay.io/cephcsi/rbdplugin:v1.0.0
+docker pull quay.io/cephcsi/cephfsplugin:v1.0.0
 docker pull quay.io/k8scsi/csi-node-driver-registrar:v1.0.2